@@ -0,0 +1,60 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"errors"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+var PerfAffinityError = errors.New("couldn't set the CPU affinity of the thread")
+
+// cpuSet is the cpu_set_t of the sched_{get,set}affinity syscalls, for
+// up to 1024 CPUs.
+type cpuSet [1024 / 64]uint64
+
+// schedAffinity gets or sets the CPU affinity of the calling thread.
+func schedAffinity(trap uintptr, set *cpuSet) error {
+	_, _, errno := syscall.RawSyscall(trap, 0, unsafe.Sizeof(*set), uintptr(unsafe.Pointer(set)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// PinToCPU locks the calling goroutine to its thread and pins the thread
+// to the CPU "cpu", e.g. before opening and reading the counters of the
+// CPU from the CPU itself, which keeps the reads from disturbing other
+// CPUs. The returned function restores the affinity of the thread and
+// unlocks the goroutine, and must be called from the same goroutine.
+// Being pinned, the goroutine waits for the CPU when other threads keep
+// it busy, and the threads it starts, e.g. with os/exec, inherit the
+// affinity.
+func PinToCPU(cpu int) (func(), error) {
+	if cpu < 0 || cpu >= len(cpuSet{})*64 {
+		return nil, PerfAffinityError
+	}
+	runtime.LockOSThread()
+
+	var old cpuSet
+	err := schedAffinity(syscall.SYS_SCHED_GETAFFINITY, &old)
+	if err != nil {
+		runtime.UnlockOSThread()
+		return nil, PerfAffinityError
+	}
+	var set cpuSet
+	set[cpu/64] = 1 << uint(cpu%64)
+	err = schedAffinity(syscall.SYS_SCHED_SETAFFINITY, &set)
+	if err != nil {
+		runtime.UnlockOSThread()
+		return nil, PerfAffinityError
+	}
+
+	return func() {
+		schedAffinity(syscall.SYS_SCHED_SETAFFINITY, &old)
+		runtime.UnlockOSThread()
+	}, nil
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestPinToCPUInvalid(t *testing.T) {
+	for _, cpu := range []int{-1, 1024, 4096} {
+		if _, err := PinToCPU(cpu); err != PerfAffinityError {
+			t.Errorf("PinToCPU(%d) = %v, want %v", cpu, err, PerfAffinityError)
+		}
+	}
+}
+
+func TestPinToCPU(t *testing.T) {
+	var old unix.CPUSet
+	if err := unix.SchedGetaffinity(0, &old); err != nil {
+		t.Fatal(err)
+	}
+	for cpu := 0; cpu < 1024; cpu++ {
+		if !old.IsSet(cpu) {
+			continue
+		}
+		unpin, err := PinToCPU(cpu)
+		if err != nil {
+			t.Fatalf("PinToCPU(%d) = %v", cpu, err)
+		}
+		var set unix.CPUSet
+		if err := unix.SchedGetaffinity(0, &set); err != nil {
+			t.Fatal(err)
+		}
+		if set.Count() != 1 || !set.IsSet(cpu) {
+			t.Errorf("PinToCPU(%d) pinned the thread to %v", cpu, set)
+		}
+		unpin()
+	}
+
+	// The thread got back its affinity.
+	var set unix.CPUSet
+	if err := unix.SchedGetaffinity(0, &set); err != nil {
+		t.Fatal(err)
+	}
+	if set != old {
+		t.Errorf("the affinity went from %v to %v", old, set)
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"errors"
+)
+
+var PerfFreqWithoutRate = errors.New("frequency sampling without a frequency")
+var PerfSampleFieldWithoutType = errors.New("sampling field set without its sample type")
+var PerfStackUserAlignment = errors.New("user stack dump size not a multiple of 8")
+var PerfUnknownReadFormat = errors.New("unknown read format bits")
+
+// Read format bits known of, see readformat.go.
+const perfFormatMask = PERF_FORMAT_LOST<<1 - 1
+
+// Validate checks the consistency of the attributes before they are
+// passed to the kernel, which would only tell EINVAL otherwise :
+// - the size is the size of an ABI version, see SetSize
+// - a frequency is set along with the FREQ bit
+// - the user registers, user stack dump, interrupt registers and branch
+// filter are only set along with their sample type
+// - the user stack dump size is a multiple of 8
+// - the branch sample type is valid, see SampleOptions.BranchSampleType
+// - the read format only has known bits
+func (eventAttr PerfEventAttr) Validate() error {
+	err := checkAttrSize(eventAttr.Size)
+	if err != nil {
+		return err
+	}
+	if eventAttr.Bits&(1<<FREQ) != 0 && eventAttr.Sample == 0 {
+		return PerfFreqWithoutRate
+	}
+
+	sampleFields := []struct {
+		set        bool
+		sampleType uint64
+	}{
+		{eventAttr.Sample_regs_user != 0, PERF_SAMPLE_REGS_USER},
+		{eventAttr.Sample_stack_user != 0, PERF_SAMPLE_STACK_USER},
+		{eventAttr.Sample_regs_intr != 0, PERF_SAMPLE_REGS_INTR},
+		{eventAttr.Branch_sample_type != 0, PERF_SAMPLE_BRANCH_STACK},
+	}
+	for _, field := range sampleFields {
+		if field.set && eventAttr.Sample_type&field.sampleType == 0 {
+			return PerfSampleFieldWithoutType
+		}
+	}
+	if eventAttr.Sample_stack_user%8 != 0 {
+		return PerfStackUserAlignment
+	}
+
+	if eventAttr.Branch_sample_type != 0 {
+		err := checkBranchSampleType(eventAttr.Branch_sample_type)
+		if err != nil {
+			return err
+		}
+	}
+
+	if eventAttr.Read_format&^perfFormatMask != 0 {
+		return PerfUnknownReadFormat
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"testing"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// The attributes are laid out as struct perf_event_attr of
+// linux/perf_event.h, which the kernel reads them as.
+func TestPerfEventAttrLayout(t *testing.T) {
+	var attr PerfEventAttr
+	fields := []struct {
+		name   string
+		offset uintptr
+		want   uintptr
+	}{
+		{"type", unsafe.Offsetof(attr.Type), 0},
+		{"size", unsafe.Offsetof(attr.Size), 4},
+		{"config", unsafe.Offsetof(attr.Config), 8},
+		{"sample_period", unsafe.Offsetof(attr.Sample), 16},
+		{"sample_type", unsafe.Offsetof(attr.Sample_type), 24},
+		{"read_format", unsafe.Offsetof(attr.Read_format), 32},
+		{"bit fields", unsafe.Offsetof(attr.Bits), 40},
+		{"wakeup_events", unsafe.Offsetof(attr.Wakeup), 48},
+		{"bp_type", unsafe.Offsetof(attr.Bp_type), 52},
+		{"config1", unsafe.Offsetof(attr.Ext1), 56},
+		{"config2", unsafe.Offsetof(attr.Ext2), 64},
+		{"branch_sample_type", unsafe.Offsetof(attr.Branch_sample_type), 72},
+		{"sample_regs_user", unsafe.Offsetof(attr.Sample_regs_user), 80},
+		{"sample_stack_user", unsafe.Offsetof(attr.Sample_stack_user), 88},
+		{"clockid", unsafe.Offsetof(attr.Clockid), 92},
+		{"sample_regs_intr", unsafe.Offsetof(attr.Sample_regs_intr), 96},
+		{"aux_watermark", unsafe.Offsetof(attr.Aux_watermark), 104},
+		{"sample_max_stack", unsafe.Offsetof(attr.Sample_max_stack), 108},
+		{"aux_sample_size", unsafe.Offsetof(attr.Aux_sample_size), 112},
+		{"sig_data", unsafe.Offsetof(attr.Sig_data), 120},
+	}
+	for _, f := range fields {
+		if f.offset != f.want {
+			t.Errorf("%s at offset %d, want %d", f.name, f.offset, f.want)
+		}
+	}
+
+	size := unsafe.Sizeof(attr)
+	if size != unsafe.Sizeof(unix.PerfEventAttr{}) {
+		t.Errorf("PerfEventAttr is %d bytes, unix.PerfEventAttr %d", size, unsafe.Sizeof(unix.PerfEventAttr{}))
+	}
+	if err := checkAttrSize(uint32(size)); err != nil {
+		t.Errorf("PerfEventAttr is %d bytes, not the size of an ABI version", size)
+	}
+	if eventAttr := setupPerfEventAttr(EventConfigType{PERF_TYPE_SOFTWARE, 0}); uintptr(eventAttr.Size) != size {
+		t.Errorf("attributes set up with size %d, want %d", eventAttr.Size, size)
+	}
+}
+
+// The bits of the bit fields are those of linux/perf_event.h, as
+// golang.org/x/sys/unix defines them.
+func TestPerfEventAttrBits(t *testing.T) {
+	bits := []struct {
+		name string
+		bit  uint
+		want uint64
+	}{
+		{"disabled", DISABLED, unix.PerfBitDisabled},
+		{"inherit", INHERIT, unix.PerfBitInherit},
+		{"pinned", PINNED, unix.PerfBitPinned},
+		{"exclusive", EXCLUSIVE, unix.PerfBitExclusive},
+		{"exclude_user", EXCLUDE_USER, unix.PerfBitExcludeUser},
+		{"exclude_kernel", EXCLUDE_KERNEL, unix.PerfBitExcludeKernel},
+		{"exclude_hv", EXCLUDE_HV, unix.PerfBitExcludeHv},
+		{"exclude_idle", EXCLUDE_IDLE, unix.PerfBitExcludeIdle},
+		{"mmap", MMAP, unix.PerfBitMmap},
+		{"comm", COMM, unix.PerfBitComm},
+		{"freq", FREQ, unix.PerfBitFreq},
+		{"inherit_stat", INHERIT_STAT, unix.PerfBitInheritStat},
+		{"enable_on_exec", ENABLE_ON_EXEC, unix.PerfBitEnableOnExec},
+		{"task", TASK, unix.PerfBitTask},
+		{"watermark", WATERMARK, unix.PerfBitWatermark},
+		{"precise_ip", PRECISE_IP1, unix.PerfBitPreciseIPBit1},
+		{"precise_ip", PRECISE_IP2, unix.PerfBitPreciseIPBit2},
+		{"mmap_data", MMAP_DATA, unix.PerfBitMmapData},
+		{"sample_id_all", SAMPLE_ID_ALL, unix.PerfBitSampleIDAll},
+		{"exclude_host", EXCLUDE_HOST, unix.PerfBitExcludeHost},
+		{"exclude_guest", EXCLUDE_GUEST, unix.PerfBitExcludeGuest},
+		{"exclude_callchain_kernel", EXCLUDE_CALLCHAIN_KERNEL, unix.PerfBitExcludeCallchainKernel},
+		{"exclude_callchain_user", EXCLUDE_CALLCHAIN_USER, unix.PerfBitExcludeCallchainUser},
+		{"mmap2", MMAP2, unix.PerfBitMmap2},
+		{"comm_exec", COMM_EXEC, unix.PerfBitCommExec},
+		{"use_clockid", USE_CLOCKID, unix.PerfBitUseClockID},
+		{"context_switch", CONTEXT_SWITCH, unix.PerfBitContextSwitch},
+	}
+	for _, b := range bits {
+		if 1<<b.bit != b.want {
+			t.Errorf("%s is bit %d, want %#x", b.name, b.bit, b.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := setupPerfEventAttr(EventConfigType{PERF_TYPE_HARDWARE, PERF_HW_CPU_CYCLES})
+	tests := []struct {
+		name string
+		set  func(*PerfEventAttr)
+		err  error
+	}{
+		{"default", func(a *PerfEventAttr) {}, nil},
+		{"bad size", func(a *PerfEventAttr) { a.Size = 100 }, PerfInvalidAttrSize},
+		{"no size", func(a *PerfEventAttr) { a.Size = 0 }, PerfInvalidAttrSize},
+		{"freq", func(a *PerfEventAttr) { a.Bits |= 1 << FREQ; a.Sample = 1000 }, nil},
+		{"freq without rate", func(a *PerfEventAttr) { a.Bits |= 1 << FREQ }, PerfFreqWithoutRate},
+		{"period", func(a *PerfEventAttr) { a.Sample = 1000 }, nil},
+		{"user regs", func(a *PerfEventAttr) {
+			a.Sample_type = PERF_SAMPLE_REGS_USER
+			a.Sample_regs_user = 0xff
+		}, nil},
+		{"user regs without sample type", func(a *PerfEventAttr) { a.Sample_regs_user = 0xff }, PerfSampleFieldWithoutType},
+		{"user stack", func(a *PerfEventAttr) {
+			a.Sample_type = PERF_SAMPLE_STACK_USER
+			a.Sample_stack_user = 8192
+		}, nil},
+		{"user stack without sample type", func(a *PerfEventAttr) { a.Sample_stack_user = 8192 }, PerfSampleFieldWithoutType},
+		{"unaligned user stack", func(a *PerfEventAttr) {
+			a.Sample_type = PERF_SAMPLE_STACK_USER
+			a.Sample_stack_user = 100
+		}, PerfStackUserAlignment},
+		{"intr regs without sample type", func(a *PerfEventAttr) { a.Sample_regs_intr = 1 }, PerfSampleFieldWithoutType},
+		{"branch stack", func(a *PerfEventAttr) {
+			a.Sample_type = PERF_SAMPLE_BRANCH_STACK
+			a.Branch_sample_type = PERF_SAMPLE_BRANCH_ANY_CALL | PERF_SAMPLE_BRANCH_USER
+		}, nil},
+		{"branch stack without sample type", func(a *PerfEventAttr) {
+			a.Branch_sample_type = PERF_SAMPLE_BRANCH_ANY_CALL
+		}, PerfSampleFieldWithoutType},
+		{"read format", func(a *PerfEventAttr) { a.Read_format |= PERF_FORMAT_ID | PERF_FORMAT_LOST }, nil},
+		{"unknown read format", func(a *PerfEventAttr) { a.Read_format |= 1 << 10 }, PerfUnknownReadFormat},
+	}
+	for _, tt := range tests {
+		eventAttr := valid
+		tt.set(&eventAttr)
+		if err := eventAttr.Validate(); err != tt.err {
+			t.Errorf("%s: Validate() = %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+// The attributes are validated before the syscall.
+func TestOpenEventInvalid(t *testing.T) {
+	eventAttr := setupPerfEventAttr(EventConfigType{PERF_TYPE_SOFTWARE, PERF_COUNT_SW_TASK_CLOCK})
+	eventAttr.Bits |= 1 << FREQ
+	event := PerfEventInfo{Fd: -1}
+	if err := event.OpenEvent(eventAttr, 0, -1, -1, 0); err != PerfFreqWithoutRate {
+		t.Errorf("OpenEvent() = %v, want %v", err, PerfFreqWithoutRate)
+	}
+	if event.Fd != -1 {
+		t.Errorf("OpenEvent() set Fd to %d", event.Fd)
+	}
+}
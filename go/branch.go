@@ -0,0 +1,102 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"errors"
+)
+
+// Bits for the PerfEventAttr.Branch_sample_type value derived from
+// linux/perf_event.h
+// The privilege bits select the levels of the branches recorded, the
+// other bits their kinds.
+const (
+	PERF_SAMPLE_BRANCH_USER       = 1 << 0
+	PERF_SAMPLE_BRANCH_KERNEL     = 1 << 1
+	PERF_SAMPLE_BRANCH_HV         = 1 << 2
+	PERF_SAMPLE_BRANCH_ANY        = 1 << 3
+	PERF_SAMPLE_BRANCH_ANY_CALL   = 1 << 4
+	PERF_SAMPLE_BRANCH_ANY_RETURN = 1 << 5
+	PERF_SAMPLE_BRANCH_IND_CALL   = 1 << 6
+	PERF_SAMPLE_BRANCH_ABORT_TX   = 1 << 7
+	PERF_SAMPLE_BRANCH_IN_TX      = 1 << 8
+	PERF_SAMPLE_BRANCH_NO_TX      = 1 << 9
+	PERF_SAMPLE_BRANCH_COND       = 1 << 10
+	PERF_SAMPLE_BRANCH_CALL_STACK = 1 << 11
+	PERF_SAMPLE_BRANCH_IND_JUMP   = 1 << 12
+	PERF_SAMPLE_BRANCH_CALL       = 1 << 13
+	PERF_SAMPLE_BRANCH_NO_FLAGS   = 1 << 14
+	PERF_SAMPLE_BRANCH_NO_CYCLES  = 1 << 15
+	PERF_SAMPLE_BRANCH_TYPE_SAVE  = 1 << 16
+	PERF_SAMPLE_BRANCH_HW_INDEX   = 1 << 17
+)
+
+// PERF_SAMPLE_BRANCH_CALL_RETURN selects the call and return branches
+// only, e.g. to rebuild the call graph from the LBR.
+const PERF_SAMPLE_BRANCH_CALL_RETURN = PERF_SAMPLE_BRANCH_ANY_CALL | PERF_SAMPLE_BRANCH_ANY_RETURN
+
+var PerfInvalidBranchSampleType = errors.New("invalid branch sample type")
+
+// Branch sample type bits known of, and the privilege ones.
+const (
+	branchSampleMask = PERF_SAMPLE_BRANCH_HW_INDEX<<1 - 1
+	branchPrivMask   = PERF_SAMPLE_BRANCH_USER | PERF_SAMPLE_BRANCH_KERNEL | PERF_SAMPLE_BRANCH_HV
+)
+
+// checkBranchSampleType checks that the branch sample type only has
+// known bits, and selects some kind of branches as the kernel requires,
+// the privilege bits alone selecting none. Whether the PMU supports the
+// type is only told when opening the event.
+func checkBranchSampleType(branchSampleType uint64) error {
+	if branchSampleType&^branchSampleMask != 0 {
+		return PerfInvalidBranchSampleType
+	}
+	if branchSampleType&^branchPrivMask == 0 {
+		return PerfInvalidBranchSampleType
+	}
+	return nil
+}
+
+// BranchEntry is a branch of the branch stack of a sample.
+// From, To : addresses of the branch instruction and of its target.
+// Mispred, Predicted : whether the branch was mispredicted, or predicted.
+// InTx, Abort : whether the branch was in a transaction, or aborted it.
+// Cycles : cycles since the previous branch, 0 if unknown.
+// Type : kind of the branch, with PERF_SAMPLE_BRANCH_TYPE_SAVE.
+type BranchEntry struct {
+	From      uint64
+	To        uint64
+	Mispred   bool
+	Predicted bool
+	InTx      bool
+	Abort     bool
+	Cycles    uint16
+	Type      uint8
+}
+
+// branchStack decodes the branch stack of a sample of an event with the
+// branch sample type "branchSampleType".
+func (d *recordDecoder) branchStack(sample *SampleRecord, branchSampleType uint64) {
+	nr := d.u64()
+	if branchSampleType&PERF_SAMPLE_BRANCH_HW_INDEX != 0 {
+		sample.BranchHwIndex = int64(d.u64())
+	}
+	if d.err != nil || nr > uint64(len(d.buf)-d.off)/24 {
+		d.err = PerfShortRecord
+		return
+	}
+	sample.BranchStack = make([]BranchEntry, nr)
+	for i := range sample.BranchStack {
+		entry := &sample.BranchStack[i]
+		entry.From = d.u64()
+		entry.To = d.u64()
+		flags := d.u64()
+		entry.Mispred = flags&(1<<0) != 0
+		entry.Predicted = flags&(1<<1) != 0
+		entry.InTx = flags&(1<<2) != 0
+		entry.Abort = flags&(1<<3) != 0
+		entry.Cycles = uint16(flags >> 4)
+		entry.Type = uint8(flags>>20) & 0xf
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCheckBranchSampleType(t *testing.T) {
+	tests := []struct {
+		branchSampleType uint64
+		err              error
+	}{
+		{PERF_SAMPLE_BRANCH_ANY, nil},
+		{PERF_SAMPLE_BRANCH_ANY | PERF_SAMPLE_BRANCH_USER, nil},
+		{PERF_SAMPLE_BRANCH_CALL_RETURN | PERF_SAMPLE_BRANCH_USER | PERF_SAMPLE_BRANCH_KERNEL, nil},
+		{PERF_SAMPLE_BRANCH_CALL_STACK | PERF_SAMPLE_BRANCH_HW_INDEX, nil},
+		{PERF_SAMPLE_BRANCH_USER, PerfInvalidBranchSampleType},
+		{PERF_SAMPLE_BRANCH_USER | PERF_SAMPLE_BRANCH_KERNEL | PERF_SAMPLE_BRANCH_HV, PerfInvalidBranchSampleType},
+		{PERF_SAMPLE_BRANCH_ANY | PERF_SAMPLE_BRANCH_HW_INDEX<<1, PerfInvalidBranchSampleType},
+	}
+	for _, tt := range tests {
+		if err := checkBranchSampleType(tt.branchSampleType); err != tt.err {
+			t.Errorf("checkBranchSampleType(%#x) = %v, want %v", tt.branchSampleType, err, tt.err)
+		}
+	}
+}
+
+func TestSampleBranchOptions(t *testing.T) {
+	eventAttr := setupPerfEventAttr(EventConfigType{PERF_TYPE_HARDWARE, PERF_HW_CPU_CYCLES})
+	opts := SampleOptions{SamplePeriod: 1000, BranchSampleType: PERF_SAMPLE_BRANCH_CALL_RETURN | PERF_SAMPLE_BRANCH_USER}
+	if err := eventAttr.SetSampleOptions(opts); err != nil {
+		t.Fatal(err)
+	}
+	if eventAttr.Sample_type&PERF_SAMPLE_BRANCH_STACK == 0 || eventAttr.Branch_sample_type != opts.BranchSampleType {
+		t.Errorf("sample type %#x, branch sample type %#x", eventAttr.Sample_type, eventAttr.Branch_sample_type)
+	}
+}
+
+// branchFlags lays out the flags of a branch entry.
+func branchFlags(mispred, predicted, inTx, abort bool, cycles uint16, branchType uint8) uint64 {
+	var flags uint64
+	for i, set := range []bool{mispred, predicted, inTx, abort} {
+		if set {
+			flags |= 1 << uint(i)
+		}
+	}
+	return flags | uint64(cycles)<<4 | uint64(branchType)<<20
+}
+
+func TestDecodeBranchStack(t *testing.T) {
+	want := []BranchEntry{
+		{From: 0x401000, To: 0x402000, Predicted: true, Cycles: 12, Type: 1},
+		{From: 0x402010, To: 0x401004, Mispred: true, Cycles: 0xffff, Type: 2},
+		{From: 0x403000, To: 0x403100, InTx: true, Abort: true},
+	}
+	entries := new(recordBuilder).
+		u64(0x401000, 0x402000, branchFlags(false, true, false, false, 12, 1)).
+		u64(0x402010, 0x401004, branchFlags(true, false, false, false, 0xffff, 2)).
+		u64(0x403000, 0x403100, branchFlags(false, false, true, true, 0, 0)).buf
+
+	eventAttr := sampleAttr(PERF_SAMPLE_IP | PERF_SAMPLE_BRANCH_STACK)
+	eventAttr.Branch_sample_type = PERF_SAMPLE_BRANCH_ANY
+	buf := new(recordBuilder).u64(0x401000, 3).bytes(entries).buf
+	sample, err := DecodeSample(buf, eventAttr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(sample.BranchStack, want) || sample.BranchHwIndex != 0 {
+		t.Errorf("DecodeSample() branches %+v, index %d, want %+v", sample.BranchStack, sample.BranchHwIndex, want)
+	}
+	if _, err := DecodeSample(buf[:len(buf)-8], eventAttr); err != PerfShortRecord {
+		t.Errorf("DecodeSample() of a short branch stack = %v, want %v", err, PerfShortRecord)
+	}
+
+	// The index of the most recent branch comes before the entries.
+	eventAttr.Branch_sample_type |= PERF_SAMPLE_BRANCH_HW_INDEX
+	buf = new(recordBuilder).u64(0x401000, 3, ^uint64(0)).bytes(entries).buf
+	sample, err = DecodeSample(buf, eventAttr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(sample.BranchStack, want) || sample.BranchHwIndex != -1 {
+		t.Errorf("DecodeSample() branches %+v, index %d, want %+v, -1", sample.BranchStack, sample.BranchHwIndex, want)
+	}
+
+	// The number of entries is checked before allocating them.
+	buf = new(recordBuilder).u64(0x401000, 1<<60).buf
+	if _, err := DecodeSample(buf, eventAttr); err != PerfShortRecord {
+		t.Errorf("DecodeSample() of a huge branch stack = %v, want %v", err, PerfShortRecord)
+	}
+}
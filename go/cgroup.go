@@ -0,0 +1,149 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// The cgroups are relative to the mount point of the perf_event
+// controller of cgroup v1, if mounted, e.g. on the hosts with both cgroup
+// versions, or of the cgroup v2 hierarchy, as found in procMountsPath,
+// unless cgroupRoot is set.
+var cgroupRoot = ""
+var procMountsPath = "/proc/mounts"
+
+// Mount point of the cgroups when procMountsPath doesn't tell.
+const defaultCgroupRoot = "/sys/fs/cgroup"
+
+var PerfCgroupError = errors.New("couldn't open cgroup")
+
+// cgroupMountPoint returns the directory the cgroups are relative to.
+func cgroupMountPoint() string {
+	if cgroupRoot != "" {
+		return cgroupRoot
+	}
+	mounts, err := ioutil.ReadFile(procMountsPath)
+	if err != nil {
+		return defaultCgroupRoot
+	}
+	v2 := ""
+	for _, line := range strings.Split(string(mounts), "\n") {
+		// e.g. "cgroup /sys/fs/cgroup/perf_event cgroup rw,perf_event 0 0"
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			continue
+		}
+		switch fields[2] {
+		case "cgroup":
+			for _, option := range strings.Split(fields[3], ",") {
+				if option == "perf_event" {
+					return fields[1]
+				}
+			}
+		case "cgroup2":
+			if v2 == "" {
+				v2 = fields[1]
+			}
+		}
+	}
+	if v2 != "" {
+		return v2
+	}
+	return defaultCgroupRoot
+}
+
+// openCgroup opens the directory of the cgroup "cgroupPath", either
+// absolute or relative to the mount point of the cgroups, see
+// cgroupRoot, e.g. "system.slice/foo.service".
+func openCgroup(cgroupPath string) (int, error) {
+	if !filepath.IsAbs(cgroupPath) {
+		cgroupPath = filepath.Join(cgroupMountPoint(), cgroupPath)
+	}
+	fd, err := syscall.Open(cgroupPath, syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return -1, PerfCgroupError
+	}
+	return fd, nil
+}
+
+// InitOpenEventsEnableCgroup opens, enables the events in "events" on
+// each online CPU for the cgroup "cgroupPath", either absolute or
+// relative to the mount point of the cgroups, e.g. /sys/fs/cgroup or
+// /sys/fs/cgroup/perf_event for cgroup v1, e.g. the cgroup of a
+// container. The events count all the processes of the cgroup, while
+// they run. This needs a perf_event_paranoid level of 0 at most, or
+// CAP_PERFMON.
+// It returns the same as InitOpenEventsEnableSelf, with one event
+// descriptor per event and CPU. SumEvents gives the cgroup wide counts.
+func InitOpenEventsEnableCgroup(events string, cgroupPath string) (error, []string, []PerfEventInfo) {
+	cpus, err := readCPUList(sysfsCPUOnlinePath)
+	if err != nil {
+		return err, nil, nil
+	}
+	cgroupFd, err := openCgroup(cgroupPath)
+	if err != nil {
+		return err, nil, nil
+	}
+	// The events keep a reference on the cgroup, its directory is not
+	// needed once they are open.
+	defer syscall.Close(cgroupFd)
+
+	opts := EventOptions{Flags: PERF_FLAG_PID_CGROUP}
+	eventListNA := make([]string, 0)
+	eventDescs := make([]PerfEventInfo, 0)
+	failErr := PerfUnsupportedEvent
+	for _, cpu := range cpus {
+		err, cpuListNA, cpuDescs := initOpenEventsEnable(events, cgroupFd, cpu, opts)
+		if err != nil {
+			if err == PerfPermissionError {
+				failErr = err
+			}
+			for _, name := range cpuListNA {
+				eventListNA = append(eventListNA, name+"@cpu"+strconv.Itoa(cpu))
+			}
+		}
+		eventDescs = append(eventDescs, cpuDescs...)
+	}
+
+	if len(eventListNA) != 0 {
+		return failErr, eventListNA, eventDescs
+	}
+	return nil, eventListNA, eventDescs
+}
+
+var PerfOfflineCPU = errors.New("CPU not online")
+
+// InitOpenEventEnableCgroupCPU opens, enables the event "eventName" on the
+// CPU "cpu" for the cgroup "cgroupPath", as InitOpenEventsEnableCgroup
+// does. The event counts the processes of the cgroup only while they run
+// on the CPU, e.g. to tell the share of a CPU a container gets.
+func (event *PerfEventInfo) InitOpenEventEnableCgroupCPU(eventName string, cgroupPath string, cpu int) error {
+	cpus, err := readCPUList(sysfsCPUOnlinePath)
+	if err != nil {
+		return err
+	}
+	online := false
+	for _, c := range cpus {
+		if c == cpu {
+			online = true
+			break
+		}
+	}
+	if !online {
+		return PerfOfflineCPU
+	}
+	cgroupFd, err := openCgroup(cgroupPath)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(cgroupFd)
+
+	return event.initOpenEventEnable(eventName, cgroupFd, cpu, -1, EventOptions{Flags: PERF_FLAG_PID_CGROUP})
+}
@@ -0,0 +1,174 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fakeMounts points procMountsPath to a file holding "mounts", or to a
+// missing file if empty, and clears cgroupRoot for the time of the test.
+func fakeMounts(t *testing.T, mounts string) {
+	path := filepath.Join(t.TempDir(), "mounts")
+	if mounts != "" {
+		if err := ioutil.WriteFile(path, []byte(mounts), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mountsPath, root := procMountsPath, cgroupRoot
+	procMountsPath, cgroupRoot = path, ""
+	t.Cleanup(func() { procMountsPath, cgroupRoot = mountsPath, root })
+}
+
+func TestCgroupMountPoint(t *testing.T) {
+	tests := []struct {
+		name   string
+		mounts string
+		want   string
+	}{
+		{"v2", "sysfs /sys sysfs rw 0 0\ncgroup2 /sys/fs/cgroup cgroup2 rw,nosuid 0 0\n", "/sys/fs/cgroup"},
+		{"v1", "cgroup /sys/fs/cgroup/cpu cgroup rw,cpu 0 0\n" +
+			"cgroup /sys/fs/cgroup/perf_event cgroup rw,relatime,perf_event 0 0\n", "/sys/fs/cgroup/perf_event"},
+		{"v1 co-mounted", "cgroup /sys/fs/cgroup/cpu,perf_event cgroup rw,cpu,perf_event 0 0\n",
+			"/sys/fs/cgroup/cpu,perf_event"},
+		{"hybrid", "cgroup2 /sys/fs/cgroup/unified cgroup2 rw 0 0\n" +
+			"cgroup /sys/fs/cgroup/perf_event cgroup rw,perf_event 0 0\n", "/sys/fs/cgroup/perf_event"},
+		{"hybrid without perf_event", "cgroup2 /sys/fs/cgroup/unified cgroup2 rw 0 0\n" +
+			"cgroup /sys/fs/cgroup/cpu cgroup rw,cpu 0 0\n", "/sys/fs/cgroup/unified"},
+		{"two v2 mounts", "cgroup2 /sys/fs/cgroup cgroup2 rw 0 0\ncgroup2 /mnt/cgroup cgroup2 rw 0 0\n",
+			"/sys/fs/cgroup"},
+		{"perf_event named cgroup", "cgroup /mnt/perf_event cgroup rw,name=perf_event 0 0\n", defaultCgroupRoot},
+		{"no cgroup", "proc /proc proc rw 0 0\nshort line\n", defaultCgroupRoot},
+		{"no mounts", "", defaultCgroupRoot},
+	}
+	for _, tt := range tests {
+		fakeMounts(t, tt.mounts)
+		if got := cgroupMountPoint(); got != tt.want {
+			t.Errorf("%s: cgroupMountPoint() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	// cgroupRoot wins over the mounts.
+	fakeMounts(t, "cgroup2 /sys/fs/cgroup cgroup2 rw 0 0\n")
+	cgroupRoot = "/mnt/cgroup"
+	if got := cgroupMountPoint(); got != "/mnt/cgroup" {
+		t.Errorf("cgroupMountPoint() = %q, want cgroupRoot", got)
+	}
+}
+
+func TestOpenCgroup(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "system.slice"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "cgroup.procs"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	fakeMounts(t, "")
+	cgroupRoot = dir
+
+	tests := []struct {
+		path string
+		ok   bool
+	}{
+		{"system.slice", true},
+		{"/system.slice", false},
+		{filepath.Join(dir, "system.slice"), true},
+		{"", true},
+		{"missing.slice", false},
+		// Not a directory.
+		{"cgroup.procs", false},
+	}
+	for _, tt := range tests {
+		fd, err := openCgroup(tt.path)
+		if (err == nil) != tt.ok || !tt.ok && (err != PerfCgroupError || fd != -1) {
+			t.Errorf("openCgroup(%q) = %d, %v", tt.path, fd, err)
+		}
+		if err == nil {
+			syscall.Close(fd)
+		}
+	}
+}
+
+// busyLoop keeps the calling thread on the CPU for "d".
+func busyLoop(d time.Duration) {
+	for start := time.Now(); time.Since(start) < d; {
+	}
+}
+
+func TestInitOpenEventsEnableCgroup(t *testing.T) {
+	if err, _, _ := InitOpenEventsEnableCgroup("cpu-clock", "no/such/cgroup"); err != PerfCgroupError {
+		t.Errorf("InitOpenEventsEnableCgroup() = %v, want %v", err, PerfCgroupError)
+	}
+
+	// All the processes are in the root cgroup, the test included.
+	err, eventListNA, eventsInfo := InitOpenEventsEnableCgroup("cpu-clock", "")
+	defer EventsDisableClose(eventsInfo)
+	if err != nil {
+		t.Skipf("can't open %v: %v", eventListNA, err)
+	}
+	cpus, err := readCPUList(sysfsCPUOnlinePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(eventsInfo) != len(cpus) {
+		t.Fatalf("opened %d events, want one per CPU of %v", len(eventsInfo), cpus)
+	}
+	busyLoop(10 * time.Millisecond)
+	for i := range eventsInfo {
+		if err := eventsInfo[i].ReadEvent(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if sums := SumEvents(eventsInfo); sums["cpu-clock"] < uint64(10*time.Millisecond) {
+		t.Errorf("SumEvents() = %v, want the time the test ran at least", sums)
+	}
+}
+
+func TestInitOpenEventEnableCgroupCPU(t *testing.T) {
+	cpus, err := readCPUList(sysfsCPUOnlinePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		cpu int
+		err error
+	}{
+		{-1, PerfOfflineCPU},
+		{cpus[len(cpus)-1] + 1, PerfOfflineCPU},
+	}
+	for _, tt := range tests {
+		event := PerfEventInfo{Fd: -1}
+		if err := event.InitOpenEventEnableCgroupCPU("cpu-clock", "", tt.cpu); err != tt.err {
+			t.Errorf("InitOpenEventEnableCgroupCPU() on CPU %d = %v, want %v", tt.cpu, err, tt.err)
+		}
+	}
+	event := PerfEventInfo{Fd: -1}
+	if err := event.InitOpenEventEnableCgroupCPU("cpu-clock", "no/such/cgroup", cpus[0]); err != PerfCgroupError {
+		t.Errorf("InitOpenEventEnableCgroupCPU() = %v, want %v", err, PerfCgroupError)
+	}
+
+	// The root cgroup on the CPU the test is pinned to.
+	unpin, err := PinToCPU(cpus[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unpin()
+	if err := event.InitOpenEventEnableCgroupCPU("cpu-clock", "", cpus[0]); err != nil {
+		t.Skipf("can't open cpu-clock on CPU %d: %v", cpus[0], err)
+	}
+	defer event.DisableClose()
+	busyLoop(10 * time.Millisecond)
+	if err := event.ReadEvent(); err != nil {
+		t.Fatal(err)
+	}
+	if event.Data < uint64(10*time.Millisecond) {
+		t.Errorf("counted %v on CPU %d, want the time the test ran at least", time.Duration(event.Data), cpus[0])
+	}
+}
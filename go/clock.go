@@ -0,0 +1,56 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the time to the features of the package depending on it,
+// e.g. EventRotation, ScheduleWindows and LastRead, so that tests can run
+// them with a fake clock rather than with the real time.
+// Now : current time.
+// After : channel receiving the current time once "d" has elapsed.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// realClock is the real time.
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// RealClock is the clock of the real time, the default one.
+var RealClock Clock = realClock{}
+
+var clock = struct {
+	sync.Mutex
+	c Clock
+}{c: RealClock}
+
+// SetClock sets the clock of the package, nil for RealClock, e.g. to a
+// fake clock in a test.
+func SetClock(c Clock) {
+	if c == nil {
+		c = RealClock
+	}
+	clock.Lock()
+	clock.c = c
+	clock.Unlock()
+}
+
+// clockNow returns the current time of the clock of the package.
+func clockNow() time.Time {
+	return currentClock().Now()
+}
+
+// currentClock returns the clock of the package.
+func currentClock() Clock {
+	clock.Lock()
+	defer clock.Unlock()
+	return clock.c
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock the time of which only moves on Advance.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []fakeTimer
+}
+
+type fakeTimer struct {
+	at time.Time
+	c  chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	timer := fakeTimer{c.now.Add(d), make(chan time.Time, 1)}
+	c.timers = append(c.timers, timer)
+	return timer.c
+}
+
+// Advance moves the time by "d", firing the timers due by then.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	pending := c.timers[:0]
+	for _, timer := range c.timers {
+		if timer.at.After(c.now) {
+			pending = append(pending, timer)
+			continue
+		}
+		timer.c <- c.now
+	}
+	c.timers = pending
+}
+
+// waitTimers waits for "n" timers to be pending, e.g. for a goroutine to
+// wait on the clock.
+func (c *fakeClock) waitTimers(t *testing.T, n int) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		c.mu.Lock()
+		pending := len(c.timers)
+		c.mu.Unlock()
+		if pending >= n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("%d timers not pending", n)
+}
+
+// useFakeClock sets the clock of the package to a fake clock until the
+// test is done.
+func useFakeClock(t *testing.T) *fakeClock {
+	c := newFakeClock()
+	SetClock(c)
+	t.Cleanup(func() { SetClock(nil) })
+	return c
+}
+
+func TestSetClock(t *testing.T) {
+	c := useFakeClock(t)
+	if !clockNow().Equal(c.Now()) {
+		t.Errorf("clockNow() = %v, want the fake %v", clockNow(), c.Now())
+	}
+	c.Advance(time.Hour)
+
+	var event PerfEventInfo
+	event.setValues(ReadFormat{Value: 1})
+	if !event.LastRead.Equal(c.Now()) {
+		t.Errorf("LastRead = %v, want %v", event.LastRead, c.Now())
+	}
+
+	select {
+	case <-currentClock().After(time.Minute):
+		t.Error("timer fired before the time moved")
+	default:
+	}
+
+	SetClock(nil)
+	if currentClock() != RealClock {
+		t.Errorf("SetClock(nil) set %v, want RealClock", currentClock())
+	}
+	if since := time.Since(clockNow()); since < 0 || since > time.Minute {
+		t.Errorf("real clock off by %v", since)
+	}
+}
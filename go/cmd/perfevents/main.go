@@ -0,0 +1,73 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+// Command perfevents counts perf events for a command, e.g. :
+//
+//	perfevents -e cpu-cycles,instructions ls -l
+//
+// It is a small sanity check of the perfevents package on a machine.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	perfevents "github.com/opentracing-contrib/perfevents/go"
+)
+
+func main() {
+	events := flag.String("e", "cpu-cycles,instructions", "comma separated list of events to count")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [-e events] command [args...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// The events count the calling thread and, as they are inherited,
+	// the command forked from it. The command must then be started from
+	// the same thread the events are opened on.
+	runtime.LockOSThread()
+
+	// The events are enabled by the kernel when the command is exec'ed,
+	// so that the counts don't include the work done by this process.
+	opts := perfevents.EventOptions{Inherit: true, EnableOnExec: true}
+	_, eventListNA, pds := perfevents.InitOpenEventsEnableSelfWithOptions(*events, opts)
+
+	cmd := exec.Command(flag.Arg(0), flag.Args()[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	runErr := cmd.Run()
+
+	err := perfevents.EventsRead(pds)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+
+	fmt.Fprintf(os.Stderr, "\n Performance counter stats for '%s':\n\n", strings.Join(flag.Args(), " "))
+	for _, pd := range pds {
+		fmt.Fprintf(os.Stderr, "%20s      %s\n", perfevents.FormatDataToString(pd), pd.EventName)
+	}
+	for _, name := range eventListNA {
+		fmt.Fprintf(os.Stderr, "%20s      %s\n", "<not supported>", name)
+	}
+	fmt.Fprintln(os.Stderr)
+
+	perfevents.EventsDisableClose(pds)
+
+	if runErr != nil {
+		if exitErr, ok := runErr.(*exec.ExitError); ok {
+			os.Exit(exitErr.ExitCode())
+		}
+		fmt.Fprintln(os.Stderr, runErr)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package main
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	perfevents "github.com/opentracing-contrib/perfevents/go"
+)
+
+// buildOrSkip builds the command, skipping the test if the events can't
+// be opened here, e.g. perf_event_open not being permitted.
+func buildOrSkip(t *testing.T, events string) string {
+	t.Helper()
+	err, eventListNA, pds := perfevents.InitOpenEventsEnableSelf(events)
+	perfevents.EventsDisableClose(pds)
+	if err != nil {
+		t.Skipf("can't open %v: %v", eventListNA, err)
+	}
+	if _, err := exec.LookPath("true"); err != nil {
+		t.Skip("no true command")
+	}
+
+	bin := filepath.Join(t.TempDir(), "perfevents")
+	out, err := exec.Command("go", "build", "-o", bin, ".").CombinedOutput()
+	if err != nil {
+		t.Fatalf("go build: %v\n%s", err, out)
+	}
+	return bin
+}
+
+func TestRun(t *testing.T) {
+	bin := buildOrSkip(t, "task-clock,context-switches")
+
+	out, err := exec.Command(bin, "-e", "task-clock,context-switches,not-an-event", "true").CombinedOutput()
+	if err != nil {
+		t.Fatalf("perfevents true: %v\n%s", err, out)
+	}
+	output := string(out)
+	for _, want := range []string{
+		"Performance counter stats for 'true':",
+		"task-clock",
+		"context-switches",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output lacks %q:\n%s", want, output)
+		}
+	}
+	if !strings.Contains(output, "<not supported>      not-an-event") {
+		t.Errorf("output doesn't tell not-an-event isn't supported:\n%s", output)
+	}
+
+	// true runs for a while, which task-clock tells in ns.
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[1] == "task-clock" && fields[0] == "0" {
+			t.Errorf("task-clock counted nothing:\n%s", output)
+		}
+	}
+}
+
+// The command exits with the status of the counted one.
+func TestRunExitCode(t *testing.T) {
+	bin := buildOrSkip(t, "task-clock")
+	if _, err := exec.LookPath("false"); err != nil {
+		t.Skip("no false command")
+	}
+
+	err := exec.Command(bin, "-e", "task-clock", "false").Run()
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok {
+		t.Fatalf("perfevents false: %v, want an exit error", err)
+	}
+	if exitErr.ExitCode() != 1 {
+		t.Errorf("perfevents false exited with %d, want 1", exitErr.ExitCode())
+	}
+}
+
+func TestUsage(t *testing.T) {
+	bin := filepath.Join(t.TempDir(), "perfevents")
+	out, err := exec.Command("go", "build", "-o", bin, ".").CombinedOutput()
+	if err != nil {
+		t.Fatalf("go build: %v\n%s", err, out)
+	}
+	out, err = exec.Command(bin).CombinedOutput()
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok || exitErr.ExitCode() != 2 {
+		t.Errorf("perfevents without a command: %v, want exit status 2", err)
+	}
+	if !strings.Contains(string(out), "usage:") {
+		t.Errorf("output lacks the usage:\n%s", out)
+	}
+}
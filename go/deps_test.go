@@ -0,0 +1,30 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// The core package has no tracing dependency, the OpenTracing observer
+// being in otobserver.
+func TestNoTracingDependency(t *testing.T) {
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go tool not found")
+	}
+	out, err := exec.Command(goTool, "list", "-deps", ".").CombinedOutput()
+	if err != nil {
+		t.Fatalf("go list -deps: %v\n%s", err, out)
+	}
+	for _, dep := range strings.Fields(string(out)) {
+		if strings.HasPrefix(dep, "github.com/opentracing/") ||
+			strings.HasPrefix(dep, "github.com/opentracing-contrib/go-observer") ||
+			strings.HasPrefix(dep, "go.opentelemetry.io/") {
+			t.Errorf("perfevents depends on %s", dep)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Markers of the callchains, telling the context of the frames which
+// follow (from linux/perf_event.h)
+const (
+	PERF_CONTEXT_HV           = ^uint64(32 - 1)
+	PERF_CONTEXT_KERNEL       = ^uint64(128 - 1)
+	PERF_CONTEXT_USER         = ^uint64(512 - 1)
+	PERF_CONTEXT_GUEST        = ^uint64(2048 - 1)
+	PERF_CONTEXT_GUEST_KERNEL = ^uint64(2176 - 1)
+	PERF_CONTEXT_GUEST_USER   = ^uint64(2560 - 1)
+	PERF_CONTEXT_MAX          = ^uint64(4095 - 1)
+)
+
+// FoldStacks folds the callchains of "samples" into the "folded" stacks
+// of flamegraph.pl, e.g. "main;foo;bar", the root frame first, along with
+// the number of samples of each stack. "symbolizer" names the frame of
+// an address, e.g. with the PERF_RECORD_MMAP2 records of the process and
+// the symbols of the mapped files, the address being used as is, in hex,
+// when it returns "" or is nil. A sample without a callchain is folded
+// as the frame of its IP. The context markers of the callchains are left
+// out. flamegraph.pl takes the stacks as "<stack> <count>" lines.
+func FoldStacks(samples []SampleRecord, symbolizer func(uint64) string) map[string]uint64 {
+	folded := make(map[string]uint64)
+	frames := make([]string, 0)
+	for _, sample := range samples {
+		callchain := sample.Callchain
+		if len(callchain) == 0 {
+			callchain = []uint64{sample.IP}
+		}
+		frames = frames[:0]
+		// The callchain goes from the leaf frame up.
+		for i := len(callchain) - 1; i >= 0; i-- {
+			addr := callchain[i]
+			if addr >= PERF_CONTEXT_MAX {
+				continue
+			}
+			name := ""
+			if symbolizer != nil {
+				name = symbolizer(addr)
+			}
+			if name == "" {
+				name = "0x" + strconv.FormatUint(addr, 16)
+			}
+			// ";" separates the frames.
+			frames = append(frames, strings.Replace(name, ";", ":", -1))
+		}
+		if len(frames) != 0 {
+			folded[strings.Join(frames, ";")]++
+		}
+	}
+	return folded
+}
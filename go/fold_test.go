@@ -0,0 +1,51 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFoldStacks(t *testing.T) {
+	symbols := map[uint64]string{
+		0x1000: "main",
+		0x2000: "foo",
+		0x3000: "bar",
+		0x4000: "baz;qux",
+	}
+	symbolizer := func(addr uint64) string { return symbols[addr] }
+
+	samples := []SampleRecord{
+		{Callchain: []uint64{PERF_CONTEXT_USER, 0x3000, 0x2000, 0x1000}},
+		{Callchain: []uint64{PERF_CONTEXT_USER, 0x3000, 0x2000, 0x1000}},
+		{Callchain: []uint64{PERF_CONTEXT_KERNEL, 0xffff0000, PERF_CONTEXT_USER, 0x2000, 0x1000}},
+		{Callchain: []uint64{0x4000, 0x1000}},
+		{IP: 0x2000},
+		{Callchain: []uint64{PERF_CONTEXT_USER}},
+	}
+	want := map[string]uint64{
+		"main;foo;bar":        2,
+		"main;foo;0xffff0000": 1,
+		"main;baz:qux":        1,
+		"foo":                 1,
+	}
+	if got := FoldStacks(samples, symbolizer); !reflect.DeepEqual(got, want) {
+		t.Errorf("FoldStacks() = %v, want %v", got, want)
+	}
+
+	want = map[string]uint64{
+		"0x1000;0x2000;0x3000":     2,
+		"0x1000;0x2000;0xffff0000": 1,
+		"0x1000;0x4000":            1,
+		"0x2000":                   1,
+	}
+	if got := FoldStacks(samples, nil); !reflect.DeepEqual(got, want) {
+		t.Errorf("FoldStacks() without symbolizer = %v, want %v", got, want)
+	}
+
+	if got := FoldStacks(nil, symbolizer); len(got) != 0 {
+		t.Errorf("FoldStacks() of no samples = %v", got)
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+// FormatOptions holds the options for formatting the counts of events,
+// which are plain decimal by default, whatever the locale.
+// Grouping : Group the digits of the counts by thousands, e.g.
+// "1,234,567".
+// GroupSeparator : Separator of the groups of digits, "," by default,
+// e.g. "." or " " to match a locale.
+type FormatOptions struct {
+	Grouping       bool
+	GroupSeparator string
+}
+
+// format formats the count "data" as per the options.
+func (opts FormatOptions) format(data uint64) string {
+	digits := strconv.FormatUint(data, 10)
+	if !opts.Grouping || len(digits) <= 3 {
+		return digits
+	}
+	sep := opts.GroupSeparator
+	if sep == "" {
+		sep = ","
+	}
+	first := len(digits) % 3
+	if first == 0 {
+		first = 3
+	}
+	s := digits[:first]
+	for i := first; i < len(digits); i += 3 {
+		s += sep + digits[i:i+3]
+	}
+	return s
+}
+
+// FormatDataJSON converts the counts of the events in "eventsInfo" to a
+// JSON object keyed by event name, e.g. {"cpu-cycles":1234}. The events
+// which failed, i.e., without a name, are left out.
+func FormatDataJSON(eventsInfo []PerfEventInfo) ([]byte, error) {
+	return FormatDataJSONOpts(eventsInfo, FormatOptions{})
+}
+
+// FormatDataJSONOpts is FormatDataJSON as per "opts", see FormatOptions.
+// Grouping the digits makes the counts strings, e.g.
+// {"cpu-cycles":"1,234"}.
+func FormatDataJSONOpts(eventsInfo []PerfEventInfo, opts FormatOptions) ([]byte, error) {
+	counts := make(map[string]interface{})
+	for _, event := range eventsInfo {
+		if event.EventName == "" {
+			continue
+		}
+		if opts.Grouping {
+			counts[event.EventName] = opts.format(event.Data)
+		} else {
+			counts[event.EventName] = event.Data
+		}
+	}
+	return json.Marshal(counts)
+}
@@ -0,0 +1,123 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormatDataToString(t *testing.T) {
+	// The function is also used as a value.
+	var format func(PerfEventInfo) string = FormatDataToString
+	tests := []struct {
+		data uint64
+		want string
+	}{
+		{0, "0"},
+		{1234567, "1234567"},
+		{1<<64 - 1, "18446744073709551615"},
+	}
+	for _, tt := range tests {
+		if got := format(PerfEventInfo{Data: tt.data}); got != tt.want {
+			t.Errorf("FormatDataToString(%d) = %q, want %q", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestFormatDataToStringOpts(t *testing.T) {
+	tests := []struct {
+		data uint64
+		opts FormatOptions
+		want string
+	}{
+		{1234567, FormatOptions{}, "1234567"},
+		{1234567, FormatOptions{GroupSeparator: "."}, "1234567"},
+		{0, FormatOptions{Grouping: true}, "0"},
+		{999, FormatOptions{Grouping: true}, "999"},
+		{1000, FormatOptions{Grouping: true}, "1,000"},
+		{123456, FormatOptions{Grouping: true}, "123,456"},
+		{1234567, FormatOptions{Grouping: true}, "1,234,567"},
+		{1234567, FormatOptions{Grouping: true, GroupSeparator: "."}, "1.234.567"},
+		{1234567, FormatOptions{Grouping: true, GroupSeparator: " "}, "1 234 567"},
+		{1<<64 - 1, FormatOptions{Grouping: true}, "18,446,744,073,709,551,615"},
+	}
+	for _, tt := range tests {
+		if got := FormatDataToStringOpts(PerfEventInfo{Data: tt.data}, tt.opts); got != tt.want {
+			t.Errorf("FormatDataToStringOpts(%d, %+v) = %q, want %q", tt.data, tt.opts, got, tt.want)
+		}
+	}
+}
+
+func TestFormatDataJSON(t *testing.T) {
+	events := []PerfEventInfo{
+		{EventName: "cpu-cycles", Data: 1234567},
+		{EventName: "instructions", Data: 12},
+		{Data: 42},
+	}
+	got, err := FormatDataJSON(events)
+	if want := `{"cpu-cycles":1234567,"instructions":12}`; err != nil || string(got) != want {
+		t.Errorf("FormatDataJSON() = %s, %v, want %s", got, err, want)
+	}
+
+	tests := []struct {
+		opts FormatOptions
+		want string
+	}{
+		{FormatOptions{}, `{"cpu-cycles":1234567,"instructions":12}`},
+		{FormatOptions{Grouping: true}, `{"cpu-cycles":"1,234,567","instructions":"12"}`},
+		{FormatOptions{Grouping: true, GroupSeparator: "'"}, `{"cpu-cycles":"1'234'567","instructions":"12"}`},
+	}
+	for _, tt := range tests {
+		got, err := FormatDataJSONOpts(events, tt.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("FormatDataJSONOpts(%+v) = %s, want %s", tt.opts, got, tt.want)
+		}
+	}
+}
+
+func TestFormatDataDetailed(t *testing.T) {
+	tests := []struct {
+		data, enabled, running uint64
+		want                   string
+	}{
+		{12345, 0, 0, "12345"},
+		{12345, 1000, 1000, "12345"},
+		{12345, 1000, 0, "12345"},
+		{12345, 1000, 750, "16460 (scaled x1.33, running 75%)"},
+		{100, 1000, 500, "200 (scaled x2.00, running 50%)"},
+		{0, 1000, 10, "0 (scaled x100.00, running 1%)"},
+	}
+	for _, tt := range tests {
+		pi := PerfEventInfo{Data: tt.data, TimeEnabled: tt.enabled, TimeRunning: tt.running}
+		if got := FormatDataDetailed(pi); got != tt.want {
+			t.Errorf("FormatDataDetailed(%d, %d/%d) = %q, want %q", tt.data, tt.running, tt.enabled, got, tt.want)
+		}
+	}
+}
+
+// The events are opened reading the times they were enabled and running,
+// which FormatDataDetailed scales the counts with.
+func TestFormatDataDetailedRead(t *testing.T) {
+	eventsInfo := openOrSkip(t, "task-clock", EventOptions{})
+	defer EventsDisableClose(eventsInfo)
+	// Run for a while, the times read right after enabling the event
+	// may still be 0.
+	for start := time.Now(); time.Since(start) < time.Millisecond; {
+	}
+	if err := eventsInfo[0].ReadEvent(); err != nil {
+		t.Fatal(err)
+	}
+	if eventsInfo[0].TimeEnabled == 0 || eventsInfo[0].TimeRunning == 0 {
+		t.Errorf("read enabled %d, running %d, want both set", eventsInfo[0].TimeEnabled, eventsInfo[0].TimeRunning)
+	}
+	if !eventsInfo[0].Multiplexed() {
+		if got, want := FormatDataDetailed(eventsInfo[0]), FormatDataToString(eventsInfo[0]); got != want {
+			t.Errorf("FormatDataDetailed() = %q without multiplexing, want %q", got, want)
+		}
+	}
+}
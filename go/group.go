@@ -0,0 +1,449 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+var PerfEventListSyntax = errors.New("syntax error in event list")
+
+// Named presets of event lists, usable in place of an event in an event
+// list, e.g. as "perfevents: default" on a span.
+// default : cycles, instructions, cache and branch metrics, grouped so
+// that the ratios between the events of a group are consistent even when
+// the groups have to be multiplexed on the PMU.
+var eventPresets = map[string]string{
+	"default": "{cpu-cycles,instructions},{cache-references,cache-misses},{branch-instructions,branch-misses}",
+}
+
+// ParseEventGroups splits the event list "events" into its groups, as
+// in the perf CLI grammar : the events between braces form a group and
+// every other event stands alone, e.g. "{instructions,cpu-cycles},cache-misses"
+// is parsed into [[instructions cpu-cycles] [cache-misses]].
+// Groups can't be nested. A preset name, e.g. "default", standing alone
+// is expanded into its event list.
+func ParseEventGroups(events string) ([][]string, error) {
+	var groups [][]string
+	addSingle := func(name string) {
+		if preset, ok := eventPresets[name]; ok {
+			presetGroups, _ := ParseEventGroups(preset)
+			groups = append(groups, presetGroups...)
+			return
+		}
+		groups = append(groups, []string{name})
+	}
+	var group []string
+	inGroup := false
+	// Set right after a group is closed, when only a ',' or the end of
+	// the list may follow.
+	closed := false
+	start := 0
+
+	for i := 0; i < len(events); i++ {
+		switch events[i] {
+		case '{':
+			if inGroup || closed || i != start {
+				return nil, PerfEventListSyntax
+			}
+			inGroup = true
+			start = i + 1
+		case '}':
+			if !inGroup {
+				return nil, PerfEventListSyntax
+			}
+			group = append(group, events[start:i])
+			groups = append(groups, group)
+			group = nil
+			inGroup = false
+			closed = true
+			start = i + 1
+		case ',':
+			if closed {
+				if i != start {
+					return nil, PerfEventListSyntax
+				}
+				closed = false
+			} else if inGroup {
+				group = append(group, events[start:i])
+			} else {
+				addSingle(events[start:i])
+			}
+			start = i + 1
+		}
+	}
+
+	if inGroup || (closed && start != len(events)) {
+		return nil, PerfEventListSyntax
+	}
+	if !closed {
+		addSingle(events[start:])
+	}
+	return groups, nil
+}
+
+// InitOpenEventGroupEnableSelf opens the events in "events" for self
+// process as one group, resets and then enables the whole group at once.
+// "events" is a comma separated list of supported events, the first one
+// being the group leader.
+// If any of the events couldn't be opened, all the events of the group
+// opened until then, leader included, are closed, since a partial group
+// would be invalid. The error is then sent along with the name of the
+// event which failed.
+func InitOpenEventGroupEnableSelf(events string, opts EventOptions) (error, string, []PerfEventInfo) {
+	return initOpenEventGroupEnable(events, 0, -1, opts)
+}
+
+// initOpenEventGroupEnable opens, enables the group of events "events"
+// for the process "pid" on the cpu "cpu", as per "opts".
+func initOpenEventGroupEnable(events string, pid int, cpu int, opts EventOptions) (error, string, []PerfEventInfo) {
+	names := strings.Split(events, ",")
+	group := make([]PerfEventInfo, len(names))
+
+	// The leader reads the values of the whole group, see ReadGroup.
+	leaderOpts := opts
+	leaderOpts.ReadFormat |= PERF_FORMAT_GROUP
+	groupFd := -1
+	for i, name := range names {
+		var err error
+		if i == 0 {
+			err = (&group[i]).initOpenEvent(name, pid, cpu, groupFd, leaderOpts)
+		} else {
+			err = (&group[i]).initOpenEvent(name, pid, cpu, groupFd, opts)
+		}
+		if err != nil {
+			closeEvents(group[:i])
+			return err, name, nil
+		}
+		if i == 0 {
+			groupFd = group[0].Fd
+		}
+	}
+	group[0].groupSize = len(group)
+
+	leader := &group[0]
+	err := leader.resetGroup()
+	if err == nil && !opts.EnableOnExec && !opts.Disabled {
+		err = leader.EnableGroup()
+	}
+	if err != nil {
+		closeEvents(group)
+		return err, leader.EventName, nil
+	}
+	for i := range group {
+		group[i].resetValues()
+	}
+	if opts.Disabled {
+		return nil, "", group
+	}
+	// The members are enabled along with the leader.
+	for i := range group {
+		group[i].Enabled = true
+	}
+	return nil, "", group
+}
+
+// resetGroup resets an event group leader along with all the members
+// of its group, in one IOCTL call.
+func (event *PerfEventInfo) resetGroup() error {
+	if event.Fd < 0 {
+		return PerfFdError
+	}
+	err := event.ioctl(event.IOCOps.reset, PERF_IOC_FLAG_GROUP)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// EventGroup is a group of events the kernel schedules on the PMU all at
+// once, so that the events count over the same time and their ratios,
+// e.g. instructions per cycle, hold even when the PMU is multiplexed.
+// The first event is the leader of the group, the members being opened
+// with the group_fd of the leader, and the whole group is enabled,
+// disabled and reset with a single IOCTL call on the leader.
+// The members only count along with the leader, so they are left enabled
+// and disabling the leader disables the whole group. A member disabled on
+// its own is enabled back along with the leader by Enable.
+type EventGroup struct {
+	Events []PerfEventInfo
+}
+
+// NewEventGroup opens the events "events" for self process as one group,
+// as per "opts", resets and then enables the group, see
+// InitOpenEventGroupEnableSelf, which also tells which event couldn't be
+// opened.
+func NewEventGroup(events string, opts EventOptions) (*EventGroup, error) {
+	err, _, group := InitOpenEventGroupEnableSelf(events, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &EventGroup{Events: group}, nil
+}
+
+// Leader returns the leader of the group.
+func (g *EventGroup) Leader() *PerfEventInfo {
+	return &g.Events[0]
+}
+
+// setEnabled records that the events of the group are all enabled or
+// disabled, along with the leader.
+func (g *EventGroup) setEnabled(enabled bool) {
+	for i := range g.Events {
+		g.Events[i].Enabled = enabled
+	}
+}
+
+// Enable enables all the events of the group at once.
+func (g *EventGroup) Enable() error {
+	err := g.Leader().EnableGroup()
+	if err != nil {
+		return err
+	}
+	g.setEnabled(true)
+	return nil
+}
+
+// Disable disables all the events of the group at once.
+func (g *EventGroup) Disable() error {
+	err := g.Leader().DisableEvent()
+	if err != nil {
+		return err
+	}
+	g.setEnabled(false)
+	return nil
+}
+
+// Reset resets the counts of all the events of the group at once, which
+// are then taken as reset by ResetEvent.
+func (g *EventGroup) Reset() error {
+	err := g.Leader().resetGroup()
+	if err != nil {
+		return err
+	}
+	for i := range g.Events {
+		g.Events[i].resetValues()
+	}
+	return nil
+}
+
+// Read reads the counts of the events of the group into their Data, in
+// a single read, see ReadGroup.
+func (g *EventGroup) Read() error {
+	return ReadGroup(g.Events)
+}
+
+// Close disables the group and closes its events, the members first.
+func (g *EventGroup) Close() error {
+	err := g.Disable()
+	g.setEnabled(false)
+	closeEvents(g.Events)
+	return err
+}
+
+// groupLen returns the number of events of the group led by the first
+// event of "eventsInfo", if it is a leader reading its group, and which
+// follow it, 0 otherwise.
+func groupLen(eventsInfo []PerfEventInfo) int {
+	leader := eventsInfo[0]
+	if leader.Fd < 0 || leader.ReadFormat&PERF_FORMAT_GROUP == 0 {
+		return 0
+	}
+	n := 1
+	for n < len(eventsInfo) && eventsInfo[n].GroupFd == leader.Fd {
+		n++
+	}
+	return n
+}
+
+// PeekGroup reads the values of all the events of the group of the
+// leader "event", opened with PERF_FORMAT_GROUP, in one read, without
+// updating the events.
+func (event *PerfEventInfo) PeekGroup() (GroupReadFormat, error) {
+	return event.peekGroup(event.groupSize)
+}
+
+// peekGroup is PeekGroup for a group of "groupSize" events. The read
+// buffer is grown if the group turns out to be larger, e.g. for a leader
+// opened with OpenEvent, the members of which it doesn't know of.
+func (event *PerfEventInfo) peekGroup(groupSize int) (GroupReadFormat, error) {
+	if event.ReadFormat&PERF_FORMAT_GROUP == 0 {
+		return GroupReadFormat{}, PerfFdError
+	}
+	if groupSize < 1 {
+		groupSize = 1
+	}
+	// nr and the times, then the values, as in a sample.
+	headerSize := readSize(event.ReadFormat &^ (PERF_FORMAT_ID | PERF_FORMAT_LOST))
+	valueSize := readSize(event.ReadFormat & (PERF_FORMAT_ID | PERF_FORMAT_LOST))
+	for {
+		readBuf := make([]byte, headerSize+groupSize*valueSize)
+		n, err := event.read(readBuf)
+		if err == syscall.ENOSPC {
+			groupSize *= 2
+			continue
+		}
+		if err != nil {
+			return GroupReadFormat{}, err
+		}
+		return ParseGroupRead(readBuf[:n], event.ReadFormat)
+	}
+}
+
+// values returns the values of the event "i" of the group read, laid out
+// as a single read of the event.
+func (group GroupReadFormat) values(i int) ReadFormat {
+	return ReadFormat{
+		Value:       group.Values[i].Value,
+		TimeEnabled: group.TimeEnabled,
+		TimeRunning: group.TimeRunning,
+		Id:          group.Values[i].Id,
+		Lost:        group.Values[i].Lost,
+	}
+}
+
+// ReadGroup reads the counts of the events of the group "eventsInfo", the
+// leader first and then its members in the order they were opened, in a
+// single read on the leader, rather than one read per event. The counts
+// are thus a consistent snapshot of the group. The events are updated as
+// by ReadEvent, the members with the times of the leader, which they
+// share.
+func ReadGroup(eventsInfo []PerfEventInfo) error {
+	if len(eventsInfo) == 0 || groupLen(eventsInfo) != len(eventsInfo) {
+		return PerfFdError
+	}
+	group, err := (&eventsInfo[0]).peekGroup(len(eventsInfo))
+	if err != nil {
+		return PerfReadError
+	}
+	if len(group.Values) != len(eventsInfo) {
+		// Some of the members have been closed.
+		return PerfReadError
+	}
+	for i := range eventsInfo {
+		(&eventsInfo[i]).setValues(group.values(i))
+	}
+	return nil
+}
+
+// closeEvents closes the events in "eventsInfo", members first, so that
+// a group leader is closed last.
+func closeEvents(eventsInfo []PerfEventInfo) {
+	for i := len(eventsInfo) - 1; i >= 0; i-- {
+		if eventsInfo[i].Fd > 0 {
+			eventsInfo[i].unmapUserPage()
+			syscall.Close(eventsInfo[i].Fd)
+			eventsInfo[i].Fd = -1
+		}
+	}
+}
+
+// Number of hardware counters a group can be assumed to fit in. CPUs
+// have more, some of them dedicated to given events, but the kernel
+// schedules a group on the general purpose counters and the NMI watchdog
+// may hold one of these.
+var groupCounterBudget = 4
+
+// groupPMU tells the PMU an event is counted by, "" for a software
+// event, which can be grouped with the events of any PMU.
+func groupPMU(eventAttr PerfEventAttr) string {
+	switch eventAttr.Type {
+	case PERF_TYPE_SOFTWARE:
+		return ""
+	case PERF_TYPE_HARDWARE, PERF_TYPE_HW_CACHE, PERF_TYPE_RAW:
+		return "cpu"
+	}
+	return strconv.FormatUint(uint64(eventAttr.Type), 10)
+}
+
+// CanGroup tells whether the events "events" can be opened as a group,
+// i.e., they are supported, counted by the same PMU (software events
+// aside) and fit in its counters. When they can't, the reason is
+// returned.
+func CanGroup(events []string) (bool, string) {
+	pmu := ""
+	counters := 0
+	for _, name := range events {
+		event := parseEvent(name)
+		if event.Err != nil {
+			return false, name + ": " + event.Err.Error()
+		}
+		eventPMU := groupPMU(event.attr)
+		if eventPMU == "" {
+			continue
+		}
+		if pmu != "" && eventPMU != pmu {
+			return false, name + ": not counted by the same PMU as the events before"
+		}
+		pmu = eventPMU
+		counters++
+		if counters > groupCounterBudget {
+			return false, "more than " + strconv.Itoa(groupCounterBudget) + " hardware events"
+		}
+	}
+	return true, ""
+}
+
+// Priority of the events kept by FitEventList, the most useful first.
+// The events not listed come last.
+var fitPriority = []string{
+	"cpu-cycles",
+	"instructions",
+	"cache-references",
+	"cache-misses",
+	"branch-instructions",
+	"branch-misses",
+}
+
+// FitEventList drops from the event list "events" the hardware events
+// which don't fit in the counters of the PMU, so that the events are
+// never multiplexed. The events are kept as per fitPriority, cycles and
+// instructions first, and the list order otherwise. It returns the
+// fitted list along with the dropped events. Software events are always
+// kept.
+func FitEventList(events string) (string, []string) {
+	list, err := ParseEventList(events)
+	if err != nil {
+		return events, nil
+	}
+
+	rank := func(event ParsedEvent) int {
+		for i, name := range fitPriority {
+			if event.Canonical == name {
+				return i
+			}
+		}
+		return len(fitPriority)
+	}
+	var counted []ParsedEvent
+	seen := make(map[string]bool)
+	for _, event := range list.Events {
+		if event.Err != nil || groupPMU(event.attr) == "" || seen[event.Name] {
+			continue
+		}
+		seen[event.Name] = true
+		counted = append(counted, event)
+	}
+	sort.SliceStable(counted, func(i, j int) bool {
+		return rank(counted[i]) < rank(counted[j])
+	})
+	if len(counted) <= groupCounterBudget {
+		return events, nil
+	}
+
+	var dropped []string
+	drop := make(map[string]bool)
+	for _, event := range counted[groupCounterBudget:] {
+		dropped = append(dropped, event.Name)
+		drop[event.Name] = true
+	}
+	fitted := FilterEventList(events, func(name string) bool {
+		return !drop[name]
+	})
+	return fitted, dropped
+}
@@ -0,0 +1,344 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"os"
+	"reflect"
+	"runtime"
+	"syscall"
+	"testing"
+)
+
+// touchPages writes "n" pages of fresh memory, for the page faults to
+// count.
+func touchPages(n int) {
+	pageSize := os.Getpagesize()
+	buf, err := syscall.Mmap(-1, 0, n*pageSize, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_ANON|syscall.MAP_PRIVATE)
+	if err != nil {
+		panic(err)
+	}
+	for i := 0; i < len(buf); i += pageSize {
+		buf[i] = 1
+	}
+	syscall.Munmap(buf)
+}
+
+// newGroupOrSkip opens the group "events" for the test, skipping it if
+// it can't be opened.
+func newGroupOrSkip(t *testing.T, events string, opts EventOptions) *EventGroup {
+	t.Helper()
+	g, err := NewEventGroup(events, opts)
+	if err != nil {
+		t.Skipf("can't open the group %s: %v", events, err)
+	}
+	t.Cleanup(func() { g.Close() })
+	return g
+}
+
+func TestEventGroup(t *testing.T) {
+	// The events count the calling thread.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	g := newGroupOrSkip(t, "task-clock,page-faults,context-switches:uk", EventOptions{})
+
+	leader := g.Leader()
+	if leader != &g.Events[0] || leader.GroupFd != -1 {
+		t.Fatalf("Leader() = %+v, want the first event", leader)
+	}
+	for i, event := range g.Events {
+		if i > 0 && event.GroupFd != leader.Fd {
+			t.Errorf("%s: GroupFd = %d, want %d", event.EventName, event.GroupFd, leader.Fd)
+		}
+		if !event.IsEnabled() {
+			t.Errorf("%s not enabled", event.EventName)
+		}
+	}
+
+	touchPages(64)
+	if err := g.Read(); err != nil {
+		t.Fatal(err)
+	}
+	if g.Events[0].Data == 0 || g.Events[1].Data < 64 {
+		t.Errorf("counts %d, %d, want task-clock > 0 and >= 64 page faults", g.Events[0].Data, g.Events[1].Data)
+	}
+	for _, event := range g.Events[1:] {
+		if event.TimeEnabled != leader.TimeEnabled || event.TimeRunning != leader.TimeRunning {
+			t.Errorf("%s: times %d, %d, want those of the leader %d, %d", event.EventName,
+				event.TimeEnabled, event.TimeRunning, leader.TimeEnabled, leader.TimeRunning)
+		}
+	}
+
+	// The members are disabled along with the leader.
+	if err := g.Disable(); err != nil {
+		t.Fatal(err)
+	}
+	for _, event := range g.Events {
+		if event.IsEnabled() {
+			t.Errorf("%s still enabled", event.EventName)
+		}
+	}
+	g.Read()
+	faults := g.Events[1].Data
+	touchPages(64)
+	g.Read()
+	if g.Events[1].Data != faults {
+		t.Errorf("disabled group counted %d page faults", g.Events[1].Data-faults)
+	}
+
+	if err := g.Enable(); err != nil {
+		t.Fatal(err)
+	}
+	touchPages(64)
+	g.Read()
+	if g.Events[1].Data < faults+64 {
+		t.Errorf("enabled group counted %d page faults, want >= 64", g.Events[1].Data-faults)
+	}
+}
+
+// The counts start again from 0 after a reset, which isn't an overflow.
+func TestEventGroupReset(t *testing.T) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	g := newGroupOrSkip(t, "task-clock,page-faults", EventOptions{})
+
+	touchPages(256)
+	if err := g.Read(); err != nil {
+		t.Fatal(err)
+	}
+	before := g.Events[1].Data
+	epochs := []uint64{g.Events[0].Epoch, g.Events[1].Epoch}
+	g.Events[1].Baseline = before
+
+	if err := g.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	for i, event := range g.Events {
+		if event.Data != 0 || event.Baseline != 0 || event.Epoch != epochs[i]+1 {
+			t.Errorf("%s after Reset: Data %d, Baseline %d, Epoch %d, want 0, 0, %d",
+				event.EventName, event.Data, event.Baseline, event.Epoch, epochs[i]+1)
+		}
+	}
+	if err := g.Read(); err != nil {
+		t.Fatal(err)
+	}
+	for _, event := range g.Events {
+		if event.Overflowed {
+			t.Errorf("%s taken for overflowed after Reset", event.EventName)
+		}
+	}
+	if g.Events[1].Data >= before {
+		t.Errorf("%d page faults after Reset, want less than the %d before", g.Events[1].Data, before)
+	}
+}
+
+// A group read returns the values of all the events at once.
+func TestReadGroup(t *testing.T) {
+	g := newGroupOrSkip(t, "task-clock,page-faults,cpu-clock", EventOptions{ReadFormat: PERF_FORMAT_ID})
+
+	group, err := g.Leader().PeekGroup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if group.Nr != 3 || len(group.Values) != 3 {
+		t.Fatalf("PeekGroup() read %d events, want 3", group.Nr)
+	}
+	ids := make(map[uint64]bool)
+	for _, value := range group.Values {
+		ids[value.Id] = true
+	}
+	if len(ids) != 3 {
+		t.Errorf("PeekGroup() ids %+v, want 3 different ones", group.Values)
+	}
+	if g.Events[0].Data != 0 {
+		t.Error("PeekGroup() updated the leader")
+	}
+
+	if err := ReadGroup(g.Events); err != nil {
+		t.Fatal(err)
+	}
+	if g.Events[0].Data == 0 || g.Events[2].Data == 0 {
+		t.Errorf("ReadGroup() counts %d, %d, want the clocks > 0", g.Events[0].Data, g.Events[2].Data)
+	}
+	if err := ReadGroup(g.Events[1:]); err != PerfFdError {
+		t.Errorf("ReadGroup() of the members alone: %v, want %v", err, PerfFdError)
+	}
+	if err := ReadGroup(g.Events[:2]); err != PerfReadError {
+		t.Errorf("ReadGroup() of a part of the group: %v, want %v", err, PerfReadError)
+	}
+	if err := ReadGroup(nil); err != PerfFdError {
+		t.Errorf("ReadGroup(nil): %v, want %v", err, PerfFdError)
+	}
+}
+
+// A leader opened with OpenEvent doesn't know the size of its group.
+func TestReadGroupOpenEvent(t *testing.T) {
+	events := openOrSkip(t, "task-clock", EventOptions{})
+	EventsDisableClose(events)
+
+	eventsInfo := make([]PerfEventInfo, 4)
+	for i := range eventsInfo {
+		eventAttr, err := fetchPerfEventAttr("task-clock")
+		if err != nil {
+			t.Fatal(err)
+		}
+		groupFd := -1
+		if i == 0 {
+			eventAttr.Read_format |= PERF_FORMAT_GROUP
+		} else {
+			groupFd = eventsInfo[0].Fd
+		}
+		eventsInfo[i].InitIOCOps()
+		if err := eventsInfo[i].OpenEvent(eventAttr, 0, -1, groupFd, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer closeEvents(eventsInfo)
+
+	group, err := eventsInfo[0].PeekGroup()
+	if err != nil || len(group.Values) != 4 {
+		t.Fatalf("PeekGroup() = %+v, %v, want 4 values", group, err)
+	}
+	if err := ReadGroup(eventsInfo); err != nil {
+		t.Fatal(err)
+	}
+	if err := EventsRead(eventsInfo); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGroupLen(t *testing.T) {
+	leader := PerfEventInfo{Fd: 10, GroupFd: -1, ReadFormat: PERF_FORMAT_GROUP}
+	member := PerfEventInfo{Fd: 11, GroupFd: 10}
+	other := PerfEventInfo{Fd: 12, GroupFd: -1}
+	tests := []struct {
+		name    string
+		events  []PerfEventInfo
+		len     int
+		members int
+	}{
+		{"alone", []PerfEventInfo{other}, 0, 0},
+		{"leader alone", []PerfEventInfo{leader}, 1, 0},
+		{"group", []PerfEventInfo{leader, member, member}, 3, 2},
+		{"group and other", []PerfEventInfo{leader, member, other, member}, 2, 1},
+		{"member", []PerfEventInfo{member, member}, 0, 0},
+		{"closed leader", []PerfEventInfo{{Fd: -1, GroupFd: -1, ReadFormat: PERF_FORMAT_GROUP}, member}, 0, 0},
+		{"leader without group read", []PerfEventInfo{{Fd: 10, GroupFd: -1}, member}, 0, 1},
+	}
+	for _, tt := range tests {
+		if got := groupLen(tt.events); got != tt.len {
+			t.Errorf("%s: groupLen() = %d, want %d", tt.name, got, tt.len)
+		}
+		if got := groupMembers(tt.events); got != tt.members {
+			t.Errorf("%s: groupMembers() = %d, want %d", tt.name, got, tt.members)
+		}
+	}
+}
+
+// A group is opened as a whole or not at all.
+func TestGroupPartialFailure(t *testing.T) {
+	openOrSkip(t, "task-clock", EventOptions{})
+	err, failed, group := InitOpenEventGroupEnableSelf("task-clock,no-such-event,page-faults", EventOptions{})
+	if err != PerfUnsupportedEvent || failed != "no-such-event" || group != nil {
+		t.Errorf("InitOpenEventGroupEnableSelf() = %v, %q, %v, want %v, no-such-event, nil",
+			err, failed, group, PerfUnsupportedEvent)
+	}
+
+	err, eventListNA, events := InitOpenEventsEnableSelf("{task-clock,no-such-event},page-faults")
+	defer EventsDisableClose(events)
+	if err != PerfUnsupportedEvent || len(eventListNA) != 2 || len(events) != 1 || events[0].EventName != "page-faults" {
+		t.Errorf("InitOpenEventsEnableSelf() = %v, %v, %d events, want the group failed and page-faults opened",
+			err, eventListNA, len(events))
+	}
+}
+
+func TestCanGroup(t *testing.T) {
+	tests := []struct {
+		events []string
+		ok     bool
+	}{
+		{[]string{"cpu-cycles", "instructions"}, true},
+		{[]string{"task-clock", "page-faults", "cs"}, true},
+		{[]string{"cpu-cycles", "task-clock", "instructions", "cache-misses", "branch-misses"}, true},
+		{[]string{"cpu-cycles", "instructions", "cache-misses", "branch-misses", "bus-cycles"}, false},
+		{[]string{"cpu-cycles", "no-such-event"}, false},
+	}
+	for _, tt := range tests {
+		ok, reason := CanGroup(tt.events)
+		if ok != tt.ok || (ok == (reason != "")) {
+			t.Errorf("CanGroup(%q) = %v, %q, want %v", tt.events, ok, reason, tt.ok)
+		}
+	}
+}
+
+func TestFitEventList(t *testing.T) {
+	tests := []struct {
+		events  string
+		fitted  string
+		dropped []string
+	}{
+		{"cpu-cycles,instructions", "cpu-cycles,instructions", nil},
+		{"task-clock,page-faults,cs,cpu-migrations,minor-faults", "task-clock,page-faults,cs,cpu-migrations,minor-faults", nil},
+		{"bus-cycles,cache-misses,branch-misses,instructions,cpu-cycles",
+			"cache-misses,branch-misses,instructions,cpu-cycles", []string{"bus-cycles"}},
+		{"{bus-cycles,branch-misses},task-clock,cpu-cycles,instructions,cache-references,cache-misses",
+			"task-clock,cpu-cycles,instructions,cache-references,cache-misses", []string{"branch-misses", "bus-cycles"}},
+	}
+	for _, tt := range tests {
+		fitted, dropped := FitEventList(tt.events)
+		if fitted != tt.fitted || len(dropped) != len(tt.dropped) {
+			t.Errorf("FitEventList(%q) = %q, %q, want %q, %q", tt.events, fitted, dropped, tt.fitted, tt.dropped)
+			continue
+		}
+		for i := range dropped {
+			if dropped[i] != tt.dropped[i] {
+				t.Errorf("FitEventList(%q) dropped %q, want %q", tt.events, dropped, tt.dropped)
+			}
+		}
+	}
+}
+
+func TestParseEventGroups(t *testing.T) {
+	tests := []struct {
+		events string
+		groups [][]string
+		err    error
+	}{
+		{"cpu-cycles", [][]string{{"cpu-cycles"}}, nil},
+		{"cpu-cycles,instructions", [][]string{{"cpu-cycles"}, {"instructions"}}, nil},
+		{"{instructions,cpu-cycles},cache-misses", [][]string{{"instructions", "cpu-cycles"}, {"cache-misses"}}, nil},
+		{"cache-misses,{instructions,cpu-cycles}", [][]string{{"cache-misses"}, {"instructions", "cpu-cycles"}}, nil},
+		{"{a,b},{c,d,e},f", [][]string{{"a", "b"}, {"c", "d", "e"}, {"f"}}, nil},
+		{"{a}", [][]string{{"a"}}, nil},
+		{"{a:u,b:k},c:p", [][]string{{"a:u", "b:k"}, {"c:p"}}, nil},
+		{"default", [][]string{
+			{"cpu-cycles", "instructions"},
+			{"cache-references", "cache-misses"},
+			{"branch-instructions", "branch-misses"},
+		}, nil},
+		{"page-faults,default", [][]string{
+			{"page-faults"},
+			{"cpu-cycles", "instructions"},
+			{"cache-references", "cache-misses"},
+			{"branch-instructions", "branch-misses"},
+		}, nil},
+		// A preset in a group is just an event name.
+		{"{default,a}", [][]string{{"default", "a"}}, nil},
+		{"", [][]string{{""}}, nil},
+		{"{a,{b,c}}", nil, PerfEventListSyntax},
+		{"{{a,b}}", nil, PerfEventListSyntax},
+		{"{a,b", nil, PerfEventListSyntax},
+		{"a,b}", nil, PerfEventListSyntax},
+		{"{a,b}c", nil, PerfEventListSyntax},
+		{"a{b,c}", nil, PerfEventListSyntax},
+		{"{a,b}{c,d}", nil, PerfEventListSyntax},
+		{"}", nil, PerfEventListSyntax},
+	}
+	for _, tt := range tests {
+		groups, err := ParseEventGroups(tt.events)
+		if err != tt.err || !reflect.DeepEqual(groups, tt.groups) {
+			t.Errorf("ParseEventGroups(%q) = %q, %v, want %q, %v", tt.events, groups, err, tt.groups, tt.err)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+// Caches, operations and results of the HW_CACHE type events (from
+// linux/perf_event.h)
+const (
+	PERF_COUNT_HW_CACHE_L1D  = 0
+	PERF_COUNT_HW_CACHE_L1I  = 1
+	PERF_COUNT_HW_CACHE_LL   = 2
+	PERF_COUNT_HW_CACHE_DTLB = 3
+	PERF_COUNT_HW_CACHE_ITLB = 4
+	PERF_COUNT_HW_CACHE_BPU  = 5
+	PERF_COUNT_HW_CACHE_NODE = 6
+
+	PERF_COUNT_HW_CACHE_OP_READ     = 0
+	PERF_COUNT_HW_CACHE_OP_WRITE    = 1
+	PERF_COUNT_HW_CACHE_OP_PREFETCH = 2
+
+	PERF_COUNT_HW_CACHE_RESULT_ACCESS = 0
+	PERF_COUNT_HW_CACHE_RESULT_MISS   = 1
+)
+
+// HWCacheConfig returns the config value of the HW_CACHE type event
+// counting the operation "op" (PERF_COUNT_HW_CACHE_OP_*) on the cache
+// "cache" (PERF_COUNT_HW_CACHE_*) with the result "result"
+// (PERF_COUNT_HW_CACHE_RESULT_*), e.g. the load misses of the L1 data
+// cache.
+func HWCacheConfig(cache, op, result uint64) uint64 {
+	return cache | op<<8 | result<<16
+}
+
+// Names of the caches and of the operations of the HW_CACHE type events,
+// as known by the perf CLI, e.g. "L1-dcache-load-misses".
+var (
+	hwCacheNames = []struct {
+		name  string
+		cache uint64
+	}{
+		{"L1-dcache", PERF_COUNT_HW_CACHE_L1D},
+		{"L1-icache", PERF_COUNT_HW_CACHE_L1I},
+		{"LLC", PERF_COUNT_HW_CACHE_LL},
+		{"dTLB", PERF_COUNT_HW_CACHE_DTLB},
+		{"iTLB", PERF_COUNT_HW_CACHE_ITLB},
+		{"branch", PERF_COUNT_HW_CACHE_BPU},
+		{"node", PERF_COUNT_HW_CACHE_NODE},
+	}
+	hwCacheOpNames = []struct {
+		access string
+		miss   string
+		op     uint64
+	}{
+		{"loads", "load-misses", PERF_COUNT_HW_CACHE_OP_READ},
+		{"stores", "store-misses", PERF_COUNT_HW_CACHE_OP_WRITE},
+		{"prefetches", "prefetch-misses", PERF_COUNT_HW_CACHE_OP_PREFETCH},
+	}
+)
+
+// addHWCacheEvents adds the HW_CACHE type events to the event list
+// "events", all the caches with all the operations, the PMUs not
+// supporting some of them, e.g. the stores of the instruction cache.
+func addHWCacheEvents(events map[string]EventConfigType) {
+	for _, c := range hwCacheNames {
+		for _, o := range hwCacheOpNames {
+			events[c.name+"-"+o.access] = EventConfigType{PERF_TYPE_HW_CACHE,
+				HWCacheConfig(c.cache, o.op, PERF_COUNT_HW_CACHE_RESULT_ACCESS)}
+			events[c.name+"-"+o.miss] = EventConfigType{PERF_TYPE_HW_CACHE,
+				HWCacheConfig(c.cache, o.op, PERF_COUNT_HW_CACHE_RESULT_MISS)}
+		}
+	}
+}
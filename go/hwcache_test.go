@@ -0,0 +1,55 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import "testing"
+
+func TestHWCacheConfig(t *testing.T) {
+	tests := []struct {
+		cache, op, result uint64
+		want              uint64
+	}{
+		{PERF_COUNT_HW_CACHE_L1D, PERF_COUNT_HW_CACHE_OP_READ, PERF_COUNT_HW_CACHE_RESULT_ACCESS, 0x0},
+		{PERF_COUNT_HW_CACHE_L1D, PERF_COUNT_HW_CACHE_OP_READ, PERF_COUNT_HW_CACHE_RESULT_MISS, 0x10000},
+		{PERF_COUNT_HW_CACHE_LL, PERF_COUNT_HW_CACHE_OP_WRITE, PERF_COUNT_HW_CACHE_RESULT_MISS, 0x10102},
+		{PERF_COUNT_HW_CACHE_DTLB, PERF_COUNT_HW_CACHE_OP_PREFETCH, PERF_COUNT_HW_CACHE_RESULT_ACCESS, 0x203},
+		{PERF_COUNT_HW_CACHE_NODE, PERF_COUNT_HW_CACHE_OP_READ, PERF_COUNT_HW_CACHE_RESULT_ACCESS, 0x6},
+	}
+	for _, tt := range tests {
+		if got := HWCacheConfig(tt.cache, tt.op, tt.result); got != tt.want {
+			t.Errorf("HWCacheConfig(%d, %d, %d) = %#x, want %#x", tt.cache, tt.op, tt.result, got, tt.want)
+		}
+	}
+}
+
+func TestHWCacheEvents(t *testing.T) {
+	tests := []struct {
+		name   string
+		config uint64
+	}{
+		{"L1-dcache-loads", 0x0},
+		{"L1-dcache-load-misses", 0x10000},
+		{"L1-icache-load-misses", 0x10001},
+		{"LLC-stores", 0x102},
+		{"LLC-store-misses", 0x10102},
+		{"dTLB-prefetches", 0x203},
+		{"iTLB-loads", 0x4},
+		{"branch-loads", 0x5},
+		{"node-prefetch-misses", 0x10206},
+	}
+	for _, tt := range tests {
+		config, ok := EventNameToConfig(tt.name)
+		if !ok || config.typeHw != PERF_TYPE_HW_CACHE || config.config != tt.config {
+			t.Errorf("EventNameToConfig(%q) = %+v, %v, want type %d, config %#x", tt.name,
+				config, ok, PERF_TYPE_HW_CACHE, tt.config)
+		}
+	}
+
+	// All the caches with all the operations, their accesses and misses.
+	events := make(map[string]EventConfigType)
+	addHWCacheEvents(events)
+	if want := len(hwCacheNames) * len(hwCacheOpNames) * 2; len(events) != want {
+		t.Errorf("addHWCacheEvents() added %d events, want %d", len(events), want)
+	}
+}
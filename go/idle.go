@@ -0,0 +1,85 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// A cpu-clock event counts the time of its CPU whatever runs on it, the
+// idle task included. Sampled every idleSamplePeriod ns with
+// EXCLUDE_IDLE set though, it only takes the samples landing outside of
+// the idle task, which tells the busy time of the CPU.
+const idleSamplePeriod = 1000000
+
+// Size of the samples taken with no sample type, i.e. their header.
+const idleSampleSize = 8
+
+// Offset of data_head in the first page of the mmap'd ring buffer of an
+// event (struct perf_event_mmap_page in linux/perf_event.h).
+const mmapDataHeadOffset = 1024
+
+// Number of data pages of the ring buffer, a power of 2.
+const idleRingPages = 16
+
+// MeasureCPUIdle measures for "duration" how long the CPU "cpu" has been
+// idle, in ns. The CPU has been busy for the rest of the time measured,
+// within the sampling period of 1ms.
+// Counting on a CPU rather than a process requires privileges, see
+// PermissionSummary.
+func MeasureCPUIdle(cpu int, duration time.Duration) (uint64, error) {
+	eventAttr := setupPerfEventAttr(EventConfigType{PERF_TYPE_SOFTWARE, PERF_COUNT_SW_CPU_CLOCK})
+	// The busy time includes the time spent in the kernel.
+	eventAttr.Bits = setBit(0, DISABLED)
+	eventAttr.Bits = setBit(eventAttr.Bits, EXCLUDE_IDLE)
+	eventAttr.Sample = idleSamplePeriod
+
+	event := PerfEventInfo{Fd: -1}
+	err := event.InitIOCOps()
+	if err != nil {
+		return 0, err
+	}
+	err = event.OpenEvent(eventAttr, -1, cpu, -1, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer syscall.Close(event.Fd)
+
+	// With a read-only mapping, the kernel overwrites the oldest
+	// samples rather than stopping, data_head counting the bytes of
+	// all of them.
+	pageSize := syscall.Getpagesize()
+	ring, err := syscall.Mmap(event.Fd, 0, (1+idleRingPages)*pageSize, syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return 0, PerfOpenError
+	}
+	defer syscall.Munmap(ring)
+
+	err = event.ResetEvent()
+	if err == nil {
+		err = event.EnableEvent()
+	}
+	if err != nil {
+		return 0, err
+	}
+	time.Sleep(duration)
+	err = event.DisableEvent()
+	if err != nil {
+		return 0, err
+	}
+	err = event.ReadEvent()
+	if err != nil {
+		return 0, err
+	}
+
+	dataHead := atomic.LoadUint64((*uint64)(unsafe.Pointer(&ring[mmapDataHeadOffset])))
+	busy := dataHead / idleSampleSize * idleSamplePeriod
+	if busy >= event.Data {
+		return 0, nil
+	}
+	return event.Data - busy, nil
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// firstCPU returns the first CPU the test may run on.
+func firstCPU(t *testing.T) int {
+	var set unix.CPUSet
+	if err := unix.SchedGetaffinity(0, &set); err != nil {
+		t.Fatal(err)
+	}
+	for cpu := 0; cpu < 1024; cpu++ {
+		if set.IsSet(cpu) {
+			return cpu
+		}
+	}
+	t.Fatal("no CPU to run on")
+	return -1
+}
+
+func TestMeasureCPUIdle(t *testing.T) {
+	const duration = 200 * time.Millisecond
+	cpu := firstCPU(t)
+
+	idle, err := MeasureCPUIdle(cpu, duration)
+	if err != nil {
+		t.Skipf("can't count on CPU %d: %v", cpu, err)
+	}
+	if idle > uint64(duration+duration/2) {
+		t.Errorf("MeasureCPUIdle(%d, %v) = %v idle", cpu, duration, time.Duration(idle))
+	}
+
+	// Kept busy, the CPU is hardly idle.
+	var stop int32
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		unpin, err := PinToCPU(cpu)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer unpin()
+		for atomic.LoadInt32(&stop) == 0 {
+		}
+	}()
+	idle, err = MeasureCPUIdle(cpu, duration)
+	atomic.StoreInt32(&stop, 1)
+	<-done
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idle > uint64(duration/2) {
+		t.Errorf("MeasureCPUIdle(%d, %v) = %v idle, with the CPU busy", cpu, duration, time.Duration(idle))
+	}
+}
+
+func TestMeasureCPUIdleInvalid(t *testing.T) {
+	if _, err := MeasureCPUIdle(1<<20, time.Millisecond); err == nil {
+		t.Errorf("MeasureCPUIdle() on a missing CPU succeeded")
+	}
+}
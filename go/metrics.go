@@ -0,0 +1,71 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"time"
+)
+
+// derivedMetric is a ratio of the counts of two events.
+type derivedMetric struct {
+	name        string
+	numerator   string
+	denominator string
+}
+
+// List of the derived metrics computed by DerivedMetrics.
+var derivedMetricList = []derivedMetric{
+	{"ipc", "instructions", "cpu-cycles"},
+	{"cache-miss-rate", "cache-misses", "cache-references"},
+	{"branch-miss-rate", "branch-misses", "branch-instructions"},
+}
+
+// DerivedMetrics computes the common ratios between the events in
+// "events" after they have been read :
+// ipc : instructions / cpu-cycles
+// cache-miss-rate : cache-misses / cache-references
+// branch-miss-rate : branch-misses / branch-instructions
+// A ratio is left out if any of its events is missing from "events" or
+// if its denominator is 0.
+func DerivedMetrics(events []PerfEventInfo) map[string]float64 {
+	counts := make(map[string]uint64)
+	for _, event := range events {
+		if event.EventName != "" {
+			counts[event.EventName] = event.Data
+		}
+	}
+
+	metrics := make(map[string]float64)
+	for _, m := range derivedMetricList {
+		num, ok := counts[m.numerator]
+		if !ok {
+			continue
+		}
+		den, ok := counts[m.denominator]
+		if !ok || den == 0 {
+			continue
+		}
+		metrics[m.name] = float64(num) / float64(den)
+	}
+	return metrics
+}
+
+// RatePerSecond computes the rate per second of an event which has been
+// counting for "durationNs" nanoseconds. It returns 0 for a 0 duration.
+func RatePerSecond(pi PerfEventInfo, durationNs uint64) float64 {
+	if durationNs == 0 {
+		return 0
+	}
+	return float64(pi.Data) / (float64(durationNs) / 1e9)
+}
+
+// EffectiveSampleRate computes the rate per second at which samples have
+// actually been taken, which is lower than the requested rate when the
+// kernel throttled the sampling.
+func EffectiveSampleRate(sampleCount uint64, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(sampleCount) / elapsed.Seconds()
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDerivedMetrics(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []PerfEventInfo
+		want   map[string]float64
+	}{
+		{"all", []PerfEventInfo{
+			{EventName: "cpu-cycles", Data: 1000},
+			{EventName: "instructions", Data: 2500},
+			{EventName: "cache-references", Data: 200},
+			{EventName: "cache-misses", Data: 50},
+			{EventName: "branch-instructions", Data: 400},
+			{EventName: "branch-misses", Data: 4},
+		}, map[string]float64{"ipc": 2.5, "cache-miss-rate": 0.25, "branch-miss-rate": 0.01}},
+		{"missing events", []PerfEventInfo{
+			{EventName: "instructions", Data: 2500},
+			{EventName: "cache-references", Data: 200},
+			{EventName: "cache-misses", Data: 50},
+		}, map[string]float64{"cache-miss-rate": 0.25}},
+		{"zero denominator", []PerfEventInfo{
+			{EventName: "cpu-cycles", Data: 0},
+			{EventName: "instructions", Data: 2500},
+		}, map[string]float64{}},
+		{"unnamed events", []PerfEventInfo{
+			{EventName: "", Data: 1000},
+			{EventName: "instructions", Data: 2500},
+		}, map[string]float64{}},
+		{"none", nil, map[string]float64{}},
+	}
+	for _, tt := range tests {
+		if got := DerivedMetrics(tt.events); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: DerivedMetrics() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRatePerSecond(t *testing.T) {
+	tests := []struct {
+		data, durationNs uint64
+		want             float64
+	}{
+		{1000, 1e9, 1000},
+		{1000, 5e8, 2000},
+		{1000, 2e9, 500},
+		{0, 1e9, 0},
+		{1000, 0, 0},
+	}
+	for _, tt := range tests {
+		if got := RatePerSecond(PerfEventInfo{Data: tt.data}, tt.durationNs); got != tt.want {
+			t.Errorf("RatePerSecond(%d, %d) = %g, want %g", tt.data, tt.durationNs, got, tt.want)
+		}
+	}
+}
+
+func TestEffectiveSampleRate(t *testing.T) {
+	tests := []struct {
+		samples uint64
+		elapsed time.Duration
+		want    float64
+	}{
+		{4000, time.Second, 4000},
+		{1000, 500 * time.Millisecond, 2000},
+		{0, time.Second, 0},
+		{1000, 0, 0},
+		{1000, -time.Second, 0},
+	}
+	for _, tt := range tests {
+		if got := EffectiveSampleRate(tt.samples, tt.elapsed); got != tt.want {
+			t.Errorf("EffectiveSampleRate(%d, %v) = %g, want %g", tt.samples, tt.elapsed, got, tt.want)
+		}
+	}
+}
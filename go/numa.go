@@ -0,0 +1,123 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// The kernel exports the CPUs of each NUMA node in
+// sysfsNodePath/node<N>/cpulist, and the online CPUs in sysfsCPUOnlinePath.
+var sysfsNodePath = "/sys/devices/system/node"
+var sysfsCPUOnlinePath = "/sys/devices/system/cpu/online"
+
+var PerfCPUListError = errors.New("malformed CPU list")
+
+// parseCPUList parses a kernel CPU list, e.g. "0-3,8,10-11".
+func parseCPUList(list string) ([]int, error) {
+	list = strings.TrimSpace(list)
+	cpus := make([]int, 0)
+	if list == "" {
+		return cpus, nil
+	}
+	for _, r := range strings.Split(list, ",") {
+		lo, hi := r, r
+		if i := strings.IndexByte(r, '-'); i >= 0 {
+			lo, hi = r[:i], r[i+1:]
+		}
+		first, err1 := strconv.Atoi(lo)
+		last, err2 := strconv.Atoi(hi)
+		if err1 != nil || err2 != nil || first < 0 || last < first {
+			return nil, PerfCPUListError
+		}
+		for cpu := first; cpu <= last; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+	return cpus, nil
+}
+
+// readCPUList reads and parses the kernel CPU list in "path".
+func readCPUList(path string) ([]int, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseCPUList(string(buf))
+}
+
+// NodeCPUs returns the online CPUs of the NUMA node "node".
+func NodeCPUs(node int) ([]int, error) {
+	cpus, err := readCPUList(filepath.Join(sysfsNodePath, "node"+strconv.Itoa(node), "cpulist"))
+	if err != nil {
+		return nil, err
+	}
+	online, err := readCPUList(sysfsCPUOnlinePath)
+	if err != nil {
+		// Without the online list, all the CPUs are tried.
+		return cpus, nil
+	}
+	isOnline := make(map[int]bool)
+	for _, cpu := range online {
+		isOnline[cpu] = true
+	}
+	onlineCPUs := make([]int, 0, len(cpus))
+	for _, cpu := range cpus {
+		if isOnline[cpu] {
+			onlineCPUs = append(onlineCPUs, cpu)
+		}
+	}
+	return onlineCPUs, nil
+}
+
+// InitOpenEventsEnableNUMA opens, enables the events in "events" on each
+// online CPU of the NUMA node "node", counting all the processes running
+// on these CPUs. This needs a perf_event_paranoid level of 0 at most, or
+// CAP_PERFMON.
+// It returns the same as InitOpenEventsEnableSelf, with one event
+// descriptor per event and CPU. SumEvents gives the node wide counts.
+func InitOpenEventsEnableNUMA(events string, node int) (error, []string, []PerfEventInfo) {
+	cpus, err := NodeCPUs(node)
+	if err != nil {
+		return err, nil, nil
+	}
+
+	eventListNA := make([]string, 0)
+	eventDescs := make([]PerfEventInfo, 0)
+	failErr := PerfUnsupportedEvent
+	for _, cpu := range cpus {
+		err, cpuListNA, cpuDescs := initOpenEventsEnable(events, -1, cpu, EventOptions{})
+		if err != nil {
+			if err == PerfPermissionError {
+				failErr = err
+			}
+			for _, name := range cpuListNA {
+				eventListNA = append(eventListNA, name+"@cpu"+strconv.Itoa(cpu))
+			}
+		}
+		eventDescs = append(eventDescs, cpuDescs...)
+	}
+
+	if len(eventListNA) != 0 {
+		return failErr, eventListNA, eventDescs
+	}
+	return nil, eventListNA, eventDescs
+}
+
+// SumEvents sums the counts of the events of "eventsInfo" by event name,
+// e.g. to get the node wide counts of the per CPU events opened by
+// InitOpenEventsEnableNUMA.
+func SumEvents(eventsInfo []PerfEventInfo) map[string]uint64 {
+	sums := make(map[string]uint64)
+	for _, event := range eventsInfo {
+		if event.EventName != "" {
+			sums[event.EventName] += event.Data
+		}
+	}
+	return sums
+}
@@ -0,0 +1,177 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+func TestParseCPUList(t *testing.T) {
+	tests := []struct {
+		list string
+		want []int
+		err  error
+	}{
+		{"0", []int{0}, nil},
+		{"0-3\n", []int{0, 1, 2, 3}, nil},
+		{"0-3,8,10-11", []int{0, 1, 2, 3, 8, 10, 11}, nil},
+		{"5-5", []int{5}, nil},
+		{"", []int{}, nil},
+		{"\n", []int{}, nil},
+		{"3-1", nil, PerfCPUListError},
+		{"-1", nil, PerfCPUListError},
+		{"0,,1", nil, PerfCPUListError},
+		{"0-", nil, PerfCPUListError},
+		{"a-b", nil, PerfCPUListError},
+	}
+	for _, tt := range tests {
+		got, err := parseCPUList(tt.list)
+		if err != tt.err || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseCPUList(%q) = %v, %v, want %v, %v", tt.list, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+// fakeNodes points sysfsNodePath to a temporary tree with the CPUs of
+// the nodes "nodes", and sysfsCPUOnlinePath to the "online" CPUs, or to
+// a missing file if empty, for the time of the test.
+func fakeNodes(t *testing.T, nodes map[string]string, online string) {
+	dir := t.TempDir()
+	for node, cpus := range nodes {
+		path := filepath.Join(dir, node, "cpulist")
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(cpus), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	onlinePath := filepath.Join(dir, "online")
+	if online != "" {
+		if err := ioutil.WriteFile(onlinePath, []byte(online), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	nodePath, cpuOnlinePath := sysfsNodePath, sysfsCPUOnlinePath
+	sysfsNodePath, sysfsCPUOnlinePath = dir, onlinePath
+	t.Cleanup(func() { sysfsNodePath, sysfsCPUOnlinePath = nodePath, cpuOnlinePath })
+}
+
+func TestNodeCPUs(t *testing.T) {
+	nodes := map[string]string{"node0": "0-3\n", "node1": "4-7\n", "node2": "bad\n"}
+	tests := []struct {
+		online string
+		node   int
+		want   []int
+		ok     bool
+	}{
+		{"0-7\n", 0, []int{0, 1, 2, 3}, true},
+		{"0-7\n", 1, []int{4, 5, 6, 7}, true},
+		{"0,2-5\n", 0, []int{0, 2, 3}, true},
+		{"0-3\n", 1, []int{}, true},
+		// Without the online list, all the CPUs of the node.
+		{"", 1, []int{4, 5, 6, 7}, true},
+		{"0-7\n", 2, nil, false},
+		{"0-7\n", 3, nil, false},
+	}
+	for _, tt := range tests {
+		fakeNodes(t, nodes, tt.online)
+		got, err := NodeCPUs(tt.node)
+		if (err == nil) != tt.ok || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("NodeCPUs(%d) online %q = %v, %v, want %v", tt.node, tt.online, got, err, tt.want)
+		}
+	}
+}
+
+func TestSumEvents(t *testing.T) {
+	tests := []struct {
+		events []PerfEventInfo
+		want   map[string]uint64
+	}{
+		{[]PerfEventInfo{
+			{EventName: "page-faults", Data: 10},
+			{EventName: "cpu-clock", Data: 1000},
+			{EventName: "page-faults", Data: 5},
+			{EventName: "cpu-clock", Data: 2000},
+		}, map[string]uint64{"page-faults": 15, "cpu-clock": 3000}},
+		// The events not opened are left out.
+		{[]PerfEventInfo{
+			{EventName: "", Data: 10},
+			{EventName: "page-faults", Data: 5},
+		}, map[string]uint64{"page-faults": 5}},
+		{nil, map[string]uint64{}},
+	}
+	for _, tt := range tests {
+		if got := SumEvents(tt.events); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SumEvents(%v) = %v, want %v", tt.events, got, tt.want)
+		}
+	}
+}
+
+func TestInitOpenEventsEnableNUMA(t *testing.T) {
+	cpus, err := NodeCPUs(0)
+	if err != nil {
+		t.Skipf("no NUMA node 0: %v", err)
+	}
+	err, eventListNA, eventsInfo := InitOpenEventsEnableNUMA("cpu-clock", 0)
+	defer EventsDisableClose(eventsInfo)
+	if err != nil {
+		t.Skipf("can't open %v: %v", eventListNA, err)
+	}
+	if len(eventsInfo) != len(cpus) {
+		t.Fatalf("opened %d events, want one per CPU of %v", len(eventsInfo), cpus)
+	}
+	for i := range eventsInfo {
+		if err := eventsInfo[i].ReadEvent(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if sums := SumEvents(eventsInfo); sums["cpu-clock"] == 0 {
+		t.Errorf("SumEvents() = %v, want the time the CPUs ran", sums)
+	}
+
+	if err, _, _ := InitOpenEventsEnableNUMA("cpu-clock", 1<<20); err == nil {
+		t.Errorf("InitOpenEventsEnableNUMA() on a missing node succeeded")
+	}
+}
+
+func TestInitOpenEventsEnableNUMAErrors(t *testing.T) {
+	cpus, err := NodeCPUs(0)
+	if err != nil {
+		t.Skipf("no NUMA node 0: %v", err)
+	}
+	err, eventListNA, eventsInfo := InitOpenEventsEnableNUMA("cpu-clock", 0)
+	EventsDisableClose(eventsInfo)
+	if err != nil {
+		t.Skipf("can't open %v: %v", eventListNA, err)
+	}
+	tests := []struct {
+		name  string
+		errno syscall.Errno
+		want  error
+	}{
+		{"EACCES", syscall.EACCES, PerfPermissionError},
+		{"EPERM", syscall.EPERM, PerfPermissionError},
+		{"ENOENT", syscall.ENOENT, PerfUnsupportedEvent},
+	}
+	for _, tt := range tests {
+		// Only the last CPU of the node fails.
+		last := cpus[len(cpus)-1]
+		mockPerfEventOpen(t, tt.errno, func(cpu int) bool { return cpu == last })
+		err, eventListNA, eventsInfo := InitOpenEventsEnableNUMA("cpu-clock", 0)
+		EventsDisableClose(eventsInfo)
+		if err != tt.want {
+			t.Errorf("%s: InitOpenEventsEnableNUMA() = %v, want %v", tt.name, err, tt.want)
+		}
+		if want := "cpu-clock@cpu" + strconv.Itoa(last); len(eventListNA) != 1 || eventListNA[0] != want {
+			t.Errorf("%s: events not opened %v, want %s", tt.name, eventListNA, want)
+		}
+	}
+}
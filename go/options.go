@@ -0,0 +1,134 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"errors"
+	"unsafe"
+)
+
+// Flags for the perf_event_open syscall (from linux/perf_event.h)
+// PERF_FLAG_FD_NO_GROUP : Use group_fd only for the output
+// redirection (PERF_FLAG_FD_OUTPUT), without joining its group.
+// PERF_FLAG_FD_OUTPUT : Redirect the sampled output of the event into
+// the mmap buffer of group_fd.
+// PERF_FLAG_PID_CGROUP : pid is a file descriptor to a cgroup directory,
+// the event monitors the cgroup.
+// PERF_FLAG_FD_CLOEXEC : Open the event with the close-on-exec flag.
+const (
+	PERF_FLAG_FD_NO_GROUP = 1 << 0
+	PERF_FLAG_FD_OUTPUT   = 1 << 1
+	PERF_FLAG_PID_CGROUP  = 1 << 2
+	PERF_FLAG_FD_CLOEXEC  = 1 << 3
+)
+
+// Sizes of the successive ABI versions of perf_event_attr (from
+// linux/perf_event.h). The kernel tells the version of the attributes it
+// is given by their size.
+const (
+	PERF_ATTR_SIZE_VER0 = 64
+	PERF_ATTR_SIZE_VER1 = 72
+	PERF_ATTR_SIZE_VER2 = 80
+	PERF_ATTR_SIZE_VER3 = 96
+	PERF_ATTR_SIZE_VER4 = 104
+	PERF_ATTR_SIZE_VER5 = 112
+	PERF_ATTR_SIZE_VER6 = 120
+	PERF_ATTR_SIZE_VER7 = 128
+	PERF_ATTR_SIZE_VER8 = 136
+)
+
+var PerfInvalidAttrSize = errors.New("attributes size not a supported ABI version")
+
+// EventOptions holds the options for opening events.
+// Flags : PERF_FLAG_* flags passed as is to the perf_event_open syscall.
+// Inherit : Count the threads and processes created by the monitored
+// thread after the event has been opened as well.
+// InheritStat : Along with Inherit, have the kernel keep the counts of
+// every exiting child, as reported in the PERF_RECORD_READ records of the
+// event when it is sampled, rather than just adding them to the parent
+// counts. Reads on the event still return the total counts.
+// EnableOnExec : Leave the event disabled until the monitored thread
+// calls exec. Along with Inherit, this is used to count a command
+// started by the calling thread.
+// Disabled : Leave the events disabled once opened, to enable them all at
+// once later on with EventsEnableSync.
+// Exclusive : Reserve the PMU for the event (or its group), so that it
+// is never multiplexed with other events. Opening the event fails with
+// PerfBusyError if the PMU is already in use.
+// NonBlock : Open the event file descriptor in non-blocking mode, so that
+// reads return right away when there is no data yet, e.g. in a loop
+// polling many events.
+// AttrSize : Size of the attributes given to the kernel, i.e., their ABI
+// version, one of the PERF_ATTR_SIZE_VER* sizes up to the size of
+// PerfEventAttr. Defaults to the size of PerfEventAttr.
+// ReopenOnBadFd : Have ReadEvent reopen the event if its descriptor has
+// been closed behind its back, see PerfEventInfo.ReopenOnBadFd.
+// ReadFormat : PERF_FORMAT_* bits selecting what the reads of the event
+// return besides its count, e.g. PERF_FORMAT_LOST. PERF_FORMAT_LOST is
+// dropped on the kernels not supporting it (before Linux 6.0), which
+// PerfEventInfo.ReadFormat tells, the event being opened without it.
+type EventOptions struct {
+	Flags         uint64
+	Inherit       bool
+	InheritStat   bool
+	EnableOnExec  bool
+	Disabled      bool
+	Exclusive     bool
+	NonBlock      bool
+	AttrSize      uint32
+	ReopenOnBadFd bool
+	ReadFormat    uint64
+}
+
+// apply sets the properties of "eventAttr" as per the options.
+func (opts EventOptions) apply(eventAttr *PerfEventAttr) error {
+	if opts.AttrSize != 0 {
+		err := eventAttr.SetSize(opts.AttrSize)
+		if err != nil {
+			return err
+		}
+	}
+	if opts.Inherit {
+		eventAttr.Bits = setBit(eventAttr.Bits, INHERIT)
+	}
+	if opts.InheritStat {
+		eventAttr.Bits = setBit(eventAttr.Bits, INHERIT_STAT)
+	}
+	if opts.EnableOnExec {
+		eventAttr.Bits = setBit(eventAttr.Bits, ENABLE_ON_EXEC)
+	}
+	if opts.Exclusive {
+		eventAttr.Bits = setBit(eventAttr.Bits, EXCLUSIVE)
+	}
+	eventAttr.Read_format |= opts.ReadFormat
+	return nil
+}
+
+// SetSize sets the size of the attributes given to the kernel, i.e.,
+// their ABI version. "size" must be one of the PERF_ATTR_SIZE_VER* sizes
+// and can't be larger than PerfEventAttr.
+func (eventAttr *PerfEventAttr) SetSize(size uint32) error {
+	err := checkAttrSize(size)
+	if err != nil {
+		return err
+	}
+	eventAttr.Size = size
+	return nil
+}
+
+// checkAttrSize checks that "size" is the size of an ABI version of the
+// attributes, which isn't larger than PerfEventAttr.
+func checkAttrSize(size uint32) error {
+	switch size {
+	case PERF_ATTR_SIZE_VER0, PERF_ATTR_SIZE_VER1, PERF_ATTR_SIZE_VER2,
+		PERF_ATTR_SIZE_VER3, PERF_ATTR_SIZE_VER4, PERF_ATTR_SIZE_VER5,
+		PERF_ATTR_SIZE_VER6, PERF_ATTR_SIZE_VER7, PERF_ATTR_SIZE_VER8:
+	default:
+		return PerfInvalidAttrSize
+	}
+	if uintptr(size) > unsafe.Sizeof(PerfEventAttr{}) {
+		return PerfInvalidAttrSize
+	}
+	return nil
+}
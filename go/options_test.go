@@ -0,0 +1,164 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"runtime"
+	"syscall"
+	"testing"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestEventOptionsApply(t *testing.T) {
+	tests := []struct {
+		name string
+		opts EventOptions
+		bits uint64
+	}{
+		{"none", EventOptions{}, 0},
+		{"inherit", EventOptions{Inherit: true}, 1 << INHERIT},
+		{"inherit stat", EventOptions{Inherit: true, InheritStat: true}, 1<<INHERIT | 1<<INHERIT_STAT},
+		{"enable on exec", EventOptions{EnableOnExec: true}, 1 << ENABLE_ON_EXEC},
+		{"exclusive", EventOptions{Exclusive: true}, 1 << EXCLUSIVE},
+		// The options handled when opening the events don't change
+		// the attributes.
+		{"not attributes", EventOptions{Disabled: true, NonBlock: true, ReopenOnBadFd: true, Flags: PERF_FLAG_FD_CLOEXEC}, 0},
+	}
+	const optionBits = 1<<INHERIT | 1<<INHERIT_STAT | 1<<ENABLE_ON_EXEC | 1<<EXCLUSIVE
+	for _, tt := range tests {
+		eventAttr := setupPerfEventAttr(EventConfigType{PERF_TYPE_SOFTWARE, PERF_COUNT_SW_TASK_CLOCK})
+		before := eventAttr
+		if err := tt.opts.apply(&eventAttr); err != nil {
+			t.Errorf("%s: apply() = %v", tt.name, err)
+			continue
+		}
+		if bits := eventAttr.Bits & optionBits; bits != tt.bits {
+			t.Errorf("%s: apply() set the bits %#x, want %#x", tt.name, bits, tt.bits)
+		}
+		if eventAttr.Bits&^optionBits != before.Bits || eventAttr.Size != before.Size || eventAttr.Read_format != before.Read_format {
+			t.Errorf("%s: apply() = %+v, from %+v", tt.name, eventAttr, before)
+		}
+	}
+
+	eventAttr := setupPerfEventAttr(EventConfigType{PERF_TYPE_SOFTWARE, PERF_COUNT_SW_TASK_CLOCK})
+	opts := EventOptions{AttrSize: PERF_ATTR_SIZE_VER5, ReadFormat: PERF_FORMAT_ID}
+	if err := opts.apply(&eventAttr); err != nil {
+		t.Fatal(err)
+	}
+	if eventAttr.Size != PERF_ATTR_SIZE_VER5 || eventAttr.Read_format != formatTimes|PERF_FORMAT_ID {
+		t.Errorf("apply() set the size %d, read format %#x", eventAttr.Size, eventAttr.Read_format)
+	}
+	if err := (EventOptions{AttrSize: 100}).apply(&eventAttr); err != PerfInvalidAttrSize {
+		t.Errorf("apply() of an invalid size = %v, want %v", err, PerfInvalidAttrSize)
+	}
+}
+
+func TestSetSize(t *testing.T) {
+	tests := []struct {
+		size uint32
+		err  error
+	}{
+		{PERF_ATTR_SIZE_VER0, nil},
+		{PERF_ATTR_SIZE_VER1, nil},
+		{PERF_ATTR_SIZE_VER2, nil},
+		{PERF_ATTR_SIZE_VER3, nil},
+		{PERF_ATTR_SIZE_VER4, nil},
+		{PERF_ATTR_SIZE_VER5, nil},
+		{PERF_ATTR_SIZE_VER6, nil},
+		{PERF_ATTR_SIZE_VER7, nil},
+		{0, PerfInvalidAttrSize},
+		{100, PerfInvalidAttrSize},
+		{1024, PerfInvalidAttrSize},
+	}
+	if unsafe.Sizeof(PerfEventAttr{}) < PERF_ATTR_SIZE_VER8 {
+		tests = append(tests, struct {
+			size uint32
+			err  error
+		}{PERF_ATTR_SIZE_VER8, PerfInvalidAttrSize})
+	}
+	for _, tt := range tests {
+		eventAttr := setupPerfEventAttr(EventConfigType{PERF_TYPE_SOFTWARE, 0})
+		err := eventAttr.SetSize(tt.size)
+		if err != tt.err {
+			t.Errorf("SetSize(%d) = %v, want %v", tt.size, err, tt.err)
+		}
+		if err == nil && eventAttr.Size != tt.size {
+			t.Errorf("SetSize(%d) set the size to %d", tt.size, eventAttr.Size)
+		}
+	}
+}
+
+// The kernel takes the attributes of any ABI version up to its own.
+func TestOpenAttrSize(t *testing.T) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	EventsDisableClose(openOrSkip(t, "page-faults", EventOptions{}))
+
+	for _, size := range []uint32{PERF_ATTR_SIZE_VER0, PERF_ATTR_SIZE_VER3, PERF_ATTR_SIZE_VER5} {
+		err, _, eventsInfo := InitOpenEventsEnableSelfWithOptions("page-faults", EventOptions{AttrSize: size})
+		if err != nil {
+			t.Errorf("opening with size %d: %v", size, err)
+			continue
+		}
+		touchPages(16)
+		if err := EventsRead(eventsInfo); err != nil || eventsInfo[0].Data < 16 {
+			t.Errorf("size %d: read %d, %v", size, eventsInfo[0].Data, err)
+		}
+		EventsDisableClose(eventsInfo)
+	}
+}
+
+func TestOpenExclusive(t *testing.T) {
+	// The attributes the event is opened with.
+	var opened unix.PerfEventAttr
+	open := perfEventOpen
+	perfEventOpen = func(attr *unix.PerfEventAttr, pid int, cpu int, groupFd int, flags int) (int, error) {
+		opened = *attr
+		return open(attr, pid, cpu, groupFd, flags)
+	}
+	t.Cleanup(func() { perfEventOpen = open })
+
+	for _, exclusive := range []bool{false, true} {
+		eventsInfo := openOrSkip(t, "task-clock", EventOptions{Exclusive: exclusive})
+		EventsDisableClose(eventsInfo)
+		if got := opened.Bits&(1<<EXCLUSIVE) != 0; got != exclusive {
+			t.Errorf("Exclusive %v opened the event exclusive: %v", exclusive, got)
+		}
+	}
+}
+
+func TestOpenExclusiveBusy(t *testing.T) {
+	// The PMU is in use.
+	mockPerfEventOpen(t, syscall.EBUSY, func(int) bool { return true })
+	event := PerfEventInfo{Fd: -1}
+	if err := event.InitOpenEventEnableSelfWithOptions("task-clock", EventOptions{Exclusive: true}); err != PerfBusyError {
+		t.Errorf("InitOpenEventEnableSelfWithOptions() = %v, want %v", err, PerfBusyError)
+	}
+	if event.Fd != -1 {
+		t.Errorf("Fd = %d, want -1", event.Fd)
+	}
+}
+
+func TestOpenFlags(t *testing.T) {
+	tests := []struct {
+		flags   uint64
+		cloexec bool
+	}{
+		{0, false},
+		{PERF_FLAG_FD_CLOEXEC, true},
+	}
+	for _, tt := range tests {
+		eventsInfo := openOrSkip(t, "task-clock", EventOptions{Flags: tt.flags})
+		fdFlags, err := unix.FcntlInt(uintptr(eventsInfo[0].Fd), unix.F_GETFD, 0)
+		EventsDisableClose(eventsInfo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cloexec := fdFlags&unix.FD_CLOEXEC != 0; cloexec != tt.cloexec {
+			t.Errorf("Flags %#x opened the event close-on-exec: %v, want %v", tt.flags, cloexec, tt.cloexec)
+		}
+	}
+}
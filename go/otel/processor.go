@@ -0,0 +1,131 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+// Package otel records perf event counts on OpenTelemetry spans, as the
+// perfevents observer does on OpenTracing spans.
+package otel
+
+import (
+	"context"
+	"sync"
+
+	"github.com/opentracing-contrib/perfevents/go"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// EventsAttribute is the span attribute, set when the span is started,
+// listing the events to count, e.g. "cpu-cycles,instructions".
+const EventsAttribute = "perfevents"
+
+// SpanProcessor is an sdktrace.SpanProcessor opening the events a span
+// requests when it starts, and recording their counts as the attributes
+// "perfevents.<event>" when it ends.
+// A span can't be modified anymore when it ends, so the processor wraps
+// the one exporting the spans, e.g. a batch span processor, passing it
+// the span with the counts added to its attributes.
+// As with the observer, the events count the thread starting the span,
+// which should be the one ending it.
+type SpanProcessor struct {
+	next   sdktrace.SpanProcessor
+	mu     sync.Mutex
+	events map[trace.SpanID][]perfevents.PerfEventInfo
+}
+
+var _ sdktrace.SpanProcessor = (*SpanProcessor)(nil)
+
+// NewSpanProcessor creates a new SpanProcessor handing the spans over to
+// "next", to be registered with sdktrace.WithSpanProcessor in its stead.
+func NewSpanProcessor(next sdktrace.SpanProcessor) *SpanProcessor {
+	return &SpanProcessor{
+		next:   next,
+		events: make(map[trace.SpanID][]perfevents.PerfEventInfo),
+	}
+}
+
+// OnStart opens the events listed in the EventsAttribute of the span.
+func (p *SpanProcessor) OnStart(parent context.Context, s sdktrace.ReadWriteSpan) {
+	p.next.OnStart(parent, s)
+
+	var events string
+	for _, kv := range s.Attributes() {
+		if kv.Key == EventsAttribute {
+			events = kv.Value.AsString()
+		}
+	}
+	if events == "" {
+		return
+	}
+
+	_, _, eventsInfo := perfevents.InitOpenEventsEnableSelf(events)
+	if len(eventsInfo) == 0 {
+		return
+	}
+	p.mu.Lock()
+	p.events[s.SpanContext().SpanID()] = eventsInfo
+	p.mu.Unlock()
+}
+
+// OnEnd reads and closes the events of the span, and passes the span on
+// with their counts.
+func (p *SpanProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	eventsInfo := p.take(s.SpanContext().SpanID())
+	if eventsInfo == nil {
+		p.next.OnEnd(s)
+		return
+	}
+
+	err := perfevents.EventsRead(eventsInfo)
+	perfevents.EventsDisableClose(eventsInfo)
+	if err != nil {
+		p.next.OnEnd(s)
+		return
+	}
+
+	attrs := s.Attributes()
+	for _, event := range eventsInfo {
+		// In any case of an error for an event, event.EventName
+		// will contain "" for an event.
+		if event.EventName != "" {
+			attrs = append(attrs, attribute.Int64(EventsAttribute+"."+event.EventName, int64(event.Data)))
+		}
+	}
+	p.next.OnEnd(countedSpan{s, attrs})
+}
+
+// Shutdown closes the events of the spans yet to end, and shuts down the
+// next processor.
+func (p *SpanProcessor) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	for id, eventsInfo := range p.events {
+		perfevents.EventsDisableClose(eventsInfo)
+		delete(p.events, id)
+	}
+	p.mu.Unlock()
+	return p.next.Shutdown(ctx)
+}
+
+// ForceFlush flushes the next processor.
+func (p *SpanProcessor) ForceFlush(ctx context.Context) error {
+	return p.next.ForceFlush(ctx)
+}
+
+// take removes the events of the span "id" from the processor.
+func (p *SpanProcessor) take(id trace.SpanID) []perfevents.PerfEventInfo {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	eventsInfo := p.events[id]
+	delete(p.events, id)
+	return eventsInfo
+}
+
+// countedSpan is an ended span along with the counts of its events.
+type countedSpan struct {
+	sdktrace.ReadOnlySpan
+	attrs []attribute.KeyValue
+}
+
+func (s countedSpan) Attributes() []attribute.KeyValue {
+	return s.attrs
+}
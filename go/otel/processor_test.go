@@ -0,0 +1,141 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package otel
+
+import (
+	"context"
+	"runtime"
+	"testing"
+
+	"github.com/opentracing-contrib/perfevents/go"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// newTracer returns a tracer the spans of which go through a
+// SpanProcessor, and then to the returned in-memory recorder.
+func newTracer(t *testing.T) (trace.Tracer, *SpanProcessor, *tracetest.SpanRecorder) {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	processor := NewSpanProcessor(recorder)
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(processor))
+	t.Cleanup(func() { provider.Shutdown(context.Background()) })
+	return provider.Tracer("perfevents"), processor, recorder
+}
+
+// skipWithoutPerf skips the test if the events "events" can't be opened.
+func skipWithoutPerf(t *testing.T, events string) {
+	t.Helper()
+	err, eventListNA, eventsInfo := perfevents.InitOpenEventsEnableSelf(events)
+	perfevents.EventsDisableClose(eventsInfo)
+	if err != nil {
+		t.Skipf("can't open %v: %v", eventListNA, err)
+	}
+}
+
+// spanAttributes returns the attributes of the span "s" by key.
+func spanAttributes(s sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range s.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func TestSpanProcessor(t *testing.T) {
+	skipWithoutPerf(t, "task-clock,page-faults")
+	tracer, processor, recorder := newTracer(t)
+
+	// The events count the thread starting and ending the span.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	_, span := tracer.Start(context.Background(), "counted",
+		trace.WithAttributes(attribute.String(EventsAttribute, "task-clock,page-faults,not-an-event")))
+	buf := make([]byte, 1<<20)
+	for i := range buf {
+		buf[i] = 1
+	}
+	span.End()
+
+	ended := recorder.Ended()
+	if len(ended) != 1 {
+		t.Fatalf("recorded %d spans, want 1", len(ended))
+	}
+	attrs := spanAttributes(ended[0])
+	if attrs[EventsAttribute].AsString() != "task-clock,page-faults,not-an-event" {
+		t.Errorf("%s attribute %q", EventsAttribute, attrs[EventsAttribute].AsString())
+	}
+	for _, event := range []string{"task-clock", "page-faults"} {
+		value, ok := attrs[attribute.Key(EventsAttribute+"."+event)]
+		if !ok || value.AsInt64() <= 0 {
+			t.Errorf("%s counted %v, %t", event, value.AsInt64(), ok)
+		}
+	}
+	if _, ok := attrs[EventsAttribute+".not-an-event"]; ok {
+		t.Error("not-an-event counted")
+	}
+	if len(processor.events) != 0 {
+		t.Errorf("%d spans left open", len(processor.events))
+	}
+}
+
+func TestSpanProcessorNoEvents(t *testing.T) {
+	tracer, processor, recorder := newTracer(t)
+
+	tests := []struct {
+		name  string
+		attrs []attribute.KeyValue
+	}{
+		{"no events", nil},
+		{"empty events", []attribute.KeyValue{attribute.String(EventsAttribute, "")}},
+		{"unsupported events", []attribute.KeyValue{attribute.String(EventsAttribute, "not-an-event")}},
+	}
+	for _, tt := range tests {
+		_, span := tracer.Start(context.Background(), tt.name, trace.WithAttributes(tt.attrs...))
+		if len(processor.events) != 0 {
+			t.Errorf("%s: events opened", tt.name)
+		}
+		span.End()
+	}
+
+	ended := recorder.Ended()
+	if len(ended) != len(tests) {
+		t.Fatalf("recorded %d spans, want %d", len(ended), len(tests))
+	}
+	for i, s := range ended {
+		if len(s.Attributes()) != len(tests[i].attrs) {
+			t.Errorf("%s: attributes %v, want %v", tests[i].name, s.Attributes(), tests[i].attrs)
+		}
+	}
+}
+
+func TestSpanProcessorShutdown(t *testing.T) {
+	skipWithoutPerf(t, "task-clock")
+	tracer, processor, recorder := newTracer(t)
+
+	_, span := tracer.Start(context.Background(), "pending",
+		trace.WithAttributes(attribute.String(EventsAttribute, "task-clock")))
+	if len(processor.events) != 1 {
+		t.Fatalf("%d spans counted, want 1", len(processor.events))
+	}
+	if err := processor.ForceFlush(context.Background()); err != nil {
+		t.Errorf("ForceFlush() = %v", err)
+	}
+	if err := processor.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(processor.events) != 0 {
+		t.Errorf("%d spans left open", len(processor.events))
+	}
+
+	// The span ended after the shutdown isn't counted.
+	span.End()
+	for _, s := range recorder.Ended() {
+		if _, ok := spanAttributes(s)[EventsAttribute+".task-clock"]; ok {
+			t.Error("span counted after the shutdown")
+		}
+	}
+}
@@ -0,0 +1,31 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package otobserver
+
+import (
+	perfevents "github.com/opentracing-contrib/perfevents/go"
+)
+
+// The tag naming the cgroup the events of a span count, e.g. the cgroup
+// of a tenant, rather than the thread starting the span, see
+// perfevents.InitOpenEventsEnableCgroup.
+const cgroupTag = "perfevents.cgroup"
+
+// sumCPUEvents sums the counts of the per CPU events of a cgroup, by
+// event, in the order of the events.
+func sumCPUEvents(events []perfevents.PerfEventInfo) []perfevents.PerfEventInfo {
+	sums := make([]perfevents.PerfEventInfo, 0, len(events))
+	index := make(map[string]int)
+	for _, event := range events {
+		if i, ok := index[event.EventName]; ok {
+			sums[i].Data += event.Data
+			sums[i].TimeEnabled += event.TimeEnabled
+			sums[i].TimeRunning += event.TimeRunning
+			continue
+		}
+		index[event.EventName] = len(sums)
+		sums = append(sums, event)
+	}
+	return sums
+}
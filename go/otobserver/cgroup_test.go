@@ -0,0 +1,68 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package otobserver
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	perfevents "github.com/opentracing-contrib/perfevents/go"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+func TestSumCPUEvents(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []perfevents.PerfEventInfo
+		want   []perfevents.PerfEventInfo
+	}{
+		{"by event, in order", []perfevents.PerfEventInfo{
+			{EventName: "task-clock", Data: 10, TimeEnabled: 100, TimeRunning: 100},
+			{EventName: "page-faults", Data: 1, TimeEnabled: 100, TimeRunning: 50},
+			{EventName: "task-clock", Data: 20, TimeEnabled: 100, TimeRunning: 100},
+			{EventName: "page-faults", Data: 2, TimeEnabled: 100, TimeRunning: 50},
+		}, []perfevents.PerfEventInfo{
+			{EventName: "task-clock", Data: 30, TimeEnabled: 200, TimeRunning: 200},
+			{EventName: "page-faults", Data: 3, TimeEnabled: 200, TimeRunning: 100},
+		}},
+		{"one CPU", []perfevents.PerfEventInfo{
+			{EventName: "task-clock", Data: 10},
+		}, []perfevents.PerfEventInfo{
+			{EventName: "task-clock", Data: 10},
+		}},
+		{"none", nil, []perfevents.PerfEventInfo{}},
+	}
+	for _, tt := range tests {
+		if got := sumCPUEvents(tt.events); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: sumCPUEvents() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSpanCgroup(t *testing.T) {
+	skipWithoutPerf(t)
+	// The cgroup goes first, whatever the order of the tags.
+	tracer := mocktracer.New()
+	sp, so, ok := startSpan(NewObserver(), tracer, opentracing.Tags{
+		"perfevents": "task-clock",
+		cgroupTag:    "/",
+	})
+	if !ok {
+		t.Fatal("span not observed")
+	}
+	if so.cgroup != "/" {
+		t.Errorf("the span counts the cgroup %q, want /", so.cgroup)
+	}
+	opened := len(so.EventDescs)
+	so.OnFinish(opentracing.FinishOptions{})
+	if opened == 0 {
+		t.Skip("can't count the root cgroup")
+	}
+	// The counts of all the CPUs are logged once.
+	if logs := spanLogs(sp); len(logs) != 1 || !strings.HasPrefix(logs[0], "task-clock:") {
+		t.Errorf("logged %q, want the sum of task-clock", logs)
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package otobserver
+
+import (
+	"errors"
+	"strings"
+
+	perfevents "github.com/opentracing-contrib/perfevents/go"
+	"github.com/opentracing/opentracing-go"
+)
+
+var PerfInvalidObserverConfig = errors.New("invalid observer configuration")
+var PerfTooManyOpenFDs = errors.New("too many counters open for the observer")
+
+// The tag, or baggage item, listing the events a span requests.
+const defaultTagKey = "perfevents"
+
+// Sink receives the counts of the events of every span the observer
+// measured when the span finishes, e.g. to export them as metrics.
+type Sink interface {
+	Emit(sp opentracing.Span, events []perfevents.PerfEventInfo)
+}
+
+// ObserverConfig holds the configuration of an observer.
+// TagKey : Tag, or baggage item, listing the events a span requests.
+// Defaults to "perfevents".
+// DefaultEvents : Events counted for the spans which don't request any.
+// Defaults to the events of the PERFEVENTS environment variable, see
+// NewObserver.
+// AsTags : Set the counts as tags of the spans rather than logging them.
+// Sink : If set, receives the counts of every span along with the span.
+// MaxOpenFDs : Maximum number of counters open at once, the spans
+// requesting more not being measured, 0 for no limit.
+// Disabled : Don't measure any span, the zero value measuring them.
+// ErrorHandler : If set, called with every error the observer runs into,
+// see SetErrorHandler.
+// Inherit : Count the threads and processes created during the spans too,
+// see SetInherit.
+type ObserverConfig struct {
+	TagKey        string
+	DefaultEvents []string
+	AsTags        bool
+	Sink          Sink
+	MaxOpenFDs    int
+	Disabled      bool
+	ErrorHandler  func(error)
+	Inherit       bool
+}
+
+// NewObserverFromConfig creates a new observer as per "config". The
+// default events must be supported.
+func NewObserverFromConfig(config ObserverConfig) (*Observer, error) {
+	if config.MaxOpenFDs < 0 {
+		return nil, PerfInvalidObserverConfig
+	}
+	defaultEvents := strings.Join(config.DefaultEvents, ",")
+	if defaultEvents != "" {
+		err := perfevents.ValidateEvents(defaultEvents)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	o := NewObserver()
+	o.tagKey = config.TagKey
+	if defaultEvents != "" {
+		o.defaultEvents = defaultEvents
+	}
+	o.asTags = config.AsTags
+	o.sink = config.Sink
+	o.maxOpenFDs = config.MaxOpenFDs
+	o.disabled = config.Disabled
+	o.errorHandler = config.ErrorHandler
+	o.inherit = config.Inherit
+	return o, nil
+}
+
+// SetDefaultEvents sets the events counted for the spans which don't
+// request any, e.g. on a configuration update, none for an empty list.
+// The spans already started keep counting the events they started with.
+// The events must be supported.
+func (o *Observer) SetDefaultEvents(events []string) error {
+	defaultEvents := strings.Join(events, ",")
+	if defaultEvents != "" {
+		err := perfevents.ValidateEvents(defaultEvents)
+		if err != nil {
+			return err
+		}
+	}
+	o.mu.Lock()
+	o.defaultEvents = defaultEvents
+	o.mu.Unlock()
+	return nil
+}
+
+// defaultEventList returns the events counted for the spans which don't
+// request any.
+func (o *Observer) defaultEventList() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.defaultEvents
+}
+
+// Environment variable holding the default events of the observers.
+const defaultEventsEnv = "PERFEVENTS"
+
+// eventsTag returns the tag listing the events a span requests.
+func (o *Observer) eventsTag() string {
+	if o.tagKey == "" {
+		return defaultTagKey
+	}
+	return o.tagKey
+}
+
+// reserveFDs accounts for "n" more counters open, unless it would take
+// the observer beyond MaxOpenFDs.
+func (o *Observer) reserveFDs(n int) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.maxOpenFDs > 0 && o.openFDs+n > o.maxOpenFDs {
+		return false
+	}
+	o.openFDs += n
+	return true
+}
+
+// releaseFDs accounts for "n" counters closed.
+func (o *Observer) releaseFDs(n int) {
+	o.mu.Lock()
+	o.openFDs -= n
+	o.mu.Unlock()
+}
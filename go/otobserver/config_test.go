@@ -0,0 +1,212 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package otobserver
+
+import (
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	perfevents "github.com/opentracing-contrib/perfevents/go"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+// openedEvents returns the names of the events the span observer "so"
+// opened, comma separated.
+func openedEvents(so *SpanObserver) string {
+	names := make([]string, len(so.EventDescs))
+	for i, event := range so.EventDescs {
+		names[i] = event.EventName
+	}
+	return strings.Join(names, ",")
+}
+
+func TestNewObserverFromConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config ObserverConfig
+		err    error
+	}{
+		{"empty", ObserverConfig{}, nil},
+		{"default events", ObserverConfig{DefaultEvents: []string{"task-clock", "{cpu-clock,page-faults}"}}, nil},
+		{"unsupported default event", ObserverConfig{DefaultEvents: []string{"task-clock", "not-an-event"}}, perfevents.PerfUnsupportedEvent},
+		{"bad default events", ObserverConfig{DefaultEvents: []string{"{task-clock"}}, perfevents.PerfEventListSyntax},
+		{"max open fds", ObserverConfig{MaxOpenFDs: 4}, nil},
+		{"negative max open fds", ObserverConfig{MaxOpenFDs: -1}, PerfInvalidObserverConfig},
+	}
+	for _, tt := range tests {
+		o, err := NewObserverFromConfig(tt.config)
+		if err != tt.err {
+			t.Errorf("%s: NewObserverFromConfig() = %v, want %v", tt.name, err, tt.err)
+		}
+		if (o == nil) != (tt.err != nil) {
+			t.Errorf("%s: NewObserverFromConfig() = %v, %v", tt.name, o, err)
+		}
+	}
+
+	// A disabled observer doesn't observe any span.
+	o, _ := NewObserverFromConfig(ObserverConfig{DefaultEvents: []string{"task-clock"}, Disabled: true})
+	if _, _, ok := startSpan(o, mocktracer.New(), nil); ok {
+		t.Error("disabled observer observed a span")
+	}
+}
+
+func TestNewObserverFromZeroConfig(t *testing.T) {
+	skipWithoutPerf(t)
+	// The zero value measures the spans.
+	o, err := NewObserverFromConfig(ObserverConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sp, so, ok := startSpan(o, mocktracer.New(), opentracing.Tags{"perfevents": "task-clock"})
+	if !ok || len(so.EventDescs) != 1 {
+		t.Fatal("span not measured with the zero config")
+	}
+	so.OnFinish(opentracing.FinishOptions{})
+	if logs := spanLogs(sp); len(logs) != 1 || !strings.HasPrefix(logs[0], "task-clock:") {
+		t.Errorf("logged %q, want task-clock", logs)
+	}
+}
+
+func TestObserverTagKey(t *testing.T) {
+	skipWithoutPerf(t)
+	o, err := NewObserverFromConfig(ObserverConfig{TagKey: "perf"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	if _, _, ok := startSpan(o, mocktracer.New(), opentracing.Tags{"perfevents": "task-clock"}); ok {
+		t.Error("span observed for the default tag")
+	}
+	_, so, ok := startSpan(o, mocktracer.New(), opentracing.Tags{"perf": "task-clock"})
+	if !ok || openedEvents(so) != "task-clock" {
+		t.Fatalf("span observed %t, for %v", ok, so)
+	}
+	so.OnFinish(opentracing.FinishOptions{})
+}
+
+func TestObserverEnvDefaultEvents(t *testing.T) {
+	skipWithoutPerf(t)
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	tests := []struct {
+		env    string
+		config []string
+		opened string
+	}{
+		{"task-clock,page-faults", nil, "task-clock,page-faults"},
+		{"task-clock,page-faults", []string{"cpu-clock"}, "cpu-clock"},
+		// Invalid events in the environment are ignored.
+		{"task-clock,not-an-event", nil, ""},
+		{"", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Setenv(defaultEventsEnv, tt.env)
+		o, err := NewObserverFromConfig(ObserverConfig{DefaultEvents: tt.config})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, so, ok := startSpan(o, mocktracer.New(), nil)
+		if ok != (tt.opened != "") {
+			t.Errorf("PERFEVENTS=%s, %v: span observed %t", tt.env, tt.config, ok)
+		}
+		if ok && openedEvents(so) != tt.opened {
+			t.Errorf("PERFEVENTS=%s, %v: opened %q, want %q", tt.env, tt.config, openedEvents(so), tt.opened)
+		}
+		if so != nil {
+			so.OnFinish(opentracing.FinishOptions{})
+		}
+	}
+}
+
+func TestSetDefaultEvents(t *testing.T) {
+	skipWithoutPerf(t)
+	o := NewObserver()
+	if err := o.SetDefaultEvents([]string{"task-clock", "not-an-event"}); err != perfevents.PerfUnsupportedEvent {
+		t.Errorf("SetDefaultEvents() of an unsupported event = %v", err)
+	}
+	if err := o.SetDefaultEvents([]string{"task-clock"}); err != nil {
+		t.Fatal(err)
+	}
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	tracer := mocktracer.New()
+	_, before, ok := startSpan(o, tracer, nil)
+	if !ok {
+		t.Fatal("span not observed")
+	}
+
+	// The span already started keeps counting its events.
+	if err := o.SetDefaultEvents([]string{"page-faults"}); err != nil {
+		t.Fatal(err)
+	}
+	_, after, ok := startSpan(o, tracer, nil)
+	if !ok {
+		t.Fatal("span not observed")
+	}
+	if openedEvents(before) != "task-clock" || openedEvents(after) != "page-faults" {
+		t.Errorf("spans opened %q and %q, want task-clock and page-faults", openedEvents(before), openedEvents(after))
+	}
+	before.OnFinish(opentracing.FinishOptions{})
+	after.OnFinish(opentracing.FinishOptions{})
+
+	if err := o.SetDefaultEvents(nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := startSpan(o, tracer, nil); ok {
+		t.Error("span observed without default events")
+	}
+}
+
+// The default events can be changed while spans start and finish.
+func TestSetDefaultEventsConcurrent(t *testing.T) {
+	skipWithoutPerf(t)
+	o := NewObserver()
+	lists := [][]string{{"task-clock"}, {"page-faults"}, {"task-clock", "page-faults"}, nil}
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runtime.LockOSThread()
+			defer runtime.UnlockOSThread()
+			tracer := mocktracer.New()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				sp, so, ok := startSpan(o, tracer, nil)
+				if !ok {
+					continue
+				}
+				so.OnFinish(opentracing.FinishOptions{})
+				for _, log := range spanLogs(sp) {
+					if !strings.HasPrefix(log, "task-clock:") && !strings.HasPrefix(log, "page-faults:") {
+						t.Errorf("logged %q", log)
+					}
+				}
+			}
+		}()
+	}
+	for i := 0; i < 200; i++ {
+		if err := o.SetDefaultEvents(lists[i%len(lists)]); err != nil {
+			t.Error(err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+	if active := o.DumpActive(); len(active) != 0 {
+		t.Errorf("%d counters left open", len(active))
+	}
+}
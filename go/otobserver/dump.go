@@ -0,0 +1,69 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package otobserver
+
+import perfevents "github.com/opentracing-contrib/perfevents/go"
+
+// ActiveCounter is the state of a counter open by an observer.
+// EventName, Fd, Pid, Cpu, Enabled : as in PerfEventInfo.
+// Value : Count of the event when it was dumped, or its last count read
+// if it couldn't be read.
+// Quality : Fraction of its enabled time the counter actually counted, 1
+// meaning it wasn't multiplexed, or 0 if unknown, i.e., the read format
+// of the event doesn't have the total times.
+// Shared : Whether the counter is shared between spans.
+type ActiveCounter struct {
+	EventName string
+	Fd        int
+	Pid       int
+	Cpu       int
+	Enabled   bool
+	Value     uint64
+	Quality   float64
+	Shared    bool
+}
+
+// DumpActive returns the state of all the counters the observer has
+// open, for debugging. The counters aren't modified.
+func (o *Observer) DumpActive() []ActiveCounter {
+	counters := make([]ActiveCounter, 0)
+	o.mu.Lock()
+	for so := range o.active {
+		for i := range so.EventDescs {
+			counters = append(counters, dumpCounter(&so.EventDescs[i], false))
+		}
+	}
+	o.mu.Unlock()
+
+	if o.shared != nil {
+		o.shared.mu.Lock()
+		for _, counter := range o.shared.counters {
+			counters = append(counters, dumpCounter(&counter.event, true))
+		}
+		o.shared.mu.Unlock()
+	}
+	return counters
+}
+
+// dumpCounter reads the state of the counter of "event".
+func dumpCounter(event *perfevents.PerfEventInfo, shared bool) ActiveCounter {
+	counter := ActiveCounter{
+		EventName: event.EventName,
+		Fd:        event.Fd,
+		Pid:       event.Pid,
+		Cpu:       event.Cpu,
+		Enabled:   event.Enabled,
+		Value:     event.Data,
+		Shared:    shared,
+	}
+	values, err := event.PeekValues()
+	if err != nil {
+		return counter
+	}
+	counter.Value = values.Value
+	if values.TimeEnabled != 0 && event.ReadFormat&perfevents.PERF_FORMAT_TOTAL_TIME_RUNNING != 0 {
+		counter.Quality = float64(values.TimeRunning) / float64(values.TimeEnabled)
+	}
+	return counter
+}
@@ -0,0 +1,52 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package otobserver
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+func TestDumpActive(t *testing.T) {
+	skipWithoutPerf(t)
+	for _, shared := range []bool{false, true} {
+		o := NewObserver()
+		o.SetSharedCounters(shared)
+		if counters := o.DumpActive(); len(counters) != 0 {
+			t.Errorf("DumpActive() = %+v before any span", counters)
+		}
+
+		tracer := mocktracer.New()
+		_, so, ok := startSpan(o, tracer, opentracing.Tags{"perfevents": "task-clock,page-faults"})
+		if !ok {
+			t.Fatal("span not observed")
+		}
+		counters := o.DumpActive()
+		sort.Slice(counters, func(i, j int) bool { return counters[i].EventName < counters[j].EventName })
+		if len(counters) != 2 || counters[0].EventName != "page-faults" || counters[1].EventName != "task-clock" {
+			t.Fatalf("DumpActive() = %+v, want page-faults and task-clock", counters)
+		}
+		for _, counter := range counters {
+			if counter.Fd < 0 || !counter.Enabled || counter.Shared != shared ||
+				counter.Pid != 0 || counter.Cpu != -1 {
+				t.Errorf("DumpActive() = %+v", counter)
+			}
+			// The software events are never multiplexed.
+			if counter.Quality != 1 {
+				t.Errorf("%s quality = %v, want 1", counter.EventName, counter.Quality)
+			}
+		}
+		if counters[1].Value == 0 {
+			t.Errorf("task-clock = 0, want the time the span ran")
+		}
+
+		so.OnFinish(opentracing.FinishOptions{})
+		if counters := o.DumpActive(); len(counters) != 0 {
+			t.Errorf("DumpActive() = %+v once the span finished", counters)
+		}
+	}
+}
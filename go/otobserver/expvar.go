@@ -0,0 +1,42 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package otobserver
+
+import (
+	"expvar"
+	"sync"
+
+	perfevents "github.com/opentracing-contrib/perfevents/go"
+	"github.com/opentracing/opentracing-go"
+)
+
+// The counts are published once, expvar not allowing a name to be
+// published twice.
+var expvarCounts struct {
+	once sync.Once
+	m    *expvar.Map
+}
+
+// expvarSink adds the counts of the spans to the "perfevents" expvar.
+type expvarSink struct {
+	counts *expvar.Map
+}
+
+// NewExpvarSink creates a Sink adding up the counts of the events of
+// all the spans, by event, in the "perfevents" expvar map, served under
+// /debug/vars. The sinks all share the same map.
+func NewExpvarSink() Sink {
+	expvarCounts.once.Do(func() {
+		expvarCounts.m = expvar.NewMap("perfevents")
+	})
+	return expvarSink{expvarCounts.m}
+}
+
+func (s expvarSink) Emit(sp opentracing.Span, events []perfevents.PerfEventInfo) {
+	for _, event := range events {
+		if event.EventName != "" {
+			s.counts.Add(event.EventName, int64(event.Data))
+		}
+	}
+}
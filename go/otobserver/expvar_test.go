@@ -0,0 +1,67 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package otobserver
+
+import (
+	"expvar"
+	"testing"
+
+	perfevents "github.com/opentracing-contrib/perfevents/go"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+// expvarCount returns the count of "event" in the "perfevents" expvar.
+func expvarCount(event string) int64 {
+	m, ok := expvar.Get("perfevents").(*expvar.Map)
+	if !ok {
+		return 0
+	}
+	count, ok := m.Get(event).(*expvar.Int)
+	if !ok {
+		return 0
+	}
+	return count.Value()
+}
+
+func TestExpvarSink(t *testing.T) {
+	sinks := []Sink{NewExpvarSink(), NewExpvarSink()}
+	before := expvarCount("test-event")
+	tests := []struct {
+		events []perfevents.PerfEventInfo
+		want   int64
+	}{
+		{[]perfevents.PerfEventInfo{{EventName: "test-event", Data: 10}}, 10},
+		{[]perfevents.PerfEventInfo{{EventName: "test-event", Data: 5}, {EventName: "test-event", Data: 1}}, 16},
+		{[]perfevents.PerfEventInfo{{EventName: "", Data: 100}}, 16},
+		{nil, 16},
+	}
+	// The sinks add up to the same map.
+	for i, tt := range tests {
+		sinks[i%len(sinks)].Emit(nil, tt.events)
+		if got := expvarCount("test-event") - before; got != tt.want {
+			t.Errorf("Emit(%v) = %d, want %d", tt.events, got, tt.want)
+		}
+	}
+	if got := expvarCount(""); got != 0 {
+		t.Errorf("the events not opened added %d", got)
+	}
+}
+
+func TestExpvarSinkObserver(t *testing.T) {
+	skipWithoutPerf(t)
+	o, err := NewObserverFromConfig(ObserverConfig{Sink: NewExpvarSink()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := expvarCount("task-clock")
+	_, so, ok := startSpan(o, mocktracer.New(), opentracing.Tags{"perfevents": "task-clock"})
+	if !ok {
+		t.Fatal("span not observed")
+	}
+	so.OnFinish(opentracing.FinishOptions{})
+	if got := expvarCount("task-clock") - before; got <= 0 {
+		t.Errorf("task-clock added %d to the expvar, want its count", got)
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package otobserver
+
+import (
+	"sync"
+
+	perfevents "github.com/opentracing-contrib/perfevents/go"
+)
+
+// historyKey identifies the counts of an event for an operation.
+type historyKey struct {
+	operation string
+	event     string
+}
+
+// countRing holds the last counts of an event, "next" being where the
+// next count goes once the ring is full.
+type countRing struct {
+	counts []uint64
+	next   int
+}
+
+// countHistory keeps the last "size" counts of every event by operation.
+type countHistory struct {
+	mu    sync.Mutex
+	size  int
+	rings map[historyKey]*countRing
+}
+
+func newCountHistory(size int) *countHistory {
+	return &countHistory{size: size, rings: make(map[historyKey]*countRing)}
+}
+
+// add records the counts of the events of a span of "operation".
+func (h *countHistory) add(operation string, events []perfevents.PerfEventInfo) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, event := range events {
+		if event.EventName == "" {
+			continue
+		}
+		key := historyKey{operation, event.EventName}
+		ring, ok := h.rings[key]
+		if !ok {
+			ring = &countRing{counts: make([]uint64, 0, h.size)}
+			h.rings[key] = ring
+		}
+		if len(ring.counts) < h.size {
+			ring.counts = append(ring.counts, event.Data)
+			continue
+		}
+		ring.counts[ring.next] = event.Data
+		ring.next = (ring.next + 1) % h.size
+	}
+}
+
+// recent returns the counts of "event" for "operation", oldest first.
+func (h *countHistory) recent(operation string, event string) []uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ring, ok := h.rings[historyKey{operation, event}]
+	if !ok {
+		return nil
+	}
+	counts := make([]uint64, 0, len(ring.counts))
+	counts = append(counts, ring.counts[ring.next:]...)
+	return append(counts, ring.counts[:ring.next]...)
+}
+
+// SetHistorySize sets the number of counts kept for every event of every
+// operation, as returned by RecentCounts, e.g. to detect outliers. No
+// counts are kept with a size of 0, the default.
+func (o *Observer) SetHistorySize(size int) {
+	if size > 0 {
+		o.history = newCountHistory(size)
+	} else {
+		o.history = nil
+	}
+}
+
+// RecentCounts returns the last counts of the event "event" on the spans
+// of the operation "operation", oldest first, as per SetHistorySize.
+func (o *Observer) RecentCounts(operation, event string) []uint64 {
+	if o.history == nil {
+		return nil
+	}
+	return o.history.recent(operation, event)
+}
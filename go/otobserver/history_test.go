@@ -0,0 +1,76 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package otobserver
+
+import (
+	"reflect"
+	"testing"
+
+	perfevents "github.com/opentracing-contrib/perfevents/go"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+func TestCountHistory(t *testing.T) {
+	tests := []struct {
+		name   string
+		size   int
+		counts []uint64
+		want   []uint64
+	}{
+		{"one", 3, []uint64{1}, []uint64{1}},
+		{"full", 3, []uint64{1, 2, 3}, []uint64{1, 2, 3}},
+		{"wrapped", 3, []uint64{1, 2, 3, 4, 5}, []uint64{3, 4, 5}},
+		{"wrapped twice", 2, []uint64{1, 2, 3, 4, 5, 6}, []uint64{5, 6}},
+		{"size 1", 1, []uint64{1, 2, 3}, []uint64{3}},
+	}
+	for _, tt := range tests {
+		h := newCountHistory(tt.size)
+		for _, count := range tt.counts {
+			h.add("get", []perfevents.PerfEventInfo{
+				{EventName: "page-faults", Data: count},
+				{EventName: "cpu-clock", Data: count * 10},
+				{EventName: "", Data: count},
+			})
+		}
+		if got := h.recent("get", "page-faults"); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: recent() = %v, want %v", tt.name, got, tt.want)
+		}
+		if got := h.recent("get", "cpu-clock"); len(got) != len(tt.want) || got[len(got)-1] != tt.want[len(tt.want)-1]*10 {
+			t.Errorf("%s: recent() of cpu-clock = %v", tt.name, got)
+		}
+		if got := h.recent("put", "page-faults"); got != nil {
+			t.Errorf("%s: recent() of another operation = %v, want nil", tt.name, got)
+		}
+		if got := h.recent("get", ""); got != nil {
+			t.Errorf("%s: recent() of the events not opened = %v, want nil", tt.name, got)
+		}
+	}
+}
+
+func TestRecentCounts(t *testing.T) {
+	skipWithoutPerf(t)
+	o := NewObserver()
+	if got := o.RecentCounts("test", "task-clock"); got != nil {
+		t.Errorf("RecentCounts() without history = %v, want nil", got)
+	}
+
+	o.SetHistorySize(2)
+	tracer := mocktracer.New()
+	for i := 0; i < 3; i++ {
+		_, so, ok := startSpan(o, tracer, opentracing.Tags{"perfevents": "task-clock"})
+		if !ok {
+			t.Fatal("span not observed")
+		}
+		so.OnFinish(opentracing.FinishOptions{})
+	}
+	if got := o.RecentCounts("test", "task-clock"); len(got) != 2 {
+		t.Errorf("RecentCounts() = %v, want the last 2 counts", got)
+	}
+
+	o.SetHistorySize(0)
+	if got := o.RecentCounts("test", "task-clock"); got != nil {
+		t.Errorf("RecentCounts() with the history off = %v, want nil", got)
+	}
+}
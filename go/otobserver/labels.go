@@ -0,0 +1,63 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package otobserver
+
+import (
+	"context"
+	"runtime/pprof"
+
+	"github.com/opentracing/opentracing-go"
+)
+
+// The tag carrying the pprof labels of a span, see PprofLabels.
+const pprofLabelsTag = "perfevents.pprof_labels"
+
+// The prefix of the names the pprof labels are logged with.
+const pprofLabelPrefix = "pprof."
+
+// PprofLabels returns a span option carrying the pprof labels of "ctx",
+// e.g. as set by pprof.Do, so that the counts of the span are logged
+// along with the labels, as "pprof.<label>" fields or tags, and can be
+// sliced by the same labels as the CPU profiles :
+//
+//	pprof.Do(ctx, pprof.Labels("handler", "login"), func(ctx context.Context) {
+//		sp := tracer.StartSpan("login", otobserver.PprofLabels(ctx))
+//		...
+//	})
+//
+// Go doesn't let the labels of the running goroutine be read other than
+// through its context. Without labels, the option does nothing.
+func PprofLabels(ctx context.Context) opentracing.StartSpanOption {
+	labels := make(map[string]string)
+	pprof.ForLabels(ctx, func(key, value string) bool {
+		labels[key] = value
+		return true
+	})
+	return pprofLabelsOption(labels)
+}
+
+type pprofLabelsOption map[string]string
+
+func (labels pprofLabelsOption) Apply(options *opentracing.StartSpanOptions) {
+	if len(labels) == 0 {
+		return
+	}
+	if options.Tags == nil {
+		options.Tags = make(opentracing.Tags)
+	}
+	options.Tags[pprofLabelsTag] = map[string]string(labels)
+}
+
+// logLabels logs the pprof labels of the span, if any, as its events
+// are.
+func (so *SpanObserver) logLabels() {
+	for key, value := range so.labels {
+		name := so.observer.fieldPrefix + pprofLabelPrefix + key
+		if so.observer.asTags {
+			so.sp.SetTag(name, value)
+		} else {
+			so.sp.LogEvent(name + ":" + value)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package otobserver
+
+import (
+	"context"
+	"reflect"
+	"runtime/pprof"
+	"strings"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+func TestPprofLabels(t *testing.T) {
+	tests := []struct {
+		name   string
+		labels []string
+		want   interface{}
+	}{
+		{"one", []string{"handler", "login"}, map[string]string{"handler": "login"}},
+		{"two", []string{"handler", "login", "tenant", "acme"}, map[string]string{"handler": "login", "tenant": "acme"}},
+		{"none", nil, nil},
+	}
+	for _, tt := range tests {
+		ctx := pprof.WithLabels(context.Background(), pprof.Labels(tt.labels...))
+		var options opentracing.StartSpanOptions
+		PprofLabels(ctx).Apply(&options)
+		got, ok := options.Tags[pprofLabelsTag]
+		if !ok {
+			got = nil
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: %s tag = %v, want %v", tt.name, pprofLabelsTag, got, tt.want)
+		}
+	}
+}
+
+func TestSpanLabels(t *testing.T) {
+	skipWithoutPerf(t)
+	tests := []struct {
+		name   string
+		asTags bool
+		prefix string
+	}{
+		{"logs", false, ""},
+		{"logs, prefix", false, "app."},
+		{"tags", true, ""},
+	}
+	for _, tt := range tests {
+		o := NewObserver()
+		o.asTags = tt.asTags
+		o.SetFieldPrefix(tt.prefix)
+		tracer := mocktracer.New()
+
+		var options opentracing.StartSpanOptions
+		ctx := pprof.WithLabels(context.Background(), pprof.Labels("handler", "login"))
+		PprofLabels(ctx).Apply(&options)
+		options.Tags["perfevents"] = "task-clock"
+		_, so, ok := startSpan(o, tracer, options.Tags)
+		if !ok {
+			t.Fatal("span not observed")
+		}
+		so.OnFinish(opentracing.FinishOptions{})
+
+		sp := so.sp.(*mocktracer.MockSpan)
+		name := tt.prefix + pprofLabelPrefix + "handler"
+		if tt.asTags {
+			if got := sp.Tag(name); got != "login" {
+				t.Errorf("%s: %s tag = %v, want login", tt.name, name, got)
+			}
+			continue
+		}
+		logs := strings.Join(spanLogs(sp), " ")
+		if !strings.Contains(logs, name+":login") {
+			t.Errorf("%s: %s:login not logged in %q", tt.name, name, logs)
+		}
+	}
+}
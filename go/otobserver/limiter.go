@@ -0,0 +1,76 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package otobserver
+
+import (
+	"sync"
+	"time"
+)
+
+// tokenBucket lets "rate" collections per second happen, with bursts of
+// up to "burst" collections.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		now:    time.Now,
+	}
+}
+
+// take takes a token from the bucket, if there is any left.
+func (b *tokenBucket) take() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// SetCollectionLimit caps the number of spans the events of which are
+// collected to "perSecond" per second, with bursts of up to "burst"
+// spans, over all the spans of the observer. The events of the spans
+// beyond the limit are not opened at all, which bounds the cost of the
+// measurement under load spikes. A limit of 0 or less removes the limit.
+func (o *Observer) SetCollectionLimit(perSecond float64, burst int) {
+	if perSecond <= 0 {
+		o.limiter = nil
+		return
+	}
+	o.limiter = newTokenBucket(perSecond, burst)
+	o.limiter.now = func() time.Time {
+		return o.clock.Now()
+	}
+}
+
+// CollectionLimit returns the number of spans per second the events of
+// which are collected at most, 0 for no limit, see SetCollectionLimit.
+func (o *Observer) CollectionLimit() float64 {
+	if o.limiter == nil {
+		return 0
+	}
+	return o.limiter.rate
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package otobserver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+// fakeClock is a perfevents.Clock only moving forward when told to.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time                         { return c.now }
+func (c *fakeClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+func TestTokenBucket(t *testing.T) {
+	tests := []struct {
+		name  string
+		rate  float64
+		burst int
+		steps []time.Duration
+		takes []bool
+	}{
+		{"burst", 1, 3, []time.Duration{0, 0, 0, 0}, []bool{true, true, true, false}},
+		{"refill", 2, 1, []time.Duration{0, 0, 500 * time.Millisecond, 0, 250 * time.Millisecond, 250 * time.Millisecond},
+			[]bool{true, false, true, false, false, true}},
+		// The tokens don't pile up beyond the burst.
+		{"capped", 10, 2, []time.Duration{0, time.Hour, 0, 0}, []bool{true, true, true, false}},
+		{"no burst", 1, 0, []time.Duration{0, 0, time.Second}, []bool{true, false, true}},
+	}
+	for _, tt := range tests {
+		clock := &fakeClock{now: time.Unix(1000, 0)}
+		b := newTokenBucket(tt.rate, tt.burst)
+		b.now = clock.Now
+		for i, step := range tt.steps {
+			clock.now = clock.now.Add(step)
+			if got := b.take(); got != tt.takes[i] {
+				t.Errorf("%s: take() #%d = %v, want %v", tt.name, i, got, tt.takes[i])
+			}
+		}
+	}
+}
+
+func TestSetCollectionLimit(t *testing.T) {
+	skipWithoutPerf(t)
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	o := NewObserver()
+	o.SetClock(clock)
+	o.SetCollectionLimit(1, 2)
+	if got := o.CollectionLimit(); got != 1 {
+		t.Errorf("CollectionLimit() = %v, want 1", got)
+	}
+
+	tracer := mocktracer.New()
+	tags := opentracing.Tags{"perfevents": "task-clock"}
+	for i, measured := range []bool{true, true, false, false} {
+		_, so, ok := startSpan(o, tracer, tags)
+		if !ok {
+			t.Fatal("span not observed")
+		}
+		if got := len(so.EventDescs) != 0; got != measured {
+			t.Errorf("span #%d measured: %v, want %v", i, got, measured)
+		}
+		so.OnFinish(opentracing.FinishOptions{})
+	}
+	clock.now = clock.now.Add(time.Second)
+	if _, so, _ := startSpan(o, tracer, tags); len(so.EventDescs) == 0 {
+		t.Errorf("span not measured a second later")
+	} else {
+		so.OnFinish(opentracing.FinishOptions{})
+	}
+
+	// Without a limit, all the spans are measured.
+	o.SetCollectionLimit(0, 2)
+	if got := o.CollectionLimit(); got != 0 {
+		t.Errorf("CollectionLimit() = %v, want 0", got)
+	}
+	for i := 0; i < 4; i++ {
+		_, so, _ := startSpan(o, tracer, tags)
+		if len(so.EventDescs) == 0 {
+			t.Errorf("span #%d not measured without a limit", i)
+		}
+		so.OnFinish(opentracing.FinishOptions{})
+	}
+}
@@ -0,0 +1,591 @@
+package otobserver
+
+import (
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	goobserver "github.com/opentracing-contrib/go-observer"
+	perfevents "github.com/opentracing-contrib/perfevents/go"
+	"github.com/opentracing/opentracing-go"
+)
+
+// Whether the hardware events can be counted, see
+// perfevents.HasHardwarePMU.
+var hasHardwarePMU = perfevents.HasHardwarePMU
+
+// The tag set on the spans the hardware events of which were replaced by
+// their software equivalents, or left out, on a machine without a PMU,
+// listing these events, see perfevents.SoftwareFallbackEventList.
+const softwareFallbackTag = "perf.software_fallback"
+
+// TODO: Add a member to keep the list of all available events, which
+// is initialized when NewObserver() is called.
+type Observer struct {
+	displayNames map[string]string
+	logRates     bool
+	shared       *sharedCounters
+	fitEvents    bool
+	overhead     bool
+	failFast     bool
+	fieldPrefix  string
+	history      *countHistory
+	errorHandler func(error)
+	timeScaling  bool
+	limiter      *tokenBucket
+	minDuration  time.Duration
+	clock        perfevents.Clock
+	inherit      bool
+
+	// Set up by NewObserverFromConfig.
+	tagKey        string
+	defaultEvents string
+	asTags        bool
+	sink          Sink
+	maxOpenFDs    int
+	disabled      bool
+
+	// The span observers with events open, see DumpActive, and the
+	// number of their counters. mu also guards defaultEvents, see
+	// SetDefaultEvents.
+	mu      sync.Mutex
+	active  map[*SpanObserver]bool
+	openFDs int
+}
+
+// New observer creates a new observer
+// The events of the PERFEVENTS environment variable, if valid, are
+// counted for the spans which don't request any, e.g.
+// PERFEVENTS=cpu-cycles,instructions.
+func NewObserver() *Observer {
+	o := &Observer{
+		active: make(map[*SpanObserver]bool),
+		clock:  perfevents.RealClock,
+	}
+	if events := os.Getenv(defaultEventsEnv); events != "" && perfevents.ValidateEvents(events) == nil {
+		o.defaultEvents = events
+	}
+	return o
+}
+
+// SetDisplayNames sets the names the events are logged with, e.g.
+// {"cpu-cycles": "cpu.cycles.count"}. Events not in "names" are logged
+// with their own name.
+func (o *Observer) SetDisplayNames(names map[string]string) {
+	o.displayNames = names
+}
+
+// SetFieldPrefix sets a prefix the events are logged with, e.g. "perf."
+// to log cpu-cycles as "perf.cpu-cycles", after their display names are
+// applied. There is no prefix by default.
+func (o *Observer) SetFieldPrefix(prefix string) {
+	o.fieldPrefix = prefix
+}
+
+// SetLogRates sets whether the rates per second of the events over the
+// span duration are logged along with their counts, e.g.
+// "cpu-cycles/sec:1234".
+func (o *Observer) SetLogRates(logRates bool) {
+	o.logRates = logRates
+}
+
+// SetSharedCounters sets whether overlapping spans requesting the same
+// event share one counter rather than opening one each. The counter is
+// opened by the first span, each span then reports the delta of the
+// counter over its own lifetime, and the counter is closed when the last
+// span using it finishes.
+// As any counter of this package, a shared counter counts the thread
+// which opened it, so sharing is meant for the spans of one thread.
+func (o *Observer) SetSharedCounters(shared bool) {
+	if shared {
+		o.shared = newSharedCounters()
+	} else {
+		o.shared = nil
+	}
+}
+
+// SetFitEventList sets whether the events of a span are fitted in the
+// counters of the PMU with FitEventList, so that they are never
+// multiplexed, the events which don't fit being left out.
+func (o *Observer) SetFitEventList(fit bool) {
+	o.fitEvents = fit
+}
+
+// SetReportOverhead sets whether the time spent opening, reading and
+// closing the events of a span is reported as its "perf.overhead_ns" tag,
+// to tell the cost of the measurement.
+func (o *Observer) SetReportOverhead(report bool) {
+	o.overhead = report
+}
+
+// SetInherit sets whether the events of a span also count the threads
+// and processes the thread starting the span creates while the span runs,
+// e.g. the commands it runs with os/exec, see perfevents.INHERIT. The Go
+// runtime starts its threads from whichever thread needs one, so the
+// goroutines the span starts are only counted when they run on threads
+// the thread of the span started. It doesn't apply to the shared counters
+// nor to the events of a cgroup.
+func (o *Observer) SetInherit(inherit bool) {
+	o.inherit = inherit
+}
+
+// SetFailFast sets whether a span any of the requested events of which
+// can't be opened, e.g. a hardware event on a machine without a PMU, is
+// dropped by the observer, NewSpanObserver returning false and the events
+// which did open being closed, rather than being observed without the
+// events which couldn't.
+func (o *Observer) SetFailFast(failFast bool) {
+	o.failFast = failFast
+}
+
+// SetTimeScaling sets whether the counts of an event which was
+// multiplexed are scaled, as per the times it was enabled and running
+// for, to an estimate of what it would have counted over the whole span,
+// see perfevents.PerfEventInfo.Scaled, and the share of the span it actually
+// counted for is logged as its "perf.<event>.scheduled_pct" field, e.g.
+// "perf.cpu-cycles.scheduled_pct:75.0", after the field prefix, see
+// SetFieldPrefix. It doesn't apply to the shared counters.
+func (o *Observer) SetTimeScaling(scaling bool) {
+	o.timeScaling = scaling
+}
+
+// Share of the time an event was enabled for below which it was
+// multiplexed too much for its count to be relied upon.
+const lowConfidenceScheduledPct = 50
+
+// SetLowConfidenceThreshold sets the duration, e.g. 10µs, below which a
+// span gets the "perf.low_confidence" tag, set to true, the fixed costs
+// of the measurement dominating the counts of such short spans. No span
+// gets the tag for its duration by default. With time scaling, see
+// SetTimeScaling, a span any event of which counted for less than half
+// of the span gets the tag too, whatever the threshold.
+func (o *Observer) SetLowConfidenceThreshold(minDuration time.Duration) {
+	o.minDuration = minDuration
+}
+
+// SetClock sets the clock telling the start and finish times of the
+// spans which don't set them, and the time of the collection limit, nil
+// for the real time, e.g. to a fake clock in a test.
+func (o *Observer) SetClock(clock perfevents.Clock) {
+	if clock == nil {
+		clock = perfevents.RealClock
+	}
+	o.clock = clock
+}
+
+// SetErrorHandler sets a function called with every error the observer
+// runs into measuring the spans, e.g. events which couldn't be opened or
+// read, which are otherwise dropped silently. The errors are those of
+// perfevents, e.g. perfevents.PerfUnsupportedEvent, or
+// PerfTooManyOpenFDs. The handler is called from the goroutines starting
+// and finishing the spans.
+func (o *Observer) SetErrorHandler(handler func(error)) {
+	o.errorHandler = handler
+}
+
+// handleError calls the error handler of the observer with "err", if
+// any.
+func (o *Observer) handleError(err error) {
+	if err != nil && o.errorHandler != nil {
+		o.errorHandler(err)
+	}
+}
+
+// RestoreAfterCheckpoint opens again all the events the observer has
+// open, to be called by an application after it has been checkpointed
+// and restored (CRIU), which leaves the perf event descriptors invalid,
+// see IsStale. The spans only count from there. The last error is
+// returned if any event couldn't be opened again.
+func (o *Observer) RestoreAfterCheckpoint() error {
+	var lastErr error
+	o.mu.Lock()
+	for so := range o.active {
+		err := reopenEvents(so.EventDescs, so.baselines)
+		if err != nil {
+			lastErr = err
+		}
+	}
+	o.mu.Unlock()
+
+	if o.shared != nil {
+		err := o.shared.reopen()
+		if err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// reopenEvents opens again the events of "eventsInfo", the group leaders
+// coming before their members, their counts starting again from the
+// void "baselines".
+func reopenEvents(eventsInfo []perfevents.PerfEventInfo, baselines []perfevents.ReadFormat) error {
+	var lastErr error
+	leaders := make(map[int]int)
+	for i := range eventsInfo {
+		event := &eventsInfo[i]
+		oldFd := event.Fd
+		if newFd, ok := leaders[event.GroupFd]; ok {
+			event.GroupFd = newFd
+		}
+		err := event.Reopen()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if i < len(baselines) {
+			baselines[i] = perfevents.ReadFormat{}
+		}
+		leaders[oldFd] = event.Fd
+	}
+	return lastErr
+}
+
+// OnStartSpan creates a new Observer for the span
+func (o *Observer) OnStartSpan(sp opentracing.Span, operationName string, options opentracing.StartSpanOptions) (goobserver.SpanObserver, bool) {
+	if o.disabled {
+		return nil, false
+	}
+	so, ok := newSpanObserver(o, sp, options)
+	so.operation = operationName
+	return so, ok
+}
+
+// SpanObserver collects perfevent metrics
+type SpanObserver struct {
+	sp         opentracing.Span
+	EventDescs []perfevents.PerfEventInfo
+	observer   *Observer
+	sharedUses []sharedCounterUse
+	startTime  time.Time
+	operation  string
+	// The pprof labels of the span, see PprofLabels.
+	labels map[string]string
+	// The cgroup the events count, if not the thread, see cgroupTag.
+	cgroup string
+	// The process the events count, if not the thread, see pidTag.
+	pid int
+	// Time spent opening, reading and closing the events.
+	overhead time.Duration
+	// The counts and times of EventDescs when the span started
+	// counting, which the counts of the span are relative to.
+	baselines []perfevents.ReadFormat
+}
+
+// NewSpanObserver creates a new SpanObserver that can emit perfevent
+// metrics
+func NewSpanObserver(s opentracing.Span, opts opentracing.StartSpanOptions) (*SpanObserver, bool) {
+	return newSpanObserver(NewObserver(), s, opts)
+}
+
+// newSpanObserver creates a new SpanObserver set up as per the observer
+// "o".
+func newSpanObserver(o *Observer, s opentracing.Span, opts opentracing.StartSpanOptions) (*SpanObserver, bool) {
+	so := &SpanObserver{
+		sp:        s,
+		observer:  o,
+		startTime: opts.StartTime,
+	}
+	if so.startTime.IsZero() {
+		so.startTime = o.clock.Now()
+	}
+
+	tag := o.eventsTag()
+	req := false
+	// The cgroup and the process tell how the events are opened, they
+	// go first.
+	if v, ok := opts.Tags[cgroupTag]; ok {
+		so.OnSetTag(cgroupTag, v)
+	}
+	if v, ok := opts.Tags[pidTag]; ok {
+		so.OnSetTag(pidTag, v)
+	}
+	for k, v := range opts.Tags {
+		if k == tag {
+			so.OnSetTag(k, v)
+			req = true
+		}
+		if k == pprofLabelsTag {
+			so.OnSetTag(k, v)
+		}
+	}
+
+	// The events can also be propagated as baggage, the tag takes
+	// precedence though.
+	if !req {
+		if v := s.BaggageItem(tag); v != "" {
+			so.OnSetTag(tag, v)
+			req = true
+		}
+	}
+	if !req {
+		if events := o.defaultEventList(); events != "" {
+			so.OnSetTag(tag, events)
+			req = true
+		}
+	}
+	if req && o.failFast && len(so.EventDescs) == 0 && len(so.sharedUses) == 0 {
+		return so, false
+	}
+
+	return so, req
+}
+
+func (so *SpanObserver) OnSetOperationName(operationName string) {
+	so.operation = operationName
+}
+
+func (so *SpanObserver) OnSetTag(key string, value interface{}) {
+	if key == cgroupTag {
+		// Only the events opened from there count the cgroup.
+		if cgroup, ok := value.(string); ok {
+			so.cgroup = cgroup
+		}
+		return
+	}
+	if key == pidTag {
+		// Only the events opened from there count the process.
+		if pid, ok := tagPid(value); ok && pid > 0 {
+			so.pid = pid
+		}
+		return
+	}
+	if key == pprofLabelsTag {
+		if labels, ok := value.(map[string]string); ok {
+			so.labels = labels
+		}
+		return
+	}
+	if key == so.observer.eventsTag() {
+		// The events of a span, e.g. the default ones, are only
+		// opened once.
+		if so.EventDescs != nil || so.sharedUses != nil {
+			return
+		}
+		if v, ok := value.(string); ok {
+			// Beyond the collection limit, the span isn't measured.
+			if so.observer.limiter != nil && !so.observer.limiter.take() {
+				return
+			}
+			start := time.Now()
+			defer func() {
+				so.overhead += time.Since(start)
+			}()
+
+			// Don't bother opening hardware events which can't count,
+			// count their software equivalents, if any, instead.
+			if !hasHardwarePMU() {
+				var fallen []string
+				v, fallen = perfevents.SoftwareFallbackEventList(v)
+				if len(fallen) != 0 {
+					so.sp.SetTag(softwareFallbackTag, strings.Join(fallen, ","))
+				}
+				if v == "" {
+					return
+				}
+			}
+			if so.observer.fitEvents {
+				v, _ = perfevents.FitEventList(v)
+			}
+			if so.observer.shared != nil && so.cgroup == "" && so.pid == 0 {
+				// The shared counters leave the unknown events out
+				// silently.
+				failed := false
+				if so.observer.failFast {
+					list, err := perfevents.ParseEventList(v)
+					for i := 0; err == nil && i < len(list.Events); i++ {
+						failed = failed || list.Events[i].Err != nil
+					}
+				}
+				so.sharedUses = so.observer.shared.acquire(v, func(err error) {
+					failed = failed || err != nil
+					so.observer.handleError(err)
+				})
+				if failed && so.observer.failFast {
+					so.observer.shared.release(so.sharedUses, so.observer.handleError)
+					so.sharedUses = nil
+				}
+				return
+			}
+			// Every event takes a counter, at most, on every CPU
+			// for a cgroup.
+			list, err := perfevents.ParseEventList(v)
+			if err != nil {
+				so.observer.handleError(err)
+				return
+			}
+			n := len(list.Events)
+			if so.cgroup != "" {
+				n *= runtime.NumCPU()
+			}
+			if !so.observer.reserveFDs(n) {
+				so.observer.handleError(PerfTooManyOpenFDs)
+				return
+			}
+			opts := perfevents.EventOptions{Inherit: so.observer.inherit}
+			if so.cgroup != "" {
+				err, _, so.EventDescs = perfevents.InitOpenEventsEnableCgroup(v, so.cgroup)
+			} else if so.pid != 0 {
+				err, _, so.EventDescs = perfevents.InitOpenEventsEnableWithOptions(v, so.pid, -1, opts)
+			} else {
+				err, _, so.EventDescs = perfevents.InitOpenEventsEnableSelfWithOptions(v, opts)
+			}
+			so.observer.handleError(err)
+			if err != nil && so.observer.failFast {
+				// Not observing the span at all, rather than
+				// without the events which couldn't be opened.
+				so.observer.handleError(perfevents.EventsDisableClose(so.EventDescs))
+				so.EventDescs = nil
+			}
+			so.observer.releaseFDs(n - len(so.EventDescs))
+			// Opening the events counts too, only count from
+			// there, which is when the tag is set on the span.
+			so.baselines = make([]perfevents.ReadFormat, len(so.EventDescs))
+			for i := range so.EventDescs {
+				values, err := (&so.EventDescs[i]).PeekValues()
+				if err == nil {
+					so.baselines[i] = values
+				}
+			}
+			if len(so.EventDescs) != 0 {
+				so.observer.mu.Lock()
+				so.observer.active[so] = true
+				so.observer.mu.Unlock()
+			}
+		}
+	}
+}
+
+func (so *SpanObserver) OnFinish(options opentracing.FinishOptions) {
+	if so.sharedUses != nil {
+		start := time.Now()
+		events := so.observer.shared.release(so.sharedUses, so.observer.handleError)
+		so.overhead += time.Since(start)
+		so.logEvents(events, options)
+		so.reportOverhead()
+		return
+	}
+
+	so.observer.mu.Lock()
+	delete(so.observer.active, so)
+	so.observer.mu.Unlock()
+	defer so.observer.releaseFDs(len(so.EventDescs))
+
+	// Read into a snapshot of the events, leaving the descriptors
+	// as they are, with the counts and the times of the span.
+	start := time.Now()
+	events := make([]perfevents.PerfEventInfo, len(so.EventDescs))
+	for i, event := range so.EventDescs {
+		values, err := (&so.EventDescs[i]).PeekValues()
+		if err != nil {
+			so.observer.handleError(perfevents.PerfReadError)
+			so.observer.handleError(perfevents.EventsDisableClose(so.EventDescs))
+			return
+		}
+		var baseline perfevents.ReadFormat
+		if i < len(so.baselines) {
+			baseline = so.baselines[i]
+		}
+		events[i] = event
+		events[i].Data = values.Value - baseline.Value
+		events[i].TimeEnabled = values.TimeEnabled - baseline.TimeEnabled
+		events[i].TimeRunning = values.TimeRunning - baseline.TimeRunning
+		if so.observer.timeScaling {
+			events[i].Data = uint64(events[i].Scaled())
+		}
+	}
+	so.overhead += time.Since(start)
+	if so.cgroup != "" {
+		events = sumCPUEvents(events)
+	}
+
+	so.logEvents(events, options)
+	start = time.Now()
+	err := perfevents.EventsDisableClose(so.EventDescs)
+	so.overhead += time.Since(start)
+	so.observer.handleError(err)
+	so.reportOverhead()
+}
+
+// reportOverhead sets the overhead tag of the span, if requested.
+func (so *SpanObserver) reportOverhead() {
+	if so.observer.overhead && so.overhead > 0 {
+		so.sp.SetTag("perf.overhead_ns", so.overhead.Nanoseconds())
+	}
+}
+
+// logEvents logs the counts of the events read at the end of the span.
+func (so *SpanObserver) logEvents(events []perfevents.PerfEventInfo, options opentracing.FinishOptions) {
+	finishTime := options.FinishTime
+	if finishTime.IsZero() {
+		finishTime = so.observer.clock.Now()
+	}
+	duration := finishTime.Sub(so.startTime)
+	durationNs := uint64(duration.Nanoseconds())
+	lowConfidence := so.observer.minDuration > 0 && duration < so.observer.minDuration
+
+	// log and close the perf events first, if any, since, we don't
+	// want to account for the code to finish up the span.
+	for _, event := range events {
+		// In any case of an error for an event, event.EventName
+		// will contain "" for an event.
+		if event.EventName != "" {
+			name := so.observer.fieldPrefix + so.displayName(event.EventName)
+			if so.observer.asTags {
+				so.sp.SetTag(name, event.Data)
+			} else {
+				so.sp.LogEvent(name + ":" + perfevents.FormatDataToString(event))
+			}
+			if so.observer.timeScaling && event.TimeEnabled != 0 {
+				so.logScheduled(event)
+				if event.TimeRunning*100 < event.TimeEnabled*lowConfidenceScheduledPct {
+					lowConfidence = true
+				}
+			}
+			if so.observer.logRates && durationNs > 0 {
+				rate := perfevents.RatePerSecond(event, durationNs)
+				if so.observer.asTags {
+					so.sp.SetTag(name+"/sec", rate)
+				} else {
+					so.sp.LogEvent(name + "/sec:" +
+						strconv.FormatFloat(rate, 'f', 0, 64))
+				}
+			}
+		}
+	}
+	if len(events) != 0 {
+		so.logLabels()
+		if lowConfidence {
+			so.sp.SetTag("perf.low_confidence", true)
+		}
+	}
+	if so.observer.history != nil {
+		so.observer.history.add(so.operation, events)
+	}
+	if so.observer.sink != nil && len(events) != 0 {
+		so.observer.sink.Emit(so.sp, events)
+	}
+}
+
+// logScheduled logs the percentage of the time the snapshot "event" was
+// enabled for that it actually counted.
+func (so *SpanObserver) logScheduled(event perfevents.PerfEventInfo) {
+	pct := float64(event.TimeRunning) * 100 / float64(event.TimeEnabled)
+	name := so.observer.fieldPrefix + "perf." + so.displayName(event.EventName) + ".scheduled_pct"
+	if so.observer.asTags {
+		so.sp.SetTag(name, pct)
+	} else {
+		so.sp.LogEvent(name + ":" + strconv.FormatFloat(pct, 'f', 1, 64))
+	}
+}
+
+// displayName returns the name an event is logged with.
+func (so *SpanObserver) displayName(eventName string) string {
+	if name, ok := so.observer.displayNames[eventName]; ok {
+		return name
+	}
+	return eventName
+}
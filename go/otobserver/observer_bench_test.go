@@ -0,0 +1,68 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package otobserver
+
+import (
+	"testing"
+
+	perfevents "github.com/opentracing-contrib/perfevents/go"
+	"github.com/opentracing/opentracing-go"
+)
+
+// benchSpans measures spans observed by "o" counting the event list
+// "events", without any work in the spans, i.e., the cost of the
+// measurement.
+func benchSpans(b *testing.B, o *Observer, events string) {
+	err, _, eventsInfo := perfevents.InitOpenEventsEnableSelf(events)
+	perfevents.EventsDisableClose(eventsInfo)
+	if err != nil {
+		b.Skip("can't open ", events, ": ", err)
+	}
+	tracer := opentracing.NoopTracer{}
+	options := opentracing.StartSpanOptions{
+		Tags: opentracing.Tags{o.eventsTag(): events},
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sp := tracer.StartSpan("bench")
+		so, ok := o.OnStartSpan(sp, "bench", options)
+		if ok {
+			so.OnFinish(opentracing.FinishOptions{})
+		}
+		sp.Finish()
+	}
+}
+
+func BenchmarkSpans(b *testing.B) {
+	benchSpans(b, NewObserver(), "task-clock,page-faults")
+}
+
+// The spans of one thread share their counters, see SetSharedCounters.
+// The counters are only opened once when the spans overlap, so an outer
+// span is kept open.
+func BenchmarkSpansShared(b *testing.B) {
+	o := NewObserver()
+	o.SetSharedCounters(true)
+	outer, ok := o.OnStartSpan(opentracing.NoopTracer{}.StartSpan("outer"), "outer",
+		opentracing.StartSpanOptions{Tags: opentracing.Tags{o.eventsTag(): "task-clock,page-faults"}})
+	if ok {
+		defer outer.OnFinish(opentracing.FinishOptions{})
+	}
+	benchSpans(b, o, "task-clock,page-faults")
+}
+
+// Spans which don't request any event, the cost of the observer alone.
+func BenchmarkSpansNoEvents(b *testing.B) {
+	o := NewObserver()
+	tracer := opentracing.NoopTracer{}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sp := tracer.StartSpan("bench")
+		so, ok := o.OnStartSpan(sp, "bench", opentracing.StartSpanOptions{})
+		if ok {
+			so.OnFinish(opentracing.FinishOptions{})
+		}
+		sp.Finish()
+	}
+}
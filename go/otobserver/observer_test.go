@@ -0,0 +1,568 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package otobserver
+
+import (
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	perfevents "github.com/opentracing-contrib/perfevents/go"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+// skipWithoutPerf skips the test if the software events can't be opened,
+// e.g. when perf_event_open isn't permitted.
+func skipWithoutPerf(t *testing.T) {
+	t.Helper()
+	err, _, events := perfevents.InitOpenEventsEnableSelf("task-clock")
+	if err != nil {
+		t.Skip("perf_event_open not permitted: ", err)
+	}
+	perfevents.EventsDisableClose(events)
+}
+
+// mockHardwarePMU has the observer take the machine for having a PMU or
+// not, as per "present", until the test is done.
+func mockHardwarePMU(t *testing.T, present bool) {
+	probe := hasHardwarePMU
+	hasHardwarePMU = func() bool { return present }
+	t.Cleanup(func() { hasHardwarePMU = probe })
+}
+
+// startSpan starts a span of "tracer" observed by "o", with the tags
+// "tags".
+func startSpan(o *Observer, tracer *mocktracer.MockTracer, tags opentracing.Tags) (*mocktracer.MockSpan, *SpanObserver, bool) {
+	sp := tracer.StartSpan("test", tags).(*mocktracer.MockSpan)
+	so, ok := o.OnStartSpan(sp, "test", opentracing.StartSpanOptions{Tags: tags})
+	if !ok {
+		return sp, nil, false
+	}
+	return sp, so.(*SpanObserver), true
+}
+
+// spanLogs returns the fields logged on "sp", as "key:value".
+func spanLogs(sp *mocktracer.MockSpan) []string {
+	var logs []string
+	for _, record := range sp.Logs() {
+		for _, field := range record.Fields {
+			logs = append(logs, field.ValueString)
+		}
+	}
+	return logs
+}
+
+func TestObserverHardwarePMU(t *testing.T) {
+	tests := []struct {
+		name     string
+		present  bool
+		events   string
+		opened   []string
+		fallback interface{}
+	}{
+		{"present", true, "cpu-clock,page-faults", []string{"cpu-clock", "page-faults"}, nil},
+		{"absent, software", false, "cpu-clock,page-faults", []string{"cpu-clock", "page-faults"}, nil},
+		{"absent, fallback", false, "cpu-cycles,cache-misses", []string{"cpu-clock"}, "cpu-cycles,cache-misses"},
+		{"absent, group", false, "{cpu-cycles,instructions}", []string{"cpu-clock", "task-clock"}, "cpu-cycles,instructions"},
+	}
+	skipWithoutPerf(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockHardwarePMU(t, tt.present)
+			tracer := mocktracer.New()
+			sp, so, ok := startSpan(NewObserver(), tracer, opentracing.Tags{"perfevents": tt.events})
+			if !ok {
+				t.Fatal("span not observed")
+			}
+			if got := sp.Tag(softwareFallbackTag); got != tt.fallback {
+				t.Errorf("%s tag = %v, want %v", softwareFallbackTag, got, tt.fallback)
+			}
+			var opened []string
+			for _, event := range so.EventDescs {
+				opened = append(opened, event.EventName)
+			}
+			if strings.Join(opened, ",") != strings.Join(tt.opened, ",") {
+				t.Errorf("opened %q, want %q", opened, tt.opened)
+			}
+			so.OnFinish(opentracing.FinishOptions{})
+			logs := strings.Join(spanLogs(sp), " ")
+			for _, name := range tt.opened {
+				if !strings.Contains(logs, name+":") {
+					t.Errorf("%s not logged in %q", name, logs)
+				}
+			}
+		})
+	}
+}
+
+func TestObserverNoHardwareEvent(t *testing.T) {
+	mockHardwarePMU(t, false)
+	tracer := mocktracer.New()
+	sp, so, ok := startSpan(NewObserver(), tracer, opentracing.Tags{"perfevents": "cache-misses"})
+	if !ok {
+		t.Fatal("span not observed")
+	}
+	if len(so.EventDescs) != 0 {
+		t.Errorf("%d events opened, want none", len(so.EventDescs))
+	}
+	if got := sp.Tag(softwareFallbackTag); got != "cache-misses" {
+		t.Errorf("%s tag = %v, want cache-misses", softwareFallbackTag, got)
+	}
+	so.OnFinish(opentracing.FinishOptions{})
+}
+
+// loggedCount returns the count of "event" logged on "sp".
+func loggedCount(t *testing.T, sp *mocktracer.MockSpan, event string) uint64 {
+	t.Helper()
+	for _, log := range spanLogs(sp) {
+		if strings.HasPrefix(log, event+":") {
+			count, err := strconv.ParseUint(strings.TrimPrefix(log, event+":"), 10, 64)
+			if err != nil {
+				t.Fatalf("logged %q", log)
+			}
+			return count
+		}
+	}
+	t.Fatalf("%s not logged in %q", event, spanLogs(sp))
+	return 0
+}
+
+func TestSpanBaseline(t *testing.T) {
+	skipWithoutPerf(t)
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	sp := mocktracer.New().StartSpan("test").(*mocktracer.MockSpan)
+	so, _ := newSpanObserver(NewObserver(), sp, opentracing.StartSpanOptions{})
+
+	// The faults before the events are requested don't count, nor do
+	// the ones of opening the events.
+	touchPages(256)
+	so.OnSetTag("perfevents", "page-faults,task-clock")
+	if len(so.EventDescs) != 2 {
+		t.Fatalf("opened %d events, want 2", len(so.EventDescs))
+	}
+	// The descriptors are left as opened.
+	for _, event := range so.EventDescs {
+		if event.Baseline != 0 || event.TimeEnabled != 0 || event.TimeRunning != 0 {
+			t.Errorf("%s baseline %d, times %d, %d, want none", event.EventName,
+				event.Baseline, event.TimeEnabled, event.TimeRunning)
+		}
+	}
+	touchPages(16)
+	so.OnFinish(opentracing.FinishOptions{})
+	if faults := loggedCount(t, sp, "page-faults"); faults < 16 || faults >= 256 {
+		t.Errorf("logged %d page faults, want the 16 of the span", faults)
+	}
+}
+
+// logSpan logs the snapshots "events" on a span of "o" lasting
+// "duration", and returns the span.
+func logSpan(o *Observer, events []perfevents.PerfEventInfo, duration time.Duration) *mocktracer.MockSpan {
+	sp := mocktracer.New().StartSpan("test").(*mocktracer.MockSpan)
+	start := time.Unix(1000, 0)
+	so := &SpanObserver{sp: sp, observer: o, startTime: start}
+	so.logEvents(events, opentracing.FinishOptions{FinishTime: start.Add(duration)})
+	return sp
+}
+
+func TestLowConfidence(t *testing.T) {
+	counted := perfevents.PerfEventInfo{EventName: "cpu-cycles", Data: 1000, TimeEnabled: 1000, TimeRunning: 1000}
+	multiplexed := perfevents.PerfEventInfo{EventName: "cpu-cycles", Data: 1000, TimeEnabled: 1000, TimeRunning: 250}
+	tests := []struct {
+		name        string
+		threshold   time.Duration
+		timeScaling bool
+		events      []perfevents.PerfEventInfo
+		duration    time.Duration
+		want        interface{}
+	}{
+		{"short", 10 * time.Microsecond, false, []perfevents.PerfEventInfo{counted}, 5 * time.Microsecond, true},
+		{"long", 10 * time.Microsecond, false, []perfevents.PerfEventInfo{counted}, time.Millisecond, nil},
+		{"no threshold", 0, false, []perfevents.PerfEventInfo{counted}, time.Nanosecond, nil},
+		{"multiplexed", 10 * time.Microsecond, true, []perfevents.PerfEventInfo{counted, multiplexed}, time.Millisecond, true},
+		{"multiplexed, no threshold", 0, true, []perfevents.PerfEventInfo{multiplexed}, time.Millisecond, true},
+		{"multiplexed, no scaling", 0, false, []perfevents.PerfEventInfo{multiplexed}, time.Millisecond, nil},
+		{"counted", 0, true, []perfevents.PerfEventInfo{counted}, time.Millisecond, nil},
+		{"no events", 10 * time.Microsecond, true, nil, time.Microsecond, nil},
+	}
+	for _, tt := range tests {
+		o := NewObserver()
+		o.SetLowConfidenceThreshold(tt.threshold)
+		o.SetTimeScaling(tt.timeScaling)
+		sp := logSpan(o, tt.events, tt.duration)
+		if got := sp.Tag("perf.low_confidence"); got != tt.want {
+			t.Errorf("%s: perf.low_confidence = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestScheduledPct(t *testing.T) {
+	tests := []struct {
+		name             string
+		prefix           string
+		asTags           bool
+		displayNames     map[string]string
+		enabled, running uint64
+		field            string
+		want             interface{}
+	}{
+		{"counted", "", false, nil, 1000, 1000, "perf.cpu-cycles.scheduled_pct", "100.0"},
+		{"multiplexed", "", false, nil, 1000, 750, "perf.cpu-cycles.scheduled_pct", "75.0"},
+		{"prefix", "app.", false, nil, 3000, 1000, "app.perf.cpu-cycles.scheduled_pct", "33.3"},
+		{"display name", "app.", false, map[string]string{"cpu-cycles": "cycles"}, 1000, 500,
+			"app.perf.cycles.scheduled_pct", "50.0"},
+		{"tags", "app.", true, nil, 1000, 250, "app.perf.cpu-cycles.scheduled_pct", 25.0},
+		// The times aren't known.
+		{"no times", "", false, nil, 0, 0, "perf.cpu-cycles.scheduled_pct", nil},
+	}
+	for _, tt := range tests {
+		o := NewObserver()
+		o.SetTimeScaling(true)
+		o.SetFieldPrefix(tt.prefix)
+		o.SetDisplayNames(tt.displayNames)
+		o.asTags = tt.asTags
+		sp := logSpan(o, []perfevents.PerfEventInfo{
+			{EventName: "cpu-cycles", Data: 1000, TimeEnabled: tt.enabled, TimeRunning: tt.running},
+		}, time.Millisecond)
+
+		var got interface{}
+		if tt.asTags {
+			got = sp.Tag(tt.field)
+		} else {
+			for _, log := range spanLogs(sp) {
+				if strings.HasPrefix(log, tt.field+":") {
+					got = strings.TrimPrefix(log, tt.field+":")
+				}
+			}
+		}
+		if got != tt.want {
+			t.Errorf("%s: %s = %v, want %v in %q", tt.name, tt.field, got, tt.want, spanLogs(sp))
+		}
+	}
+}
+
+func TestObserverTrigger(t *testing.T) {
+	skipWithoutPerf(t)
+	t.Setenv(defaultEventsEnv, "")
+	tests := []struct {
+		name    string
+		tag     string
+		baggage string
+		opened  string
+		ok      bool
+	}{
+		{"tag only", "task-clock", "", "task-clock", true},
+		{"baggage only", "", "page-faults", "page-faults", true},
+		// The tag takes precedence.
+		{"both", "task-clock", "page-faults", "task-clock", true},
+		{"neither", "", "", "", false},
+	}
+	for _, tt := range tests {
+		sp := mocktracer.New().StartSpan("test")
+		if tt.baggage != "" {
+			sp.SetBaggageItem("perfevents", tt.baggage)
+		}
+		var options opentracing.StartSpanOptions
+		if tt.tag != "" {
+			options.Tags = opentracing.Tags{"perfevents": tt.tag}
+		}
+		so, ok := NewObserver().OnStartSpan(sp, "test", options)
+		if ok != tt.ok {
+			t.Errorf("%s: OnStartSpan() observed %v, want %v", tt.name, ok, tt.ok)
+		}
+		if !ok {
+			continue
+		}
+		if opened := openedEvents(so.(*SpanObserver)); opened != tt.opened {
+			t.Errorf("%s: opened %q, want %q", tt.name, opened, tt.opened)
+		}
+		so.OnFinish(opentracing.FinishOptions{})
+	}
+}
+
+// The spans of several goroutines read the same descriptors when they
+// are shared, without writing to them, which -race checks.
+func TestObserverConcurrentSpans(t *testing.T) {
+	skipWithoutPerf(t)
+	for _, shared := range []bool{false, true} {
+		o := NewObserver()
+		o.SetSharedCounters(shared)
+		tracer := mocktracer.New()
+		// A span open all along keeps the shared counters open.
+		_, outer, ok := startSpan(o, tracer, opentracing.Tags{"perfevents": "task-clock,page-faults"})
+		if !ok {
+			t.Fatal("span not observed")
+		}
+
+		var wg sync.WaitGroup
+		for g := 0; g < 8; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 20; i++ {
+					sp, so, ok := startSpan(o, tracer, opentracing.Tags{"perfevents": "task-clock,page-faults"})
+					if !ok {
+						t.Error("span not observed")
+						return
+					}
+					so.OnFinish(opentracing.FinishOptions{})
+					if logs := spanLogs(sp); len(logs) != 2 {
+						t.Errorf("logged %q, want task-clock and page-faults", logs)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+
+		if shared {
+			for name, counter := range o.shared.counters {
+				if counter.event.Data != 0 || counter.refs != 1 {
+					t.Errorf("shared %s: Data %d, refs %d, want 0, 1", name, counter.event.Data, counter.refs)
+				}
+			}
+		}
+		outer.OnFinish(opentracing.FinishOptions{})
+		if counters := o.DumpActive(); len(counters) != 0 {
+			t.Errorf("shared %v: %d counters left open", shared, len(counters))
+		}
+	}
+}
+
+func TestDisplayNames(t *testing.T) {
+	events := []perfevents.PerfEventInfo{
+		{EventName: "cpu-cycles", Data: 1000},
+		{EventName: "page-faults", Data: 3},
+	}
+	names := map[string]string{"cpu-cycles": "cpu.cycles.count"}
+	tests := []struct {
+		name   string
+		prefix string
+		asTags bool
+		want   []string
+	}{
+		{"logs", "", false, []string{"cpu.cycles.count:1000", "page-faults:3"}},
+		{"prefix", "app.", false, []string{"app.cpu.cycles.count:1000", "app.page-faults:3"}},
+		{"tags", "", true, []string{"cpu.cycles.count:1000", "page-faults:3"}},
+	}
+	for _, tt := range tests {
+		o := NewObserver()
+		o.SetDisplayNames(names)
+		o.SetFieldPrefix(tt.prefix)
+		o.asTags = tt.asTags
+		sp := logSpan(o, events, time.Millisecond)
+
+		var got []string
+		if tt.asTags {
+			for _, field := range []string{"cpu.cycles.count", "page-faults", "cpu-cycles"} {
+				if v, ok := sp.Tag(field).(uint64); ok {
+					got = append(got, field+":"+strconv.FormatUint(v, 10))
+				}
+			}
+		} else {
+			got = spanLogs(sp)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: logged %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLogRates(t *testing.T) {
+	events := []perfevents.PerfEventInfo{{EventName: "cpu-cycles", Data: 5000}}
+	tests := []struct {
+		name     string
+		logRates bool
+		asTags   bool
+		duration time.Duration
+		want     interface{}
+	}{
+		{"millisecond", true, false, time.Millisecond, "5000000"},
+		{"seconds", true, false, 2 * time.Second, "2500"},
+		{"tags", true, true, 10 * time.Millisecond, 500000.0},
+		{"not logged", false, false, time.Millisecond, nil},
+		// There is no rate over no time.
+		{"no duration", true, false, 0, nil},
+	}
+	for _, tt := range tests {
+		o := NewObserver()
+		o.SetLogRates(tt.logRates)
+		o.asTags = tt.asTags
+		sp := logSpan(o, events, tt.duration)
+
+		var got interface{}
+		if tt.asTags {
+			got = sp.Tag("cpu-cycles/sec")
+		} else {
+			for _, log := range spanLogs(sp) {
+				if strings.HasPrefix(log, "cpu-cycles/sec:") {
+					got = strings.TrimPrefix(log, "cpu-cycles/sec:")
+				}
+			}
+		}
+		if got != tt.want {
+			t.Errorf("%s: cpu-cycles/sec = %v, want %v in %q", tt.name, got, tt.want, spanLogs(sp))
+		}
+	}
+}
+
+func TestReportOverhead(t *testing.T) {
+	skipWithoutPerf(t)
+	for _, tt := range []struct{ report, shared bool }{
+		{false, false}, {true, false}, {false, true}, {true, true},
+	} {
+		o := NewObserver()
+		o.SetReportOverhead(tt.report)
+		o.SetSharedCounters(tt.shared)
+		sp, so, ok := startSpan(o, mocktracer.New(), opentracing.Tags{"perfevents": "task-clock"})
+		if !ok {
+			t.Fatal("span not observed")
+		}
+		so.OnFinish(opentracing.FinishOptions{})
+
+		overhead, present := sp.Tag("perf.overhead_ns").(int64)
+		if present != tt.report {
+			t.Errorf("report %v, shared %v: perf.overhead_ns = %v", tt.report, tt.shared, sp.Tag("perf.overhead_ns"))
+		}
+		if present && overhead <= 0 {
+			t.Errorf("shared %v: overhead %dns, want > 0", tt.shared, overhead)
+		}
+	}
+}
+
+func TestFailFast(t *testing.T) {
+	skipWithoutPerf(t)
+	tests := []struct {
+		name     string
+		events   string
+		failFast bool
+		want     []string
+	}{
+		{"opened", "task-clock", true, []string{"task-clock"}},
+		{"one failing", "task-clock,no-such-event", false, []string{"task-clock"}},
+		{"one failing, fail fast", "task-clock,no-such-event", true, nil},
+		{"all failing", "no-such-event", false, []string{}},
+		{"all failing, fail fast", "no-such-event", true, nil},
+	}
+	for _, shared := range []bool{false, true} {
+		for _, tt := range tests {
+			o := NewObserver()
+			o.SetFailFast(tt.failFast)
+			o.SetSharedCounters(shared)
+			sp, so, ok := startSpan(o, mocktracer.New(), opentracing.Tags{"perfevents": tt.events})
+			if ok != (tt.want != nil) {
+				t.Errorf("shared %v, %s: observed %v, want %v", shared, tt.name, ok, tt.want != nil)
+				continue
+			}
+			if ok {
+				so.OnFinish(opentracing.FinishOptions{})
+				var got []string
+				for _, log := range spanLogs(sp) {
+					got = append(got, strings.SplitN(log, ":", 2)[0])
+				}
+				if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+					t.Errorf("shared %v, %s: logged %q, want %q", shared, tt.name, got, tt.want)
+				}
+			}
+			// The events which did open are closed either way.
+			if len(o.DumpActive()) != 0 || (shared && len(o.shared.counters) != 0) {
+				t.Errorf("shared %v, %s: events left open", shared, tt.name)
+			}
+		}
+	}
+}
+
+// A checkpoint and restore (CRIU) leaves the descriptors of the events
+// closed, the spans counting again once they are reopened.
+func TestRestoreAfterCheckpoint(t *testing.T) {
+	skipWithoutPerf(t)
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	for _, tt := range []struct {
+		events string
+		shared bool
+	}{
+		{"page-faults", false},
+		{"{page-faults,task-clock}", false},
+		{"page-faults", true},
+	} {
+		o := NewObserver()
+		o.SetSharedCounters(tt.shared)
+		sp, so, ok := startSpan(o, mocktracer.New(), opentracing.Tags{"perfevents": tt.events})
+		if !ok {
+			t.Fatal("span not observed")
+		}
+		events := so.EventDescs
+		if tt.shared {
+			events = []perfevents.PerfEventInfo{o.shared.counters["page-faults"].event}
+		}
+		touchPages(256)
+		for _, event := range events {
+			syscall.Close(event.Fd)
+			if !event.IsStale() {
+				t.Fatalf("%s: IsStale() false on a closed descriptor", tt.events)
+			}
+		}
+
+		if err := o.RestoreAfterCheckpoint(); err != nil {
+			t.Fatalf("%s: RestoreAfterCheckpoint() = %v", tt.events, err)
+		}
+		events = so.EventDescs
+		if tt.shared {
+			events = []perfevents.PerfEventInfo{o.shared.counters["page-faults"].event}
+		}
+		for i, event := range events {
+			if event.IsStale() || !event.IsEnabled() {
+				t.Errorf("%s: %s reopened stale %t, enabled %t", tt.events, event.EventName,
+					event.IsStale(), event.IsEnabled())
+			}
+			if i > 0 && event.GroupFd != events[0].Fd {
+				t.Errorf("%s: %s reopened in group %d, want %d", tt.events, event.EventName,
+					event.GroupFd, events[0].Fd)
+			}
+		}
+		// The faults before the restore are lost.
+		touchPages(16)
+		so.OnFinish(opentracing.FinishOptions{})
+		if faults := loggedCount(t, sp, "page-faults"); faults < 16 || faults >= 256 {
+			t.Errorf("%s: logged %d page faults, want the 16 after the restore", tt.events, faults)
+		}
+	}
+}
+
+func TestErrorHandler(t *testing.T) {
+	skipWithoutPerf(t)
+	var errs []error
+	handler := func(err error) { errs = append(errs, err) }
+	fromConfig, err := NewObserverFromConfig(ObserverConfig{ErrorHandler: handler})
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := NewObserver()
+	set.SetErrorHandler(handler)
+
+	for name, o := range map[string]*Observer{"config": fromConfig, "set": set} {
+		// Opening an unknown event.
+		errs = nil
+		_, so, ok := startSpan(o, mocktracer.New(), opentracing.Tags{"perfevents": "task-clock,no-such-event"})
+		if !ok {
+			t.Fatalf("%s: span not observed", name)
+		}
+		if len(errs) != 1 || errs[0] != perfevents.PerfUnsupportedEvent {
+			t.Errorf("%s: open errors %v, want %v", name, errs, perfevents.PerfUnsupportedEvent)
+		}
+
+		// Reading an event closed behind its back.
+		errs = nil
+		syscall.Close(so.EventDescs[0].Fd)
+		so.OnFinish(opentracing.FinishOptions{})
+		if len(errs) == 0 || errs[0] != perfevents.PerfReadError {
+			t.Errorf("%s: read errors %v, want %v", name, errs, perfevents.PerfReadError)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package otobserver
+
+import (
+	"strconv"
+)
+
+// The tag naming the process the events of a span count, e.g. a worker
+// process the span waits for, rather than the thread starting the span,
+// see perfevents.InitOpenEventsEnable.
+const pidTag = "perfevents.pid"
+
+// tagPid returns the process the pid tag "value" names, as a number or as
+// a string.
+func tagPid(value interface{}) (int, bool) {
+	switch v := value.(type) {
+	case int:
+		return v, true
+	case int32:
+		return int(v), true
+	case int64:
+		return int(v), true
+	case string:
+		pid, err := strconv.Atoi(v)
+		return pid, err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package otobserver
+
+import (
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+func TestTagPid(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		pid   int
+		ok    bool
+	}{
+		{1234, 1234, true},
+		{int32(1234), 1234, true},
+		{int64(1234), 1234, true},
+		{"1234", 1234, true},
+		{"-1", -1, true},
+		{"12a", 0, false},
+		{"", 0, false},
+		{1234.0, 0, false},
+		{nil, 0, false},
+	}
+	for _, tt := range tests {
+		if pid, ok := tagPid(tt.value); pid != tt.pid || ok != tt.ok {
+			t.Errorf("tagPid(%#v) = %d, %v, want %d, %v", tt.value, pid, ok, tt.pid, tt.ok)
+		}
+	}
+}
+
+func TestSpanPid(t *testing.T) {
+	skipWithoutPerf(t)
+	cmd := exec.Command("sh", "-c", "while :; do :; done")
+	if err := cmd.Start(); err != nil {
+		t.Skipf("can't run sh: %v", err)
+	}
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+
+	tests := []struct {
+		name  string
+		value interface{}
+		pid   int
+	}{
+		{"number", cmd.Process.Pid, cmd.Process.Pid},
+		{"string", strconv.Itoa(cmd.Process.Pid), cmd.Process.Pid},
+		// The thread starting the span otherwise.
+		{"invalid", "sh", 0},
+		{"negative", -1, 0},
+	}
+	for _, tt := range tests {
+		tracer := mocktracer.New()
+		sp, so, ok := startSpan(NewObserver(), tracer, opentracing.Tags{
+			"perfevents": "task-clock",
+			pidTag:       tt.value,
+		})
+		if !ok {
+			t.Fatal("span not observed")
+		}
+		if so.pid != tt.pid {
+			t.Errorf("%s: the span counts process %d, want %d", tt.name, so.pid, tt.pid)
+		}
+		if len(so.EventDescs) != 1 {
+			t.Fatalf("%s: opened %d events, want 1", tt.name, len(so.EventDescs))
+		}
+		time.Sleep(50 * time.Millisecond)
+		so.OnFinish(opentracing.FinishOptions{})
+
+		// The busy process ran for about as long as the span.
+		if tt.pid == 0 {
+			continue
+		}
+		logs := spanLogs(sp)
+		var count uint64
+		if len(logs) != 0 {
+			count, _ = strconv.ParseUint(strings.TrimPrefix(logs[0], "task-clock:"), 10, 64)
+		}
+		if count < uint64(10*time.Millisecond) {
+			t.Errorf("%s: logged %q, want the time the process ran", tt.name, logs)
+		}
+	}
+}
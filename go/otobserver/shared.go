@@ -0,0 +1,131 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package otobserver
+
+import (
+	"sync"
+
+	perfevents "github.com/opentracing-contrib/perfevents/go"
+)
+
+// sharedCounter is a counter shared by all the spans requesting its
+// event while it is open.
+type sharedCounter struct {
+	event perfevents.PerfEventInfo
+	refs  int
+}
+
+// sharedCounterUse is the use of a shared counter by a span, with the
+// count of the counter when the span started using it, and the epoch of
+// the counter then, the baseline being void once the counter is reset.
+type sharedCounterUse struct {
+	counter  *sharedCounter
+	baseline uint64
+	epoch    uint64
+}
+
+// sharedCounters keeps the open shared counters, by event name.
+type sharedCounters struct {
+	mu       sync.Mutex
+	counters map[string]*sharedCounter
+}
+
+func newSharedCounters() *sharedCounters {
+	return &sharedCounters{counters: make(map[string]*sharedCounter)}
+}
+
+// acquire starts using the counters of the events in the event list
+// "events", opening the ones which aren't open yet. Events which can't
+// be opened are left out, their errors passed to "handleError". Shared
+// counters are never grouped.
+func (sc *sharedCounters) acquire(events string, handleError func(error)) []sharedCounterUse {
+	list, err := perfevents.ParseEventList(events)
+	if err != nil {
+		handleError(err)
+		return nil
+	}
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	uses := make([]sharedCounterUse, 0)
+	acquired := make(map[perfevents.PerfEventAttr]bool)
+	for _, parsed := range list.Events {
+		if parsed.Err != nil || acquired[parsed.Attr()] {
+			continue
+		}
+		acquired[parsed.Attr()] = true
+		name := parsed.Name
+		counter, ok := sc.counters[name]
+		if !ok {
+			counter = &sharedCounter{}
+			err := (&counter.event).InitOpenEventEnableSelf(name)
+			if err != nil {
+				handleError(err)
+				continue
+			}
+			sc.counters[name] = counter
+		}
+		baseline, err := (&counter.event).Peek()
+		if err != nil {
+			handleError(err)
+			handleError(sc.unref(name, counter))
+			continue
+		}
+		counter.refs++
+		uses = append(uses, sharedCounterUse{counter, baseline, counter.event.Epoch})
+	}
+	return uses
+}
+
+// release stops using the counters of "uses", closing the ones which
+// aren't used anymore. It returns the events with their counts since
+// they started being used. The errors are passed to "handleError".
+func (sc *sharedCounters) release(uses []sharedCounterUse, handleError func(error)) []perfevents.PerfEventInfo {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	events := make([]perfevents.PerfEventInfo, 0, len(uses))
+	for _, use := range uses {
+		counter := use.counter
+		data, err := (&counter.event).Peek()
+		if err == nil {
+			event := counter.event
+			event.Data = data
+			if use.epoch == event.Epoch {
+				event.Data -= use.baseline
+			}
+			events = append(events, event)
+		} else {
+			handleError(err)
+		}
+		counter.refs--
+		handleError(sc.unref(counter.event.EventName, counter))
+	}
+	return events
+}
+
+// unref closes the counter of the event "name" if no span uses it.
+func (sc *sharedCounters) unref(name string, counter *sharedCounter) error {
+	if counter.refs > 0 {
+		return nil
+	}
+	delete(sc.counters, name)
+	return (&counter.event).DisableClose()
+}
+
+// reopen opens all the counters again, see Reopen.
+func (sc *sharedCounters) reopen() error {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	var lastErr error
+	for _, counter := range sc.counters {
+		err := (&counter.event).Reopen()
+		if err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
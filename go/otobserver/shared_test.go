@@ -0,0 +1,158 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package otobserver
+
+import (
+	"os"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+
+	perfevents "github.com/opentracing-contrib/perfevents/go"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+// touchPages writes "n" pages of fresh memory, for the page faults to
+// count.
+func touchPages(n int) {
+	pageSize := os.Getpagesize()
+	buf, err := syscall.Mmap(-1, 0, n*pageSize, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_ANON|syscall.MAP_PRIVATE)
+	if err != nil {
+		panic(err)
+	}
+	for i := 0; i < len(buf); i += pageSize {
+		buf[i] = 1
+	}
+	syscall.Munmap(buf)
+}
+
+// failOnError fails the test on any error passed to the handler.
+func failOnError(t *testing.T) func(error) {
+	return func(err error) {
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+}
+
+// releasedCount returns the count of "event" among "events".
+func releasedCount(events []perfevents.PerfEventInfo, event string) (uint64, bool) {
+	for _, e := range events {
+		if e.EventName == event {
+			return e.Data, true
+		}
+	}
+	return 0, false
+}
+
+func TestSharedCounters(t *testing.T) {
+	skipWithoutPerf(t)
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	sc := newSharedCounters()
+
+	outer := sc.acquire("page-faults,task-clock", failOnError(t))
+	touchPages(64)
+	// The same event twice only takes the counter once.
+	inner := sc.acquire("page-faults,page-faults", failOnError(t))
+	if len(outer) != 2 || len(inner) != 1 || len(sc.counters) != 2 {
+		t.Fatalf("acquired %d and %d uses of %d counters, want 2 and 1 of 2", len(outer), len(inner), len(sc.counters))
+	}
+	if inner[0].counter != outer[0].counter || inner[0].counter.refs != 2 {
+		t.Errorf("the counters aren't shared: %p, %p", inner[0].counter, outer[0].counter)
+	}
+	touchPages(16)
+
+	innerEvents := sc.release(inner, failOnError(t))
+	if len(sc.counters) != 2 || outer[0].counter.refs != 1 {
+		t.Errorf("released the shared counter with a use left")
+	}
+	touchPages(16)
+	outerEvents := sc.release(outer, failOnError(t))
+	if len(sc.counters) != 0 {
+		t.Errorf("%d counters left open, want none", len(sc.counters))
+	}
+
+	// Every use only counts from when it started.
+	innerFaults, _ := releasedCount(innerEvents, "page-faults")
+	outerFaults, _ := releasedCount(outerEvents, "page-faults")
+	if innerFaults < 16 || innerFaults >= 64 || outerFaults < 96 {
+		t.Errorf("counted %d and %d page faults, want 16 and 96 at least", innerFaults, outerFaults)
+	}
+	if taskClock, ok := releasedCount(outerEvents, "task-clock"); !ok || taskClock == 0 {
+		t.Errorf("task-clock = %d, %v, want the time of the use", taskClock, ok)
+	}
+}
+
+func TestSharedCountersReset(t *testing.T) {
+	skipWithoutPerf(t)
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	sc := newSharedCounters()
+
+	uses := sc.acquire("page-faults", failOnError(t))
+	if len(uses) != 1 {
+		t.Fatalf("acquired %d uses, want 1", len(uses))
+	}
+	touchPages(64)
+	// Once reset, the counter counts from there.
+	if err := uses[0].counter.event.ResetEvent(); err != nil {
+		t.Fatal(err)
+	}
+	touchPages(16)
+	faults, _ := releasedCount(sc.release(uses, failOnError(t)), "page-faults")
+	if faults < 16 || faults >= 64 {
+		t.Errorf("counted %d page faults, want those since the reset", faults)
+	}
+}
+
+func TestSharedCountersErrors(t *testing.T) {
+	var errs []error
+	handleError := func(err error) {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	sc := newSharedCounters()
+	if uses := sc.acquire("{page-faults", handleError); uses != nil || len(errs) != 1 {
+		t.Errorf("acquire() of a malformed list = %v, errors %v", uses, errs)
+	}
+	// The unknown events are left out.
+	errs = nil
+	if uses := sc.acquire("no-such-event", handleError); len(uses) != 0 || len(sc.counters) != 0 || len(errs) != 0 {
+		t.Errorf("acquire() of an unknown event = %v, errors %v", uses, errs)
+	}
+}
+
+func TestObserverSharedCounters(t *testing.T) {
+	skipWithoutPerf(t)
+	o := NewObserver()
+	o.SetSharedCounters(true)
+	tracer := mocktracer.New()
+	tags := opentracing.Tags{"perfevents": "task-clock"}
+
+	outerSp, outer, ok := startSpan(o, tracer, tags)
+	if !ok {
+		t.Fatal("span not observed")
+	}
+	innerSp, inner, ok := startSpan(o, tracer, tags)
+	if !ok {
+		t.Fatal("span not observed")
+	}
+	if len(outer.EventDescs) != 0 || len(outer.sharedUses) != 1 || len(o.shared.counters) != 1 {
+		t.Fatalf("the spans don't share a counter")
+	}
+	inner.OnFinish(opentracing.FinishOptions{})
+	outer.OnFinish(opentracing.FinishOptions{})
+	for _, sp := range []*mocktracer.MockSpan{innerSp, outerSp} {
+		if logs := strings.Join(spanLogs(sp), " "); !strings.Contains(logs, "task-clock:") {
+			t.Errorf("task-clock not logged in %q", logs)
+		}
+	}
+	if len(o.shared.counters) != 0 {
+		t.Errorf("%d counters left open, want none", len(o.shared.counters))
+	}
+}
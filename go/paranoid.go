@@ -0,0 +1,54 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// The kernel restricts what unprivileged users can measure as per the
+// level in paranoidPath. Users with CAP_PERFMON (or CAP_SYS_ADMIN) are
+// not restricted.
+var paranoidPath = "/proc/sys/kernel/perf_event_paranoid"
+
+// ParanoidLevel reads the perf_event_paranoid level of the kernel.
+func ParanoidLevel() (int, error) {
+	buf, err := ioutil.ReadFile(paranoidPath)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(buf)))
+}
+
+// paranoidSummary explains what unprivileged users may measure at a
+// perf_event_paranoid level.
+func paranoidSummary(level int) string {
+	switch {
+	case level <= -1:
+		return "level " + strconv.Itoa(level) + ": no restrictions, all events for all processes and CPUs"
+	case level == 0:
+		return "level 0: user-space and kernel measurements, for any process and CPU, no raw tracepoints"
+	case level == 1:
+		return "level 1: user-space and kernel measurements for own processes, no CPU-wide events"
+	case level == 2:
+		return "level 2: only user-space measurements for own processes"
+	default:
+		return "level " + strconv.Itoa(level) + ": no measurements allowed without CAP_PERFMON"
+	}
+}
+
+// PermissionSummary returns a human readable explanation of what
+// unprivileged users may measure as per the perf_event_paranoid level of
+// the kernel, e.g. "level 2: only user-space measurements for own
+// processes". It is meant to be logged at startup, to tell why some
+// events fail to open.
+func PermissionSummary() string {
+	level, err := ParanoidLevel()
+	if err != nil {
+		return "unknown perf_event_paranoid level: " + err.Error()
+	}
+	return paranoidSummary(level)
+}
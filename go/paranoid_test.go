@@ -0,0 +1,69 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setParanoidLevel has ParanoidLevel read "level" as the content of
+// perf_event_paranoid, or no file if empty.
+func setParanoidLevel(t *testing.T, level string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "perf_event_paranoid")
+	if level != "" {
+		if err := ioutil.WriteFile(path, []byte(level), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	saved := paranoidPath
+	paranoidPath = path
+	t.Cleanup(func() { paranoidPath = saved })
+}
+
+func TestPermissionSummary(t *testing.T) {
+	tests := []struct {
+		level   string
+		want    int
+		summary string
+	}{
+		{"-1\n", -1, "level -1: no restrictions, all events for all processes and CPUs"},
+		{"0\n", 0, "level 0: user-space and kernel measurements, for any process and CPU, no raw tracepoints"},
+		{"1\n", 1, "level 1: user-space and kernel measurements for own processes, no CPU-wide events"},
+		{"2\n", 2, "level 2: only user-space measurements for own processes"},
+		{"2", 2, "level 2: only user-space measurements for own processes"},
+		{"3\n", 3, "level 3: no measurements allowed without CAP_PERFMON"},
+		{"4\n", 4, "level 4: no measurements allowed without CAP_PERFMON"},
+	}
+	for _, tt := range tests {
+		t.Run(strings.TrimSpace(tt.level), func(t *testing.T) {
+			setParanoidLevel(t, tt.level)
+			level, err := ParanoidLevel()
+			if err != nil || level != tt.want {
+				t.Errorf("ParanoidLevel() = %d, %v, want %d", level, err, tt.want)
+			}
+			if got := PermissionSummary(); got != tt.summary {
+				t.Errorf("PermissionSummary() = %q, want %q", got, tt.summary)
+			}
+		})
+	}
+}
+
+func TestPermissionSummaryUnknown(t *testing.T) {
+	setParanoidLevel(t, "")
+	if _, err := ParanoidLevel(); err == nil {
+		t.Error("ParanoidLevel() without perf_event_paranoid succeeded")
+	}
+	if got := PermissionSummary(); !strings.HasPrefix(got, "unknown perf_event_paranoid level: ") {
+		t.Errorf("PermissionSummary() = %q", got)
+	}
+
+	setParanoidLevel(t, "paranoid\n")
+	if _, err := ParanoidLevel(); err == nil {
+		t.Error("ParanoidLevel() of a non number succeeded")
+	}
+}
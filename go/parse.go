@@ -0,0 +1,192 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"errors"
+	"strings"
+)
+
+var PerfUnknownModifier = errors.New("unknown event modifier")
+
+// ParsedEvent is an entry of a parsed event list.
+// Name : the event as written in the list, e.g. "cycles:u".
+// Canonical : the name of the event, aliases resolved and modifiers
+// left out, e.g. "cpu-cycles".
+// Type, Config : the type (PERF_TYPE_*) and config value of the event.
+// Modifiers : the modifiers of the event, e.g. "u".
+// Group : index of the group of the event in the list, -1 if the event
+// stands alone.
+// Leader : whether the event leads its group.
+// Err : why the event can't be opened, if it can't.
+type ParsedEvent struct {
+	Name      string
+	Canonical string
+	Type      uint32
+	Config    uint64
+	Modifiers string
+	Group     int
+	Leader    bool
+	Err       error
+	attr      PerfEventAttr
+}
+
+// Attr returns the attributes the event is opened with, which tell apart
+// the events counting the same, e.g. "cycles" and "cpu-cycles".
+func (event ParsedEvent) Attr() PerfEventAttr {
+	return event.attr
+}
+
+// ParsedEventList is the result of parsing an event list.
+type ParsedEventList struct {
+	Events []ParsedEvent
+}
+
+// ParseEventList parses the event list "events", as per the perf CLI
+// grammar : a comma separated list of events, where the events between
+// braces form a group and each event may be followed by modifiers, e.g.
+// "{cycles:u,instructions:u},cache-misses". Presets are expanded and
+// aliases resolved.
+// Only a syntax error in the list is returned as an error. An event
+// which can't be resolved has its Err set.
+//
+// The supported modifiers are :
+// u : count in user space
+// k : count in the kernel
+// h : count in the hypervisor
+// p : sample precisely, may be repeated up to 3 times
+// Without any of u, k and h, the event counts in user space only.
+func ParseEventList(events string) (ParsedEventList, error) {
+	var list ParsedEventList
+	groups, err := ParseEventGroups(events)
+	if err != nil {
+		return list, err
+	}
+
+	nGroups := 0
+	for _, group := range groups {
+		groupIndex := -1
+		if len(group) > 1 {
+			groupIndex = nGroups
+			nGroups++
+		}
+		for i, name := range group {
+			event := parseEvent(name)
+			event.Group = groupIndex
+			event.Leader = groupIndex != -1 && i == 0
+			list.Events = append(list.Events, event)
+		}
+	}
+	return list, nil
+}
+
+// groups returns the events of the list by group, an event standing
+// alone being a group of its own.
+func (list ParsedEventList) groups() [][]ParsedEvent {
+	groups := make([][]ParsedEvent, 0, len(list.Events))
+	for i, event := range list.Events {
+		if event.Group != -1 && i > 0 && list.Events[i-1].Group == event.Group {
+			last := len(groups) - 1
+			groups[last] = append(groups[last], event)
+			continue
+		}
+		groups = append(groups, []ParsedEvent{event})
+	}
+	return groups
+}
+
+// parseEvent resolves a single event of an event list.
+func parseEvent(name string) ParsedEvent {
+	event := ParsedEvent{Name: name, Group: -1}
+	base := name
+	tracepoint, modifiers, isTracepoint := splitTracepoint(name)
+	if isTracepoint {
+		base, event.Modifiers = tracepoint, modifiers
+	} else if i := strings.IndexByte(name, ':'); i >= 0 {
+		base, event.Modifiers = name[:i], name[i+1:]
+	}
+	event.Canonical = canonicalEventName(base)
+
+	if isTracepoint && isProbeEvent(event.Canonical) {
+		event.attr, event.Err = resolveProbe(event.Canonical)
+	} else if isTracepoint {
+		event.attr, event.Err = resolveTracepoint(event.Canonical)
+	} else if cfg, ok := initEventList()[event.Canonical]; ok {
+		event.attr = setupPerfEventAttr(cfg)
+	} else if pmu, ok := sysfsEventList[event.Canonical]; ok {
+		event.attr, event.Err = resolveSysfsEvent(pmu, event.Canonical)
+	} else if config, ok := parseRawEvent(event.Canonical); ok {
+		event.attr = setupPerfEventAttr(EventConfigType{PERF_TYPE_RAW, config})
+	} else {
+		event.Err = PerfUnsupportedEvent
+	}
+	if event.Err != nil {
+		return event
+	}
+
+	event.Err = event.attr.applyModifiers(event.Modifiers)
+	event.Type = event.attr.Type
+	event.Config = event.attr.Config
+	return event
+}
+
+// applyModifiers sets up the attributes of an event as per its modifiers.
+func (eventAttr *PerfEventAttr) applyModifiers(modifiers string) error {
+	var user, kernel, hv bool
+	precise := uint64(0)
+	for _, m := range modifiers {
+		switch m {
+		case 'u':
+			user = true
+		case 'k':
+			kernel = true
+		case 'h':
+			hv = true
+		case 'p':
+			precise++
+		default:
+			return PerfUnknownModifier
+		}
+	}
+	if precise > 3 {
+		return PerfUnknownModifier
+	}
+
+	if user || kernel || hv {
+		excludes := []struct {
+			counted bool
+			bit     uint64
+		}{{user, EXCLUDE_USER}, {kernel, EXCLUDE_KERNEL}, {hv, EXCLUDE_HV}}
+		for _, e := range excludes {
+			if e.counted {
+				eventAttr.Bits &^= 1 << e.bit
+			} else {
+				eventAttr.Bits = setBit(eventAttr.Bits, e.bit)
+			}
+		}
+	}
+	// precise_ip is a 2 bits field.
+	if precise&1 != 0 {
+		eventAttr.Bits = setBit(eventAttr.Bits, PRECISE_IP1)
+	}
+	if precise&2 != 0 {
+		eventAttr.Bits = setBit(eventAttr.Bits, PRECISE_IP2)
+	}
+	return nil
+}
+
+// ValidateEvents checks that the event list "events" is well formed and
+// that all its events are supported.
+func ValidateEvents(events string) error {
+	list, err := ParseEventList(events)
+	if err != nil {
+		return err
+	}
+	for _, event := range list.Events {
+		if event.Err != nil {
+			return event.Err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"testing"
+)
+
+func TestParseEventList(t *testing.T) {
+	list, err := ParseEventList("{cycles:u,instructions:k},cache-misses,r003c:ukh,not-an-event,{cs,faults},task-clock:x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ParsedEvent{
+		{Name: "cycles:u", Canonical: "cpu-cycles", Type: PERF_TYPE_HARDWARE, Config: PERF_HW_CPU_CYCLES, Modifiers: "u", Group: 0, Leader: true},
+		{Name: "instructions:k", Canonical: "instructions", Type: PERF_TYPE_HARDWARE, Config: PERF_HW_INSTRUCTIONS, Modifiers: "k", Group: 0},
+		{Name: "cache-misses", Canonical: "cache-misses", Type: PERF_TYPE_HARDWARE, Config: PERF_HW_CACHE_MISSES, Group: -1},
+		{Name: "r003c:ukh", Canonical: "r003c", Type: PERF_TYPE_RAW, Config: 0x3c, Modifiers: "ukh", Group: -1},
+		{Name: "not-an-event", Canonical: "not-an-event", Group: -1, Err: PerfUnsupportedEvent},
+		{Name: "cs", Canonical: "context-switches", Type: PERF_TYPE_SOFTWARE, Config: PERF_COUNT_SW_CONTEXT_SWITCHES, Group: 1, Leader: true},
+		{Name: "faults", Canonical: "page-faults", Type: PERF_TYPE_SOFTWARE, Config: PERF_COUNT_SW_PAGE_FAULTS, Group: 1},
+		{Name: "task-clock:x", Canonical: "task-clock", Type: PERF_TYPE_SOFTWARE, Config: PERF_COUNT_SW_TASK_CLOCK, Modifiers: "x", Group: -1, Err: PerfUnknownModifier},
+	}
+	if len(list.Events) != len(want) {
+		t.Fatalf("parsed %d events, want %d", len(list.Events), len(want))
+	}
+	for i, event := range list.Events {
+		event.attr = PerfEventAttr{}
+		// The type and config of an event which doesn't resolve
+		// don't matter.
+		if want[i].Err == PerfUnknownModifier {
+			event.Type, event.Config = want[i].Type, want[i].Config
+		}
+		if event != want[i] {
+			t.Errorf("event %d = %+v, want %+v", i, event, want[i])
+		}
+	}
+
+	groups := list.groups()
+	if len(groups) != 6 || len(groups[0]) != 2 || len(groups[4]) != 2 {
+		t.Errorf("groups() = %+v, want 6 groups, the first and fifth of 2 events", groups)
+	}
+
+	if _, err := ParseEventList("{cycles,instructions"); err != PerfEventListSyntax {
+		t.Errorf("ParseEventList() of an unclosed group = %v, want %v", err, PerfEventListSyntax)
+	}
+}
+
+// The aliases of an event are opened with the same attributes.
+func TestParseEventAliases(t *testing.T) {
+	aliases := [][2]string{
+		{"cycles", "cpu-cycles"},
+		{"branches", "branch-instructions"},
+		{"faults", "page-faults"},
+		{"cs:u", "context-switches"},
+		{"migrations:u", "cpu-migrations:u"},
+	}
+	for _, a := range aliases {
+		alias, event := parseEvent(a[0]), parseEvent(a[1])
+		if alias.Err != nil || alias.Attr() != event.Attr() {
+			t.Errorf("%s not opened as %s: %v", a[0], a[1], alias.Err)
+		}
+	}
+	if parseEvent("cycles:k").Attr() == parseEvent("cycles").Attr() {
+		t.Error("cycles:k opened as cycles")
+	}
+}
+
+func TestApplyModifiers(t *testing.T) {
+	const excludes = 1<<EXCLUDE_USER | 1<<EXCLUDE_KERNEL | 1<<EXCLUDE_HV
+	const precise = 1<<PRECISE_IP1 | 1<<PRECISE_IP2
+	tests := []struct {
+		modifiers string
+		bits      uint64
+		err       error
+	}{
+		{"", 1<<EXCLUDE_KERNEL | 1<<EXCLUDE_HV, nil},
+		{"u", 1<<EXCLUDE_KERNEL | 1<<EXCLUDE_HV, nil},
+		{"k", 1<<EXCLUDE_USER | 1<<EXCLUDE_HV, nil},
+		{"h", 1<<EXCLUDE_USER | 1<<EXCLUDE_KERNEL, nil},
+		{"uk", 1 << EXCLUDE_HV, nil},
+		{"ku", 1 << EXCLUDE_HV, nil},
+		{"ukh", 0, nil},
+		{"p", 1<<EXCLUDE_KERNEL | 1<<EXCLUDE_HV | 1<<PRECISE_IP1, nil},
+		{"pp", 1<<EXCLUDE_KERNEL | 1<<EXCLUDE_HV | 1<<PRECISE_IP2, nil},
+		{"ppp", 1<<EXCLUDE_KERNEL | 1<<EXCLUDE_HV | 1<<PRECISE_IP1 | 1<<PRECISE_IP2, nil},
+		{"kpp", 1<<EXCLUDE_USER | 1<<EXCLUDE_HV | 1<<PRECISE_IP2, nil},
+		{"pppp", 0, PerfUnknownModifier},
+		{"x", 0, PerfUnknownModifier},
+		{"u,k", 0, PerfUnknownModifier},
+	}
+	for _, tt := range tests {
+		eventAttr := setupPerfEventAttr(EventConfigType{PERF_TYPE_HARDWARE, PERF_HW_CPU_CYCLES})
+		err := eventAttr.applyModifiers(tt.modifiers)
+		if err != tt.err {
+			t.Errorf("applyModifiers(%q) = %v, want %v", tt.modifiers, err, tt.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if bits := eventAttr.Bits & (excludes | precise); bits != tt.bits {
+			t.Errorf("applyModifiers(%q) set the bits %#x, want %#x", tt.modifiers, bits, tt.bits)
+		}
+		if eventAttr.Bits&(1<<DISABLED) == 0 {
+			t.Errorf("applyModifiers(%q) cleared the disabled bit", tt.modifiers)
+		}
+	}
+}
+
+func TestValidateEvents(t *testing.T) {
+	tests := []struct {
+		events string
+		err    error
+	}{
+		{"cpu-cycles", nil},
+		{"cycles:u,instructions:k,r003c", nil},
+		{"{cpu-cycles,instructions},task-clock:ukh", nil},
+		{"default", nil},
+		{"L1-dcache-load-misses", nil},
+		{"cpu-cycles,not-an-event", PerfUnsupportedEvent},
+		{"cpu-cycles:q", PerfUnknownModifier},
+		{"cpu-cycles:pppp", PerfUnknownModifier},
+		{"{cpu-cycles,instructions", PerfEventListSyntax},
+		{"", PerfUnsupportedEvent},
+	}
+	for _, tt := range tests {
+		if err := ValidateEvents(tt.events); err != tt.err {
+			t.Errorf("ValidateEvents(%q) = %v, want %v", tt.events, err, tt.err)
+		}
+	}
+}
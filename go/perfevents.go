@@ -4,12 +4,15 @@
 package perfevents
 
 import (
-	"encoding/binary"
 	"errors"
+	"os"
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 	"unsafe"
+
+	"golang.org/x/sys/unix"
 )
 
 // To create an event in the kernel which can monitor/profile for
@@ -30,36 +33,19 @@ import (
 // restrict the event counting to any one cpu, then, we specify
 // the value of this argument to be -1.
 
-// PerfEventAttr structure is derived from linux/perf_event.h
+// PerfEventAttr is the perf_event_attr structure of linux/perf_event.h,
+// as golang.org/x/sys/unix defines it, which keeps up with the kernel.
 // This struct defines various attributes for a perf event. This is what
 // is set and sent to the linux kernel to create an event.
 //
-// Note : For the unions, only one member has been taken, viz.
-// sample_period, wakeup_events, config1 and config2 are the members
-// of a union. There are two members in each of the mentioned unions
-// and both of them have the same size in all of the unions.
-type PerfEventAttr struct {
-	type_hw            uint32
-	size_s             uint32
-	config             uint64
-	sample_period      uint64
-	sample_type        uint64
-	read_format        uint64
-	properties         uint64
-	wakeup_events      uint32
-	bp_type            uint32
-	config1            uint64
-	config2            uint64
-	branch_sample_type uint64
-	sample_regs_user   uint64
-	sample_stack_user  uint32
-	clockid            int32
-	sample_regs_intr   uint64
-	aux_watermark      uint32
-	reserved_2         uint32
-}
-
-// Bit fields for the PerfEventAttr.properties value derived from
+// The unions of perf_event_attr are named after one of their members :
+// Sample is sample_period or sample_freq, Wakeup is wakeup_events or
+// wakeup_watermark, Ext1 is config1 (bp_addr, kprobe_func, uprobe_path)
+// and Ext2 is config2 (bp_len, kprobe_addr, probe_offset). Bits holds the
+// bit fields, see DISABLED and the following bits.
+type PerfEventAttr unix.PerfEventAttr
+
+// Bit fields for the PerfEventAttr.Bits value derived from
 // linux/perf_event.h
 // Each of these bits specify how do we want to start our counter.
 const (
@@ -94,10 +80,13 @@ const (
 )
 
 // PMU hardware type definitions (from linux/perf_event.h)
-// Only HARDWARE type is supported as of now.
+// The HARDWARE, SOFTWARE, HW_CACHE and RAW types are supported.
 const (
-	PERF_TYPE_HARDWARE = 0
-	PERF_TYPE_SOFTWARE = 1
+	PERF_TYPE_HARDWARE   = 0
+	PERF_TYPE_SOFTWARE   = 1
+	PERF_TYPE_TRACEPOINT = 2
+	PERF_TYPE_HW_CACHE   = 3
+	PERF_TYPE_RAW        = 4
 )
 
 // List of generic events supported (from linux/perf_event.h)
@@ -112,6 +101,21 @@ const (
 	PERF_HW_BUS_CYCLES          = 6
 )
 
+// List of the software events supported (from linux/perf_event.h)
+// All of these events belong to SOFTWARE type events, which the kernel
+// counts itself, without any PMU, e.g. on a VM.
+const (
+	PERF_COUNT_SW_CPU_CLOCK        = 0
+	PERF_COUNT_SW_TASK_CLOCK       = 1
+	PERF_COUNT_SW_PAGE_FAULTS      = 2
+	PERF_COUNT_SW_CONTEXT_SWITCHES = 3
+	PERF_COUNT_SW_CPU_MIGRATIONS   = 4
+	PERF_COUNT_SW_PAGE_FAULTS_MIN  = 5
+	PERF_COUNT_SW_PAGE_FAULTS_MAJ  = 6
+	PERF_COUNT_SW_ALIGNMENT_FAULTS = 7
+	PERF_COUNT_SW_EMULATION_FAULTS = 8
+)
+
 // EventConfigType : The configuration struct for an event
 type EventConfigType struct {
 	typeHw uint32
@@ -125,11 +129,15 @@ var PerfTooManyEvents = errors.New("too many events requested")
 var PerfUnsupportedEvent = errors.New("event(s) not supported")
 var PerfFdError = errors.New("incorrect file descriptor for event")
 var PerfReadError = errors.New("error in reading event data")
+var PerfPermissionError = errors.New("not permitted to measure the task or CPU")
+var PerfBusyError = errors.New("PMU busy, event couldn't get exclusive access")
+var PerfAttrSizeError = errors.New("attributes too large or too small for the kernel")
 
 // Initializes the event list.
-// For now, we support only 7 generic hardware events.
+// For now, we support the 7 generic hardware events, the software events
+// and the hardware cache events.
 func initEventList() map[string]EventConfigType {
-	return map[string]EventConfigType{
+	events := map[string]EventConfigType{
 		"cpu-cycles":          {PERF_TYPE_HARDWARE, PERF_HW_CPU_CYCLES},
 		"instructions":        {PERF_TYPE_HARDWARE, PERF_HW_INSTRUCTIONS},
 		"cache-references":    {PERF_TYPE_HARDWARE, PERF_HW_CACHE_REF},
@@ -137,48 +145,160 @@ func initEventList() map[string]EventConfigType {
 		"branch-instructions": {PERF_TYPE_HARDWARE, PERF_HW_BRANCH_INSTRUCTIONS},
 		"branch-misses":       {PERF_TYPE_HARDWARE, PERF_HW_BRANCH_MISSES},
 		"bus-cycles":          {PERF_TYPE_HARDWARE, PERF_HW_BUS_CYCLES},
+		"cpu-clock":           {PERF_TYPE_SOFTWARE, PERF_COUNT_SW_CPU_CLOCK},
+		"task-clock":          {PERF_TYPE_SOFTWARE, PERF_COUNT_SW_TASK_CLOCK},
+		"page-faults":         {PERF_TYPE_SOFTWARE, PERF_COUNT_SW_PAGE_FAULTS},
+		"context-switches":    {PERF_TYPE_SOFTWARE, PERF_COUNT_SW_CONTEXT_SWITCHES},
+		"cpu-migrations":      {PERF_TYPE_SOFTWARE, PERF_COUNT_SW_CPU_MIGRATIONS},
+		"minor-faults":        {PERF_TYPE_SOFTWARE, PERF_COUNT_SW_PAGE_FAULTS_MIN},
+		"major-faults":        {PERF_TYPE_SOFTWARE, PERF_COUNT_SW_PAGE_FAULTS_MAJ},
+		"alignment-faults":    {PERF_TYPE_SOFTWARE, PERF_COUNT_SW_ALIGNMENT_FAULTS},
+		"emulation-faults":    {PERF_TYPE_SOFTWARE, PERF_COUNT_SW_EMULATION_FAULTS},
 	}
+	addHWCacheEvents(events)
+	return events
+}
+
+// Aliases of the supported events, as known by the perf CLI.
+var eventAliases = map[string]string{
+	"cycles":     "cpu-cycles",
+	"branches":   "branch-instructions",
+	"faults":     "page-faults",
+	"cs":         "context-switches",
+	"migrations": "cpu-migrations",
+}
+
+// canonicalEventName resolves the aliases of the supported events.
+func canonicalEventName(name string) string {
+	if canonical, ok := eventAliases[name]; ok {
+		return canonical
+	}
+	return name
+}
+
+// NewEventConfigType creates the configuration for an event of type
+// "typeHw" (PERF_TYPE_*) and config value "config".
+func NewEventConfigType(typeHw uint32, config uint64) EventConfigType {
+	return EventConfigType{typeHw, config}
+}
+
+// Type returns the type (PERF_TYPE_*) of the event configuration.
+func (cfg EventConfigType) Type() uint32 {
+	return cfg.typeHw
+}
+
+// Config returns the config value of the event configuration.
+func (cfg EventConfigType) Config() uint64 {
+	return cfg.config
+}
+
+// EventNameToConfig returns the configuration of the supported event
+// "name", and whether it is supported.
+func EventNameToConfig(name string) (EventConfigType, bool) {
+	name = canonicalEventName(name)
+	if cfg, ok := initEventList()[name]; ok {
+		return cfg, true
+	}
+	if config, ok := parseRawEvent(name); ok {
+		return EventConfigType{PERF_TYPE_RAW, config}, true
+	}
+	return EventConfigType{}, false
+}
+
+// parseRawEvent parses the raw event "name", i.e., the config value of a
+// PMU specific event, in hex, after an "r", e.g. "r003c", as perf does.
+func parseRawEvent(name string) (uint64, bool) {
+	if len(name) < 2 || name[0] != 'r' {
+		return 0, false
+	}
+	config, err := strconv.ParseUint(name[1:], 16, 64)
+	return config, err == nil
+}
+
+// ConfigToEventName returns the name of the supported event having the
+// configuration "cfg", and whether there is one.
+func ConfigToEventName(cfg EventConfigType) (string, bool) {
+	for name, c := range initEventList() {
+		if c == cfg {
+			return name, true
+		}
+	}
+	if cfg.typeHw == PERF_TYPE_RAW {
+		return "r" + strconv.FormatUint(cfg.config, 16), true
+	}
+	return "", false
 }
 
 // Sets up the perf event attributes for a particular eventConfig having
 // the type of the event and the config value.
 func setupPerfEventAttr(eventConfig EventConfigType) PerfEventAttr {
 	var eventAttr PerfEventAttr
-	eventAttr.type_hw = eventConfig.typeHw
-	eventAttr.config = eventConfig.config
-	eventAttr.size_s = uint32(unsafe.Sizeof(eventAttr))
-	eventAttr.properties = setBit(eventAttr.properties, DISABLED)
-	eventAttr.properties = setBit(eventAttr.properties, EXCLUDE_KERNEL)
-	eventAttr.properties = setBit(eventAttr.properties, EXCLUDE_HV)
+	eventAttr.Type = eventConfig.typeHw
+	eventAttr.Config = eventConfig.config
+	eventAttr.Size = uint32(unsafe.Sizeof(eventAttr))
+	eventAttr.Bits = setBit(eventAttr.Bits, DISABLED)
+	eventAttr.Bits = setBit(eventAttr.Bits, EXCLUDE_KERNEL)
+	eventAttr.Bits = setBit(eventAttr.Bits, EXCLUDE_HV)
+	// The times tell whether the PMU multiplexed the event, and scale
+	// its count if it did, see Scaled.
+	eventAttr.Read_format = PERF_FORMAT_TOTAL_TIME_ENABLED | PERF_FORMAT_TOTAL_TIME_RUNNING
 
 	return eventAttr
 }
 
 // Fetches the event attributes for a specified event string.
 func fetchPerfEventAttr(event string) (PerfEventAttr, error) {
-	var eventAttr PerfEventAttr
-	evList := initEventList()
-	evConf, ok := evList[event]
-	if ok == false {
-		return eventAttr, PerfUnsupportedEvent
-	}
-	return setupPerfEventAttr(evConf), nil
+	parsed := parseEvent(event)
+	return parsed.attr, parsed.Err
 }
 
 // Perf IOCTL operations for x86
+//
+// Deprecated: InitIOCOps takes the operations of the architecture it
+// runs on from golang.org/x/sys/unix, use unix.PERF_EVENT_IOC_* too.
 const (
 	PERF_IOC_RESET_X86   = 0x2403
 	PERF_IOC_ENABLE_X86  = 0x2400
 	PERF_IOC_DISABLE_X86 = 0x2401
 )
 
+// Perf IOCTL operations for arm64, laid out as the x86 ones (the
+// generic ioctl encoding)
+//
+// Deprecated: InitIOCOps takes the operations of the architecture it
+// runs on from golang.org/x/sys/unix, use unix.PERF_EVENT_IOC_* too.
+const (
+	PERF_IOC_RESET_ARM64   = 0x2403
+	PERF_IOC_ENABLE_ARM64  = 0x2400
+	PERF_IOC_DISABLE_ARM64 = 0x2401
+)
+
+// Perf IOCTL operations for riscv64, laid out as the x86 ones too
+//
+// Deprecated: InitIOCOps takes the operations of the architecture it
+// runs on from golang.org/x/sys/unix, use unix.PERF_EVENT_IOC_* too.
+const (
+	PERF_IOC_RESET_RISCV64   = 0x2403
+	PERF_IOC_ENABLE_RISCV64  = 0x2400
+	PERF_IOC_DISABLE_RISCV64 = 0x2401
+)
+
 // Perf IOCTL operations for powerpc
+//
+// Deprecated: InitIOCOps takes the operations of the architecture it
+// runs on from golang.org/x/sys/unix, use unix.PERF_EVENT_IOC_* too.
 const (
 	PERF_IOC_RESET_PPC   = 0x20002403
 	PERF_IOC_ENABLE_PPC  = 0x20002400
 	PERF_IOC_DISABLE_PPC = 0x20002401
 )
 
+// Flag for the IOCTL operations to apply them to the whole group of
+// an event leader (from linux/perf_event.h)
+const (
+	PERF_IOC_FLAG_GROUP = 1
+)
+
 // PerfIOCOps stores the correct IOC operations respective
 // to the underlying architecture.
 type PerfIOCOps struct {
@@ -191,46 +311,76 @@ type PerfIOCOps struct {
 // EventName : name of the perf event
 // Fd : File descriptor opened by the perf_event_open syscall.
 // Data : Contains the event data after performing a read on Fd.
+// Pid : Process or thread the event counts, 0 for the calling thread and
+// -1 for any process.
+// Cpu : CPU the event counts on, -1 for any CPU.
+// GroupFd : File descriptor of the group leader, -1 if the event
+// was opened as its own leader.
+// TimeEnabled, TimeRunning : Time (in ns) the event was enabled and
+// actually counting for. They differ when the PMU was multiplexed
+// between events, see Scaled. The events are opened with the
+// PERF_FORMAT_TOTAL_TIME_ENABLED and PERF_FORMAT_TOTAL_TIME_RUNNING read
+// format for the kernel to report them, both being 0 otherwise.
+// Overflowed : Set when a read returned less than the previous one
+// without a reset in between, i.e., the counter wrapped and the
+// measurement can't be relied upon.
+// LastRead : Wall clock time of the last successful read of Data.
+// Epoch : Number of times the event has been reset with ResetEvent.
+// NonBlock : Whether Fd is in non-blocking mode.
+// Enabled : Whether the event is enabled, or is to be enabled by the
+// kernel on exec. Use IsEnabled to query it.
+// ReadFormat : PERF_FORMAT_* bits the event was opened with. The leaders
+// of the groups have PERF_FORMAT_GROUP set, see ReadGroup.
+// Lost : Number of samples of the event lost, when ReadFormat has
+// PERF_FORMAT_LOST.
+// Baseline : Count the next ReadDelta is computed from.
+// RebaselineOnEnable : Whether enabling a disabled event moves Baseline
+// to its current count, so that the next ReadDelta only counts from
+// there.
+// ReopenOnBadFd : Whether ReadEvent reopens the event, once, when Fd has
+// been closed behind its back, e.g. by another part of the program,
+// rather than failing for good with PerfFdError.
 type PerfEventInfo struct {
-	EventName string
-	Fd        int
-	Data      uint64
-	IOCOps    PerfIOCOps
-}
-
-func findMachineInfo() (string, error) {
-	var buf syscall.Utsname
-	err := syscall.Uname(&buf)
-	if err != nil {
-		return "", err
-	}
-	machineName := make([]byte, len(buf.Machine))
-
-	i := 0
-	for ; i < len(buf.Machine); i++ {
-		if buf.Machine[i] == 0 {
-			break
-		}
-		machineName[i] = uint8(buf.Machine[i])
-	}
+	EventName          string
+	Fd                 int
+	Data               uint64
+	IOCOps             PerfIOCOps
+	GroupFd            int
+	Pid                int
+	Cpu                int
+	TimeEnabled        uint64
+	TimeRunning        uint64
+	Overflowed         bool
+	LastRead           time.Time
+	Epoch              uint64
+	NonBlock           bool
+	Enabled            bool
+	ReadFormat         uint64
+	Lost               uint64
+	Baseline           uint64
+	RebaselineOnEnable bool
+	ReopenOnBadFd      bool
 
-	str := string(machineName[0:i])
-	return str, nil
+	// What the event was opened with, see Reopen.
+	attr  PerfEventAttr
+	flags uint64
+	// Times of the event at Baseline, see ReadScaledDelta.
+	baselineEnabled uint64
+	baselineRunning uint64
+	// The page mapped by MapUserPage, see ReadUserScaled.
+	userPage []byte
+	// Number of events of the group of a leader, see PeekGroup.
+	groupSize int
 }
 
 // InitIOCOps initializes the Perf IOCTL functions respective to
-// the underlying architecture
+// the underlying architecture, as golang.org/x/sys/unix defines them for
+// every architecture Go runs Linux on.
 func (event *PerfEventInfo) InitIOCOps() error {
-	machine, err := findMachineInfo()
-	if err != nil {
-		return err
-	}
-	if machine == "x86_64" {
-		event.IOCOps = PerfIOCOps{reset: PERF_IOC_RESET_X86, enable: PERF_IOC_ENABLE_X86, disable: PERF_IOC_DISABLE_X86}
-	} else if machine == "ppc64le" {
-		event.IOCOps = PerfIOCOps{reset: PERF_IOC_RESET_PPC, enable: PERF_IOC_ENABLE_PPC, disable: PERF_IOC_DISABLE_PPC}
-	} else {
-		return errors.New("InitIOCOps: machine not supported")
+	event.IOCOps = PerfIOCOps{
+		reset:   unix.PERF_EVENT_IOC_RESET,
+		enable:  unix.PERF_EVENT_IOC_ENABLE,
+		disable: unix.PERF_EVENT_IOC_DISABLE,
 	}
 	return nil
 }
@@ -250,91 +400,210 @@ func (event *PerfEventInfo) FetchPerfEventAttr(eventName string) (error, PerfEve
 // InitOpenEventEnable fetches the perf event attributes for event
 // "string", opens the event, resets and then enables the event.
 func (event *PerfEventInfo) InitOpenEventEnable(eventName string, pid int, cpu int, group_fd int, flags uint64) error {
-	err, eventAttr := event.FetchPerfEventAttr(eventName)
+	return event.initOpenEventEnable(eventName, pid, cpu, group_fd, EventOptions{Flags: flags})
+}
+
+// initOpenEventEnable is InitOpenEventEnable with the event attributes
+// and flags set up as per "opts".
+func (event *PerfEventInfo) initOpenEventEnable(eventName string, pid int, cpu int, group_fd int, opts EventOptions) error {
+	err := event.initOpenEvent(eventName, pid, cpu, group_fd, opts)
 	if err != nil {
 		return err
 	}
-	err = event.InitIOCOps()
-	if (err != nil) {
+
+	err = event.ResetEvent()
+	if err == nil && !opts.EnableOnExec && !opts.Disabled {
+		// With EnableOnExec, the kernel enables the event by itself
+		// on exec.
+		err = event.EnableEvent()
+	}
+	if err == nil && opts.EnableOnExec {
+		event.Enabled = true
+	}
+	if err != nil {
+		// Don't leak the opened event.
+		syscall.Close(event.Fd)
+		event.Fd = -1
 		return err
 	}
 
-	err = event.OpenEvent(eventAttr, pid, cpu, group_fd, flags)
+	return nil
+}
+
+// initOpenEvent fetches the perf event attributes for event "eventName",
+// sets them up as per "opts" and opens the event, disabled.
+func (event *PerfEventInfo) initOpenEvent(eventName string, pid int, cpu int, group_fd int, opts EventOptions) error {
+	err, eventAttr := event.FetchPerfEventAttr(eventName)
 	if err != nil {
 		return err
 	}
-	event.EventName = eventName
-	err = event.ResetEvent()
+	err = opts.apply(&eventAttr)
 	if err != nil {
 		return err
 	}
+	if group_fd != -1 {
+		// A member only counts along with its leader. Opened enabled,
+		// it is scheduled on the PMU together with the leader, while a
+		// disabled member enabled after the leader only starts counting
+		// at the next reschedule.
+		eventAttr.Bits &^= 1 << DISABLED
+	}
+	err = event.InitIOCOps()
+	if (err != nil) {
+		return err
+	}
 
-	err = event.EnableEvent()
+	err = event.OpenEvent(eventAttr, pid, cpu, group_fd, opts.Flags)
 	if err != nil {
 		return err
 	}
-
+	if opts.NonBlock {
+		err = syscall.SetNonblock(event.Fd, true)
+		if err != nil {
+			syscall.Close(event.Fd)
+			event.Fd = -1
+			return PerfOpenError
+		}
+		event.NonBlock = true
+	}
+	event.ReopenOnBadFd = opts.ReopenOnBadFd
+	event.EventName = eventName
 	return nil
 }
 
 // InitOpenEventEnableSelf opens, enables an event for self process
 func (event *PerfEventInfo) InitOpenEventEnableSelf(eventName string) error {
-	return event.InitOpenEventEnable(eventName, 0, -1, -1, 0)
+	return event.InitOpenEventEnableSelfWithOptions(eventName, EventOptions{})
 }
 
-func filterOutDuplicates(events string) map[string]int {
-	names := strings.Split((events), ",")
-	count := 0
-	eventList := make(map[string]int)
-	for i := 0; i < len(names); i++ {
-		eventList[names[i]] = count
-		count++
-	}
-	return eventList
+// InitOpenEventEnableSelfWithOptions opens, enables an event for self
+// process as per "opts".
+func (event *PerfEventInfo) InitOpenEventEnableSelfWithOptions(eventName string, opts EventOptions) error {
+	return event.initOpenEventEnable(eventName, 0, -1, -1, opts)
 }
 
 // InitOpenEventsEnableSelf opens, enables an event list provided in
 // "events" string.
-// "events" is a comma separated list of supported events.
+// "events" is a comma separated list of supported events. The events
+// between braces, e.g. "{instructions,cpu-cycles},cache-misses", are
+// opened as a group.
 // In case of an error, where it couldn't create some or all of the required
 // events in "events", it sends the error and the error'ed events along
 // with the events which it managed to create.
 func InitOpenEventsEnableSelf(events string) (error, []string, []PerfEventInfo) {
-	eventList := filterOutDuplicates(events)
-	tmp := make([]PerfEventInfo, len(eventList))
-	eventListNA := make([]string, 0, len(eventList))
+	return InitOpenEventsEnableSelfWithOptions(events, EventOptions{})
+}
 
-	i := 0
+// InitOpenEventsEnableSelfWithOptions is the same as
+// InitOpenEventsEnableSelf, with the events opened as per "opts".
+func InitOpenEventsEnableSelfWithOptions(events string, opts EventOptions) (error, []string, []PerfEventInfo) {
+	return initOpenEventsEnable(events, 0, -1, opts)
+}
 
-	for key, _ := range eventList {
-		err := (&tmp[i]).InitOpenEventEnableSelf(key)
-		if err != nil {
-			eventListNA = append(eventListNA, key)
-		}
-		i++
+// InitOpenEventsEnable opens, enables the event list "events" as
+// InitOpenEventsEnableSelf does, for the process or thread "pid" on the
+// cpu "cpu". "pid" is 0 for the calling thread, or -1 for all the
+// processes running on "cpu", and "cpu" -1 for any CPU, but not along
+// with a "pid" of -1. Measuring the processes of another user, or a
+// CPU, requires privileges, the events failing with PerfPermissionError
+// otherwise, see PermissionSummary.
+func InitOpenEventsEnable(events string, pid int, cpu int) (error, []string, []PerfEventInfo) {
+	return InitOpenEventsEnableWithOptions(events, pid, cpu, EventOptions{})
+}
+
+// InitOpenEventsEnableWithOptions is InitOpenEventsEnable with the events
+// set up as per "opts".
+func InitOpenEventsEnableWithOptions(events string, pid int, cpu int, opts EventOptions) (error, []string, []PerfEventInfo) {
+	return initOpenEventsEnable(events, pid, cpu, opts)
+}
+
+// initOpenEventsEnable opens, enables the event list "events" for the
+// process "pid" on the cpu "cpu", as per "opts".
+func initOpenEventsEnable(events string, pid int, cpu int, opts EventOptions) (error, []string, []PerfEventInfo) {
+	list, err := ParseEventList(events)
+	if err != nil {
+		return err, []string{events}, nil
 	}
 
-	var eventDescs = make([]PerfEventInfo, len(eventList)-len(eventListNA))
-	j := 0
-	for i := 0; i < len(eventList); i++ {
-		if tmp[i].Fd != -1 {
-			eventDescs[j] = tmp[i]
-			j++
+	eventListNA := make([]string, 0)
+	eventDescs := make([]PerfEventInfo, 0, len(list.Events))
+	// Events resolving to the same attributes, e.g. "cycles" and
+	// "cpu-cycles", are opened only once.
+	opened := make(map[PerfEventAttr]bool)
+	// Not being permitted to measure is told apart, as it fails all
+	// the events alike.
+	failErr := PerfUnsupportedEvent
+
+	for _, group := range list.groups() {
+		if len(group) > 1 {
+			// A group is created either as a whole or not at all.
+			names := make([]string, len(group))
+			for i, event := range group {
+				names[i] = event.Name
+			}
+			err, _, groupDescs := initOpenEventGroupEnable(strings.Join(names, ","), pid, cpu, opts)
+			if err != nil {
+				if err == PerfPermissionError {
+					failErr = err
+				}
+				eventListNA = append(eventListNA, names...)
+				continue
+			}
+			eventDescs = append(eventDescs, groupDescs...)
+			continue
 		}
+
+		parsed := group[0]
+		if parsed.Err == nil && opened[parsed.attr] {
+			continue
+		}
+		var event PerfEventInfo
+		err := event.initOpenEventEnable(parsed.Name, pid, cpu, -1, opts)
+		if err != nil {
+			if err == PerfPermissionError {
+				failErr = err
+			}
+			eventListNA = append(eventListNA, parsed.Name)
+			continue
+		}
+		opened[parsed.attr] = true
+		eventDescs = append(eventDescs, event)
 	}
 
 	if len(eventListNA) != 0 {
-		return PerfUnsupportedEvent, eventListNA, eventDescs
+		return failErr, eventListNA, eventDescs
 	}
 	return nil, eventListNA, eventDescs
 }
 
+// MustOpenEvents is like InitOpenEventsEnableSelf but panics if any of
+// the events in "events" couldn't be opened. The events which did open
+// are closed before panicking.
+// It is meant for test setup and small tools, not for production code.
+func MustOpenEvents(events string) []PerfEventInfo {
+	err, eventListNA, eventDescs := InitOpenEventsEnableSelf(events)
+	if err != nil {
+		EventsDisableClose(eventDescs)
+		panic("perfevents: MustOpenEvents(" + strconv.Quote(events) +
+			"): " + err.Error() + ": " + strings.Join(eventListNA, ","))
+	}
+	return eventDescs
+}
+
 // EventsRead : Read the event count for a slice of event descriptors in
 // "eventsInfo'
 func EventsRead(eventsInfo []PerfEventInfo) error {
 	eventListNA := make([]string, 0, len(eventsInfo))
 
 	for i := 0; i < len(eventsInfo); i++ {
+		// The events of a group are read all at once, in one read
+		// on the leader.
+		if n := groupLen(eventsInfo[i:]); n > 1 {
+			if ReadGroup(eventsInfo[i:i+n]) == nil {
+				i += n - 1
+				continue
+			}
+		}
 		err := (&eventsInfo[i]).ReadEvent()
 		if err != nil {
 			// Error in reading this event
@@ -348,10 +617,83 @@ func EventsRead(eventsInfo []PerfEventInfo) error {
 	return nil
 }
 
+// EventsEnableSync : Enable all the events in "eventsInfo" as close to
+// simultaneously as possible. The events are expected to be opened
+// disabled, see EventOptions.Disabled.
+// The groups in "eventsInfo", i.e., a leader followed by its members,
+// are enabled in one IOCTL call each, and the events of a group start
+// counting at exactly the same time.
+// The other events are enabled back to back, which leaves a small window
+// between the first and the last event starting to count. True
+// simultaneity requires grouping the events.
+func EventsEnableSync(eventsInfo []PerfEventInfo) error {
+	for i := 0; i < len(eventsInfo); i++ {
+		if n := groupMembers(eventsInfo[i:]); n > 0 {
+			err := (&eventsInfo[i]).EnableGroup()
+			if err != nil {
+				return err
+			}
+			// The members are enabled along with the leader.
+			for j := i + 1; j <= i+n; j++ {
+				eventsInfo[j].Enabled = true
+			}
+			i += n
+			continue
+		}
+		err := (&eventsInfo[i]).EnableEvent()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EventsDisableSync : Disable all the events in "eventsInfo" as close to
+// simultaneously as possible, as EventsEnableSync enables them. Disabling
+// the leader of a group in "eventsInfo" stops the whole group from
+// counting, in one IOCTL call, the members being marked disabled too.
+// The members are left enabled in the kernel though, since a member
+// enabled after its leader only counts again once the group is next
+// scheduled.
+func EventsDisableSync(eventsInfo []PerfEventInfo) error {
+	for i := 0; i < len(eventsInfo); i++ {
+		if n := groupMembers(eventsInfo[i:]); n > 0 {
+			err := (&eventsInfo[i]).DisableEvent()
+			if err != nil {
+				return err
+			}
+			for j := i + 1; j <= i+n; j++ {
+				eventsInfo[j].Enabled = false
+			}
+			i += n
+			continue
+		}
+		err := (&eventsInfo[i]).DisableEvent()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// groupMembers returns the number of members of the group led by the
+// first event of "eventsInfo" which follow it, 0 if it isn't a leader.
+func groupMembers(eventsInfo []PerfEventInfo) int {
+	leader := eventsInfo[0]
+	if leader.Fd < 0 || leader.GroupFd != -1 {
+		return 0
+	}
+	n := 0
+	for n+1 < len(eventsInfo) && eventsInfo[n+1].GroupFd == leader.Fd {
+		n++
+	}
+	return n
+}
+
 // EventsDisableClose : Disable and close all the events in the slice
 // "eventsInfo'
 func EventsDisableClose(eventsInfo []PerfEventInfo) error {
-	eventListNA := make([]string, len(eventsInfo))
+	eventListNA := make([]string, 0)
 	for _, eventInfo := range eventsInfo {
 		err := (&eventInfo).DisableClose()
 		if err != nil {
@@ -366,6 +708,32 @@ func EventsDisableClose(eventsInfo []PerfEventInfo) error {
 	return nil
 }
 
+// CloseWhere disables and closes the events in the slice "eventsInfo"
+// for which "pred" returns true, e.g. the events of a CPU, and returns the
+// other events. Closing the leader of a group stops its members from
+// counting though. The events which couldn't be closed are kept, with an
+// error telling which.
+func CloseWhere(eventsInfo []PerfEventInfo, pred func(PerfEventInfo) bool) ([]PerfEventInfo, error) {
+	survivors := make([]PerfEventInfo, 0, len(eventsInfo))
+	eventListNA := make([]string, 0)
+	for _, eventInfo := range eventsInfo {
+		if !pred(eventInfo) {
+			survivors = append(survivors, eventInfo)
+			continue
+		}
+		err := (&eventInfo).DisableClose()
+		if err != nil {
+			eventListNA = append(eventListNA, eventInfo.EventName)
+			survivors = append(survivors, eventInfo)
+		}
+	}
+	if len(eventListNA) != 0 {
+		errEvents := strings.Join(eventListNA, ",")
+		return survivors, errors.New("couldn't close events: " + errEvents)
+	}
+	return survivors, nil
+}
+
 // DisableClose disables the event and then closes it.
 func (event *PerfEventInfo) DisableClose() error {
 	// File descriptor not set?
@@ -378,6 +746,7 @@ func (event *PerfEventInfo) DisableClose() error {
 		return err
 	}
 
+	event.unmapUserPage()
 	errClose := syscall.Close(int(event.Fd))
 	if errClose != nil {
 		return PerfCloseError
@@ -386,20 +755,112 @@ func (event *PerfEventInfo) DisableClose() error {
 	return nil
 }
 
+// perfEventOpen is the perf_event_open syscall.
+var perfEventOpen = unix.PerfEventOpen
+
 // OpenEvent opens an event
 func (event *PerfEventInfo) OpenEvent(eventAttr PerfEventAttr, pid int, cpu int, group_fd int, flags uint64) error {
 	// File descriptor already set?
 	if event.Fd > 0 {
 		return PerfFdError
 	}
-	fd, _, err := syscall.Syscall6(syscall.SYS_PERF_EVENT_OPEN, uintptr(unsafe.Pointer(&eventAttr)), uintptr(pid), uintptr(cpu), uintptr(group_fd), uintptr(flags), uintptr(0))
-	if err > 0 {
-		return PerfOpenError
+	if err := eventAttr.Validate(); err != nil {
+		return err
+	}
+	fd, err := perfEventOpen((*unix.PerfEventAttr)(&eventAttr), pid, cpu, group_fd, int(flags))
+	if err == syscall.EINVAL && eventAttr.Read_format&PERF_FORMAT_LOST != 0 && !formatLostSupported() {
+		// Kernels before 6.0 don't know of PERF_FORMAT_LOST, do
+		// without it, ReadFormat telling so. Otherwise, the EINVAL is
+		// about another attribute.
+		eventAttr.Read_format &^= PERF_FORMAT_LOST
+		fd, err = perfEventOpen((*unix.PerfEventAttr)(&eventAttr), pid, cpu, group_fd, int(flags))
+	}
+	if err == syscall.E2BIG {
+		// The kernel doesn't know of the ABI version of the attributes.
+		return PerfAttrSizeError
+	}
+	if err == syscall.EACCES || err == syscall.EPERM {
+		// See PermissionSummary.
+		return PerfPermissionError
 	}
-	if int(fd) == -1 {
+	if err == syscall.EBUSY {
+		// An exclusive event can't be scheduled while the PMU is in
+		// use, the caller may retry later.
+		return PerfBusyError
+	}
+	if err != nil {
 		return PerfOpenError
 	}
-	event.Fd = int(fd)
+	event.Fd = fd
+	event.GroupFd = group_fd
+	event.Pid = pid
+	event.Cpu = cpu
+	event.ReadFormat = eventAttr.Read_format
+	event.attr = eventAttr
+	event.flags = flags
+	return nil
+}
+
+// IsStale tells whether Fd isn't the event anymore, e.g. when the
+// process has been checkpointed and restored (CRIU), which doesn't
+// restore the perf events.
+func (event *PerfEventInfo) IsStale() bool {
+	if event.Fd < 0 {
+		return false
+	}
+	target, err := os.Readlink("/proc/self/fd/" + strconv.Itoa(event.Fd))
+	return err != nil || target != "anon_inode:[perf_event]"
+}
+
+// Reopen closes the event and opens it again as it was opened, enabled
+// if it was, to recover from a counter in a bad state, e.g. failing to
+// read. The count starts again from 0.
+// A group member is opened again in the group of GroupFd, so the leader
+// of a group must be reopened first, and the GroupFd of the members set
+// to its new Fd.
+// The events of a cgroup can't be reopened, the descriptor of the cgroup
+// they were opened with being closed, PerfCgroupError is returned.
+// The user page of the event is mapped again if it was, see MapUserPage.
+func (event *PerfEventInfo) Reopen() error {
+	if event.attr.Size == 0 {
+		// Never opened.
+		return PerfFdError
+	}
+	if event.flags&PERF_FLAG_PID_CGROUP != 0 {
+		return PerfCgroupError
+	}
+	// The user page holds on to the event it was mapped from.
+	mapped := event.userPage != nil
+	event.unmapUserPage()
+	// After a restore, the descriptor may be used by another file.
+	if event.Fd > 0 && !event.IsStale() {
+		syscall.Close(event.Fd)
+	}
+	enabled := event.Enabled
+	event.Fd = -1
+	event.Enabled = false
+
+	err := event.OpenEvent(event.attr, event.Pid, event.Cpu, event.GroupFd, event.flags)
+	if err != nil {
+		return err
+	}
+	if event.NonBlock {
+		err = syscall.SetNonblock(event.Fd, true)
+	}
+	if err == nil {
+		err = event.ResetEvent()
+	}
+	if err == nil && enabled {
+		err = event.EnableEvent()
+	}
+	if err == nil && mapped {
+		err = event.MapUserPage()
+	}
+	if err != nil {
+		syscall.Close(event.Fd)
+		event.Fd = -1
+		return err
+	}
 	return nil
 }
 
@@ -408,49 +869,341 @@ func (event *PerfEventInfo) ResetEvent() error {
 	if event.Fd < 0 {
 		return PerfFdError
 	}
-	_, _, err := syscall.Syscall6(syscall.SYS_IOCTL, uintptr(event.Fd), uintptr(event.IOCOps.reset), uintptr(0), uintptr(0), uintptr(0), uintptr(0))
-	if err != 0 {
-		return PerfIOCError
+	err := event.ioctl(event.IOCOps.reset, 0)
+	if err != nil {
+		return err
 	}
+	event.resetValues()
 	return nil
 }
 
-// EnableEvent enables an event
+// resetValues records that the counter of the event has been reset.
+func (event *PerfEventInfo) resetValues() {
+	// The counter starts again from 0, which mustn't be taken for
+	// a wrap by the next read.
+	event.Data = 0
+	event.Baseline = 0
+	event.Overflowed = false
+	event.Epoch++
+}
+
+// EnableEvent enables an event, if it isn't already.
 func (event *PerfEventInfo) EnableEvent() error {
 	if event.Fd < 2 {
 		return PerfFdError
 	}
-	_, _, err := syscall.Syscall6(syscall.SYS_IOCTL, uintptr(event.Fd), uintptr(event.IOCOps.enable), uintptr(0), uintptr(0), uintptr(0), uintptr(0))
-	if err != 0 {
-		return PerfIOCError
+	if event.Enabled {
+		return nil
+	}
+	if event.RebaselineOnEnable {
+		// The count doesn't change while the event is disabled.
+		baseline, err := event.Peek()
+		if err != nil {
+			return err
+		}
+		event.Baseline = baseline
 	}
+	err := event.ioctl(event.IOCOps.enable, 0)
+	if err != nil {
+		return err
+	}
+	event.Enabled = true
 	return nil
 }
 
-// DisableEvent disables an event
+// IsEnabled tells whether the event is enabled, i.e., counting for a
+// group member along with its leader. The members of a group are marked
+// along with their leader by EventsEnableSync, EventsDisableSync and the
+// methods of EventGroup, not by EnableGroup.
+func (event *PerfEventInfo) IsEnabled() bool {
+	return event.Enabled
+}
+
+// EnableGroup enables an event group leader along with all the
+// members of its group, in one IOCTL call. Only the leader is marked
+// enabled, not knowing of its members: EventsEnableSync and
+// EventGroup.Enable mark the members too.
+func (event *PerfEventInfo) EnableGroup() error {
+	if event.Fd < 2 {
+		return PerfFdError
+	}
+	err := event.ioctl(event.IOCOps.enable, PERF_IOC_FLAG_GROUP)
+	if err != nil {
+		return err
+	}
+	event.Enabled = true
+	return nil
+}
+
+// DisableEvent disables an event, if it isn't already.
 func (event *PerfEventInfo) DisableEvent() error {
 	if event.Fd < 2 {
 		return PerfFdError
 	}
-	_, _, err := syscall.Syscall6(syscall.SYS_IOCTL, uintptr(event.Fd), uintptr(event.IOCOps.disable), uintptr(0), uintptr(0), uintptr(0), uintptr(0))
-	if err != 0 {
-		return PerfIOCError
+	if !event.Enabled {
+		return nil
+	}
+	err := event.ioctl(event.IOCOps.disable, 0)
+	if err != nil {
+		return err
 	}
+	event.Enabled = false
 	return nil
 }
 
+// The syscalls on the events are retried when interrupted by a signal,
+// e.g. the SIGPROF of the Go CPU profiler, so that profiling doesn't turn
+// into spurious errors. Go never runs user code from a signal handler,
+// so all the functions of this package are safe to use along with
+// frequent signals.
+
+// ioctl performs the IOCTL operation "op" on the event.
+func (event *PerfEventInfo) ioctl(op uint64, arg uintptr) error {
+	for {
+		_, _, err := syscall.Syscall6(syscall.SYS_IOCTL, uintptr(event.Fd), uintptr(op), arg, uintptr(0), uintptr(0), uintptr(0))
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != 0 {
+			return PerfIOCError
+		}
+		return nil
+	}
+}
+
+// read reads from the event file descriptor.
+func (event *PerfEventInfo) read(buf []byte) (int, error) {
+	for {
+		n, err := syscall.Read(event.Fd, buf)
+		if err == syscall.EINTR {
+			continue
+		}
+		return n, err
+	}
+}
+
 // ReadEvent reads the event count
+// For an event in non-blocking mode, a read with no data yet isn't an
+// error, Data is just left as is.
+// With ReopenOnBadFd, an event the descriptor of which has been closed
+// is reopened, and counts from 0 again, Epoch telling that it was reset.
 func (event *PerfEventInfo) ReadEvent() error {
-	readBuf := make([]byte, 8, 10)
-	_, err := syscall.Read(event.Fd, readBuf)
+	values, err := event.PeekValues()
+	if err == syscall.EAGAIN && event.NonBlock {
+		return nil
+	}
+	if err == syscall.EBADF && event.ReopenOnBadFd && event.Reopen() == nil {
+		values, err = event.PeekValues()
+	}
+	if err == syscall.EBADF {
+		// See IsStale.
+		return PerfFdError
+	}
 	if err != nil {
 		return PerfReadError
 	}
-	data := binary.LittleEndian.Uint64(readBuf)
-	event.Data = data
+	event.setValues(values)
 	return nil
 }
 
+// setValues sets the values read from the event.
+func (event *PerfEventInfo) setValues(values ReadFormat) {
+	if values.Value < event.Data {
+		event.Overflowed = true
+	}
+	event.Data = values.Value
+	if event.ReadFormat&PERF_FORMAT_TOTAL_TIME_ENABLED != 0 {
+		event.TimeEnabled = values.TimeEnabled
+	}
+	if event.ReadFormat&PERF_FORMAT_TOTAL_TIME_RUNNING != 0 {
+		event.TimeRunning = values.TimeRunning
+	}
+	event.Lost = values.Lost
+	event.LastRead = clockNow()
+}
+
+// Read32 reads the event count as ReadEvent does, only keeping its low
+// 32 bits. Mainline kernels always return a 64-bit count, extending the
+// narrower hardware counters themselves. Some vendor kernels and emulated
+// PMUs return a 32-bit count though, with flags in the high bits, which
+// must then be left out.
+func (event *PerfEventInfo) Read32() error {
+	err := event.ReadEvent()
+	if err != nil {
+		return err
+	}
+	event.Data &= 0xffffffff
+	return nil
+}
+
+// ReadDelta reads the event count and returns how much it grew since
+// Baseline, i.e., since the previous ReadDelta, the event being reset,
+// or it being enabled again with RebaselineOnEnable set.
+func (event *PerfEventInfo) ReadDelta() (uint64, error) {
+	err := event.ReadEvent()
+	if err != nil {
+		return 0, err
+	}
+	delta := event.Data - event.Baseline
+	event.Baseline = event.Data
+	event.baselineEnabled = event.TimeEnabled
+	event.baselineRunning = event.TimeRunning
+	return delta, nil
+}
+
+// ReadScaledDelta is ReadDelta, with the delta scaled by the time the
+// event was enabled over the time it actually counted since Baseline,
+// i.e., an estimate of what it would have counted without multiplexing.
+// The delta is scaled if the kernel reports the times of the event, see
+// TimeEnabled, only.
+func (event *PerfEventInfo) ReadScaledDelta() (float64, error) {
+	enabled, running := event.baselineEnabled, event.baselineRunning
+	delta, err := event.ReadDelta()
+	if err != nil {
+		return 0, err
+	}
+	// Both times only ever grow, the event being reset or not.
+	enabled = event.TimeEnabled - enabled
+	running = event.TimeRunning - running
+	if running == 0 || running >= enabled {
+		return float64(delta), nil
+	}
+	return float64(delta) * float64(enabled) / float64(running), nil
+}
+
+// Multiplexed tells whether the event didn't count for all the time it
+// was enabled, as of the last read, the PMU having had more events to
+// count than counters.
+func (event *PerfEventInfo) Multiplexed() bool {
+	return event.TimeRunning < event.TimeEnabled
+}
+
+// Scaled returns the count of the event as of the last read, Data, scaled
+// by the time the event was enabled over the time it actually counted,
+// i.e., an estimate of what it would have counted without multiplexing.
+// The estimate assumes the event occurred at the same rate while it
+// wasn't counting. An event which never counted is estimated at 0.
+func (event *PerfEventInfo) Scaled() float64 {
+	if !event.Multiplexed() || event.TimeRunning == 0 {
+		return float64(event.Data)
+	}
+	return float64(event.Data) * float64(event.TimeEnabled) / float64(event.TimeRunning)
+}
+
+// Peek reads the event count without storing it in Data, so that the
+// event can be read from several goroutines, e.g. when it is shared.
+// For an event in non-blocking mode with no data yet, Data is returned.
+func (event *PerfEventInfo) Peek() (uint64, error) {
+	values, err := event.PeekValues()
+	if err == syscall.EAGAIN && event.NonBlock {
+		return event.Data, nil
+	}
+	if err != nil {
+		return 0, PerfReadError
+	}
+	return values.Value, nil
+}
+
+// PeekValues is Peek, returning all the values of the read format of the
+// event.
+func (event *PerfEventInfo) PeekValues() (ReadFormat, error) {
+	if event.ReadFormat&PERF_FORMAT_GROUP != 0 {
+		// The leader of a group reads the values of the whole
+		// group, its own first.
+		group, err := event.PeekGroup()
+		if err != nil {
+			return ReadFormat{}, err
+		}
+		if len(group.Values) == 0 {
+			return ReadFormat{}, PerfShortRead
+		}
+		return group.values(0), nil
+	}
+	readBuf := make([]byte, readSize(event.ReadFormat))
+	n, err := event.read(readBuf)
+	if err != nil {
+		return ReadFormat{}, err
+	}
+	return ParseRead(readBuf[:n], event.ReadFormat)
+}
+
+// ReadAndReset reads the event count and then resets the event, returning
+// the count it had before the reset. The events counted between the read
+// and the reset, if any, are lost.
+func (event *PerfEventInfo) ReadAndReset() (uint64, error) {
+	err := event.ReadEvent()
+	if err != nil {
+		return 0, err
+	}
+	data := event.Data
+	err = event.ResetEvent()
+	if err != nil {
+		return 0, err
+	}
+	return data, nil
+}
+
+// ReadAsync reads the event count from another goroutine, sending the
+// result of the read on the returned channel. The event mustn't be used
+// until then.
+func (event *PerfEventInfo) ReadAsync() <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		done <- event.ReadEvent()
+	}()
+	return done
+}
+
+// ScheduleWindows counts the event in windows of "window" every
+// "period" from another goroutine : the event is enabled, read, reset
+// and disabled after "window", then left disabled until the next period.
+// The count of each window is sent on the returned channel. Once "stop"
+// is closed, the event is closed and the channel too. The event mustn't
+// be used in the meantime.
+func (event *PerfEventInfo) ScheduleWindows(window, period time.Duration, stop <-chan struct{}) <-chan uint64 {
+	counts := make(chan uint64, 1)
+	go func() {
+		defer close(counts)
+		defer func() {
+			event.DisableClose()
+			event.Fd = -1
+		}()
+
+		clock := currentClock()
+		wait := func(d time.Duration) bool {
+			select {
+			case <-clock.After(d):
+				return true
+			case <-stop:
+				return false
+			}
+		}
+
+		event.DisableEvent()
+		for {
+			if event.ResetEvent() != nil || event.EnableEvent() != nil {
+				return
+			}
+			if !wait(window) {
+				return
+			}
+			count, err := event.ReadAndReset()
+			if err != nil || event.DisableEvent() != nil {
+				return
+			}
+			select {
+			case counts <- count:
+			case <-stop:
+				return
+			}
+			if period > window && !wait(period-window) {
+				return
+			}
+		}
+	}()
+	return counts
+}
+
 func setBit(properties uint64, bitPos uint64) uint64 {
 	properties |= (1 << bitPos)
 	return properties
@@ -458,5 +1211,27 @@ func setBit(properties uint64, bitPos uint64) uint64 {
 
 // FormatDataToString converts the data for an event to string
 func FormatDataToString(pi PerfEventInfo) string {
-	return strconv.Itoa(int(pi.Data))
+	return strconv.FormatUint(pi.Data, 10)
+}
+
+// FormatDataToStringOpts converts the data for an event to string as per
+// "opts", see FormatOptions.
+func FormatDataToStringOpts(pi PerfEventInfo, opts FormatOptions) string {
+	return opts.format(pi.Data)
+}
+
+// FormatDataDetailed converts the data for an event to string, telling
+// whether the count has been scaled because the event wasn't running
+// for all the time it was enabled, e.g. "12345 (scaled x1.33, running 75%)".
+// Without multiplexing, this is the same as FormatDataToString.
+func FormatDataDetailed(pi PerfEventInfo) string {
+	if pi.TimeRunning == 0 || pi.TimeRunning >= pi.TimeEnabled {
+		return FormatDataToString(pi)
+	}
+	scale := float64(pi.TimeEnabled) / float64(pi.TimeRunning)
+	scaled := uint64(pi.Scaled())
+	running := pi.TimeRunning * 100 / pi.TimeEnabled
+	return strconv.FormatUint(scaled, 10) +
+		" (scaled x" + strconv.FormatFloat(scale, 'f', 2, 64) +
+		", running " + strconv.FormatUint(running, 10) + "%)"
 }
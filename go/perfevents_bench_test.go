@@ -0,0 +1,80 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"runtime"
+	"testing"
+)
+
+// The benchmarks count software events, which every machine has, but
+// for BenchmarkReadUserScaled. Each benchmark is skipped if its events
+// can't be opened.
+
+func BenchmarkOpenReadClose(b *testing.B) {
+	EventsDisableClose(openOrSkip(b, "task-clock", EventOptions{}))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _, eventsInfo := InitOpenEventsEnableSelf("task-clock")
+		EventsRead(eventsInfo)
+		EventsDisableClose(eventsInfo)
+	}
+}
+
+func BenchmarkReadEvent(b *testing.B) {
+	eventsInfo := openOrSkip(b, "task-clock", EventOptions{})
+	defer EventsDisableClose(eventsInfo)
+	event := &eventsInfo[0]
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := event.ReadEvent(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// The events of a group are read in a single read, see ReadGroup, which
+// shouldn't cost much more than reading one event.
+func BenchmarkReadGroup(b *testing.B) {
+	eventsInfo := openOrSkip(b, "{task-clock,page-faults,context-switches}", EventOptions{})
+	defer EventsDisableClose(eventsInfo)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := EventsRead(eventsInfo); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// The events read one by one, to compare with BenchmarkReadGroup.
+func BenchmarkReadUngrouped(b *testing.B) {
+	eventsInfo := openOrSkip(b, "task-clock,page-faults,context-switches", EventOptions{})
+	defer EventsDisableClose(eventsInfo)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := EventsRead(eventsInfo); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Reading from user space only works for the events of the PMU of the
+// CPU, see ReadUserScaled.
+func BenchmarkReadUserScaled(b *testing.B) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	eventsInfo := openOrSkip(b, "cpu-cycles", EventOptions{})
+	defer EventsDisableClose(eventsInfo)
+	event := &eventsInfo[0]
+	if err := event.MapUserPage(); err != nil {
+		b.Skip(err)
+	}
+	if _, err := event.ReadUserScaled(); err != nil {
+		b.Skip(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		event.ReadUserScaled()
+	}
+}
@@ -0,0 +1,740 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"io/ioutil"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// openOrSkip opens the event list "events" for the calling thread as per
+// "opts", skipping the test if perf_event_open isn't permitted or the
+// events aren't supported, e.g. the hardware events on a VM.
+func openOrSkip(t testing.TB, events string, opts EventOptions) []PerfEventInfo {
+	t.Helper()
+	err, eventListNA, eventsInfo := InitOpenEventsEnableSelfWithOptions(events, opts)
+	if err != nil {
+		EventsDisableClose(eventsInfo)
+		t.Skipf("can't open %v: %v", eventListNA, err)
+	}
+	return eventsInfo
+}
+
+// mockPerfEventOpen has perf_event_open fail with "errno" on the CPUs
+// "fail" lets fail, until the test is done.
+func mockPerfEventOpen(t *testing.T, errno syscall.Errno, fail func(cpu int) bool) {
+	open := perfEventOpen
+	perfEventOpen = func(attr *unix.PerfEventAttr, pid int, cpu int, groupFd int, flags int) (int, error) {
+		if fail(cpu) {
+			return -1, errno
+		}
+		return open(attr, pid, cpu, groupFd, flags)
+	}
+	t.Cleanup(func() { perfEventOpen = open })
+}
+
+// ioNone encodes the ioctl number _IO(type, nr) of linux/ioctl.h, i.e.,
+// _IOC(_IOC_NONE, type, nr, 0). _IOC_NONE is 0 in asm-generic/ioctl.h,
+// which x86, arm64 and riscv use, and 1 in the 3 direction bits from bit
+// 29 of powerpc.
+func ioNone(typ, nr uint64, powerpc bool) uint64 {
+	const typeShift = 8
+	if powerpc {
+		return 1<<29 | typ<<typeShift | nr
+	}
+	return typ<<typeShift | nr
+}
+
+// The ioctl numbers of linux/perf_event.h are _IO('$', 0) for ENABLE,
+// _IO('$', 1) for DISABLE and _IO('$', 3) for RESET.
+func TestIOCOps(t *testing.T) {
+	tests := []struct {
+		arch                   string
+		powerpc                bool
+		reset, enable, disable uint64
+	}{
+		{"x86", false, PERF_IOC_RESET_X86, PERF_IOC_ENABLE_X86, PERF_IOC_DISABLE_X86},
+		{"arm64", false, PERF_IOC_RESET_ARM64, PERF_IOC_ENABLE_ARM64, PERF_IOC_DISABLE_ARM64},
+		{"riscv64", false, PERF_IOC_RESET_RISCV64, PERF_IOC_ENABLE_RISCV64, PERF_IOC_DISABLE_RISCV64},
+		{"ppc", true, PERF_IOC_RESET_PPC, PERF_IOC_ENABLE_PPC, PERF_IOC_DISABLE_PPC},
+	}
+	for _, tt := range tests {
+		if want := ioNone('$', 3, tt.powerpc); tt.reset != want {
+			t.Errorf("%s: reset is %#x, want %#x", tt.arch, tt.reset, want)
+		}
+		if want := ioNone('$', 0, tt.powerpc); tt.enable != want {
+			t.Errorf("%s: enable is %#x, want %#x", tt.arch, tt.enable, want)
+		}
+		if want := ioNone('$', 1, tt.powerpc); tt.disable != want {
+			t.Errorf("%s: disable is %#x, want %#x", tt.arch, tt.disable, want)
+		}
+	}
+
+	var event PerfEventInfo
+	if err := event.InitIOCOps(); err != nil {
+		t.Fatal(err)
+	}
+	powerpc := strings.HasPrefix(runtime.GOARCH, "ppc")
+	want := PerfIOCOps{
+		reset:   ioNone('$', 3, powerpc),
+		enable:  ioNone('$', 0, powerpc),
+		disable: ioNone('$', 1, powerpc),
+	}
+	if event.IOCOps != want {
+		t.Errorf("InitIOCOps() on %s = %+v, want %+v", runtime.GOARCH, event.IOCOps, want)
+	}
+	if event.IOCOps.enable != unix.PERF_EVENT_IOC_ENABLE || event.IOCOps.disable != unix.PERF_EVENT_IOC_DISABLE ||
+		event.IOCOps.reset != unix.PERF_EVENT_IOC_RESET {
+		t.Errorf("InitIOCOps() on %s = %+v, not the golang.org/x/sys/unix operations", runtime.GOARCH, event.IOCOps)
+	}
+}
+
+func TestEventNameToConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  EventConfigType
+		ok   bool
+	}{
+		{"cpu-cycles", EventConfigType{PERF_TYPE_HARDWARE, PERF_HW_CPU_CYCLES}, true},
+		{"cycles", EventConfigType{PERF_TYPE_HARDWARE, PERF_HW_CPU_CYCLES}, true},
+		{"task-clock", EventConfigType{PERF_TYPE_SOFTWARE, PERF_COUNT_SW_TASK_CLOCK}, true},
+		{"cs", EventConfigType{PERF_TYPE_SOFTWARE, PERF_COUNT_SW_CONTEXT_SWITCHES}, true},
+		{"r003c", EventConfigType{PERF_TYPE_RAW, 0x3c}, true},
+		{"r1a2B", EventConfigType{PERF_TYPE_RAW, 0x1a2b}, true},
+		{"r", EventConfigType{}, false},
+		{"rxyz", EventConfigType{}, false},
+		{"not-an-event", EventConfigType{}, false},
+		{"", EventConfigType{}, false},
+	}
+	for _, tt := range tests {
+		cfg, ok := EventNameToConfig(tt.name)
+		if cfg != tt.cfg || ok != tt.ok {
+			t.Errorf("EventNameToConfig(%q) = %+v, %t, want %+v, %t", tt.name, cfg, ok, tt.cfg, tt.ok)
+		}
+	}
+}
+
+func TestConfigToEventName(t *testing.T) {
+	for name, cfg := range initEventList() {
+		got, ok := ConfigToEventName(cfg)
+		if !ok {
+			t.Errorf("ConfigToEventName(%+v) for %s not found", cfg, name)
+			continue
+		}
+		if back, _ := EventNameToConfig(got); back != cfg {
+			t.Errorf("ConfigToEventName(%+v) = %s, the config of which is %+v", cfg, got, back)
+		}
+	}
+	if got, ok := ConfigToEventName(NewEventConfigType(PERF_TYPE_RAW, 0x3c)); got != "r3c" || !ok {
+		t.Errorf("ConfigToEventName(raw 0x3c) = %q, %t, want \"r3c\", true", got, ok)
+	}
+	if got, ok := ConfigToEventName(NewEventConfigType(PERF_TYPE_SOFTWARE, 1000)); ok {
+		t.Errorf("ConfigToEventName(software 1000) = %q, want none", got)
+	}
+}
+
+func TestMustOpenEvents(t *testing.T) {
+	EventsDisableClose(openOrSkip(t, "task-clock", EventOptions{}))
+
+	eventsInfo := MustOpenEvents("task-clock,page-faults")
+	defer EventsDisableClose(eventsInfo)
+	if len(eventsInfo) != 2 {
+		t.Fatalf("MustOpenEvents() opened %d events, want 2", len(eventsInfo))
+	}
+	for _, event := range eventsInfo {
+		if event.Fd < 0 || !event.IsEnabled() {
+			t.Errorf("%s: Fd %d, enabled %t", event.EventName, event.Fd, event.IsEnabled())
+		}
+	}
+
+	defer func() {
+		r := recover()
+		msg, ok := r.(string)
+		if !ok || !strings.Contains(msg, "not-an-event") {
+			t.Errorf("MustOpenEvents() panicked with %v, want the event not opened", r)
+		}
+	}()
+	MustOpenEvents("task-clock,not-an-event")
+	t.Error("MustOpenEvents() didn't panic")
+}
+
+func TestOpenEventsNotSupported(t *testing.T) {
+	err, eventListNA, eventsInfo := InitOpenEventsEnableSelf("not-an-event,r,cpu-clock:x")
+	defer EventsDisableClose(eventsInfo)
+	if err != PerfUnsupportedEvent {
+		t.Errorf("InitOpenEventsEnableSelf() = %v, want %v", err, PerfUnsupportedEvent)
+	}
+	if strings.Join(eventListNA, ",") != "not-an-event,r,cpu-clock:x" || len(eventsInfo) != 0 {
+		t.Errorf("InitOpenEventsEnableSelf() opened %d events, not %v", len(eventsInfo), eventListNA)
+	}
+}
+
+// The events resolving to the same attributes are opened once.
+func TestOpenEventsDedup(t *testing.T) {
+	eventsInfo := openOrSkip(t, "page-faults,faults,task-clock,page-faults", EventOptions{})
+	defer EventsDisableClose(eventsInfo)
+	if len(eventsInfo) != 2 || eventsInfo[0].EventName != "page-faults" || eventsInfo[1].EventName != "task-clock" {
+		t.Errorf("opened %d events: %+v, want page-faults and task-clock", len(eventsInfo), eventsInfo)
+	}
+}
+
+func TestSetValues(t *testing.T) {
+	tests := []struct {
+		name       string
+		reads      []uint64
+		reset      bool
+		overflowed bool
+	}{
+		{"growing", []uint64{1, 10, 100}, false, false},
+		{"steady", []uint64{10, 10}, false, false},
+		{"wrapped", []uint64{1 << 40, 5}, false, true},
+		{"wrapped then growing", []uint64{100, 5, 50}, false, true},
+		{"reset", []uint64{100, 5}, true, false},
+	}
+	for _, tt := range tests {
+		event := PerfEventInfo{ReadFormat: PERF_FORMAT_TOTAL_TIME_ENABLED | PERF_FORMAT_TOTAL_TIME_RUNNING}
+		for i, value := range tt.reads {
+			if tt.reset && i == len(tt.reads)-1 {
+				event.resetValues()
+			}
+			event.setValues(ReadFormat{Value: value, TimeEnabled: uint64(i + 1), TimeRunning: uint64(i)})
+		}
+		if event.Overflowed != tt.overflowed {
+			t.Errorf("%s: Overflowed = %t, want %t", tt.name, event.Overflowed, tt.overflowed)
+		}
+		last := len(tt.reads) - 1
+		if event.Data != tt.reads[last] || event.TimeEnabled != uint64(last+1) || event.TimeRunning != uint64(last) {
+			t.Errorf("%s: read %d, %d, %d", tt.name, event.Data, event.TimeEnabled, event.TimeRunning)
+		}
+		if event.LastRead.IsZero() {
+			t.Errorf("%s: LastRead not set", tt.name)
+		}
+	}
+
+	// The times are only set when read.
+	event := PerfEventInfo{TimeEnabled: 7, TimeRunning: 3}
+	event.setValues(ReadFormat{Value: 1, TimeEnabled: 100, TimeRunning: 100})
+	if event.TimeEnabled != 7 || event.TimeRunning != 3 {
+		t.Errorf("times set to %d, %d without the read format", event.TimeEnabled, event.TimeRunning)
+	}
+}
+
+func TestScaled(t *testing.T) {
+	tests := []struct {
+		data, enabled, running uint64
+		multiplexed            bool
+		scaled                 float64
+	}{
+		{100, 0, 0, false, 100},
+		{100, 1000, 1000, false, 100},
+		{100, 1000, 500, true, 200},
+		{100, 1000, 250, true, 400},
+		{0, 1000, 0, true, 0},
+	}
+	for _, tt := range tests {
+		event := PerfEventInfo{Data: tt.data, TimeEnabled: tt.enabled, TimeRunning: tt.running}
+		if got := event.Multiplexed(); got != tt.multiplexed {
+			t.Errorf("Multiplexed(%d/%d) = %t, want %t", tt.running, tt.enabled, got, tt.multiplexed)
+		}
+		if got := event.Scaled(); got != tt.scaled {
+			t.Errorf("Scaled(%d, %d/%d) = %g, want %g", tt.data, tt.running, tt.enabled, got, tt.scaled)
+		}
+	}
+}
+
+func TestReadEvent(t *testing.T) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	eventsInfo := openOrSkip(t, "page-faults,task-clock", EventOptions{})
+	defer EventsDisableClose(eventsInfo)
+
+	touchPages(16)
+	if err := EventsRead(eventsInfo); err != nil {
+		t.Fatal(err)
+	}
+	faults := eventsInfo[0].Data
+	if faults < 16 {
+		t.Errorf("counted %d page faults, want 16 at least", faults)
+	}
+	if eventsInfo[1].Data == 0 || eventsInfo[1].TimeEnabled == 0 {
+		t.Errorf("task-clock read %d, enabled %d", eventsInfo[1].Data, eventsInfo[1].TimeEnabled)
+	}
+
+	// Peek doesn't store the count.
+	touchPages(16)
+	peeked, err := eventsInfo[0].Peek()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if peeked < faults+16 || eventsInfo[0].Data != faults {
+		t.Errorf("Peek() = %d, Data %d, want %d at least and Data left as is", peeked, eventsInfo[0].Data, faults+16)
+	}
+
+	if err := eventsInfo[0].Read32(); err != nil {
+		t.Fatal(err)
+	}
+	if eventsInfo[0].Data < peeked || eventsInfo[0].Data > 0xffffffff {
+		t.Errorf("Read32() read %d, want %d at least", eventsInfo[0].Data, peeked)
+	}
+
+	if err := <-eventsInfo[0].ReadAsync(); err != nil {
+		t.Errorf("ReadAsync() = %v", err)
+	}
+}
+
+func TestReadDelta(t *testing.T) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	eventsInfo := openOrSkip(t, "page-faults", EventOptions{})
+	defer EventsDisableClose(eventsInfo)
+	event := &eventsInfo[0]
+
+	if _, err := event.ReadDelta(); err != nil {
+		t.Fatal(err)
+	}
+	touchPages(32)
+	delta, err := event.ReadDelta()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delta < 32 || delta > 64 {
+		t.Errorf("ReadDelta() = %d after 32 page faults", delta)
+	}
+	if event.Baseline != event.Data {
+		t.Errorf("Baseline %d, want the count read %d", event.Baseline, event.Data)
+	}
+
+	touchPages(32)
+	scaled, err := event.ReadScaledDelta()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scaled < 32 || scaled > 64 {
+		t.Errorf("ReadScaledDelta() = %g after 32 page faults", scaled)
+	}
+
+	// Enabling the event again rebaselines it, the page faults counted
+	// while it was disabled being none.
+	event.RebaselineOnEnable = true
+	if err := event.DisableEvent(); err != nil {
+		t.Fatal(err)
+	}
+	touchPages(32)
+	if err := event.EnableEvent(); err != nil {
+		t.Fatal(err)
+	}
+	delta, err = event.ReadDelta()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delta > 16 {
+		t.Errorf("ReadDelta() = %d, counting while disabled", delta)
+	}
+}
+
+func TestReadAndReset(t *testing.T) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	eventsInfo := openOrSkip(t, "page-faults", EventOptions{})
+	defer EventsDisableClose(eventsInfo)
+	event := &eventsInfo[0]
+
+	epoch := event.Epoch
+	touchPages(32)
+	count, err := event.ReadAndReset()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count < 32 {
+		t.Errorf("ReadAndReset() = %d, want 32 at least", count)
+	}
+	if event.Data != 0 || event.Epoch != epoch+1 {
+		t.Errorf("Data %d, Epoch %d after the reset, want 0, %d", event.Data, event.Epoch, epoch+1)
+	}
+	if err := event.ReadEvent(); err != nil {
+		t.Fatal(err)
+	}
+	if event.Data >= count || event.Overflowed {
+		t.Errorf("read %d after the reset, overflowed %t", event.Data, event.Overflowed)
+	}
+}
+
+func TestEnabled(t *testing.T) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	eventsInfo := openOrSkip(t, "page-faults", EventOptions{Disabled: true})
+	defer EventsDisableClose(eventsInfo)
+	event := &eventsInfo[0]
+
+	steps := []struct {
+		name    string
+		op      func() error
+		enabled bool
+		counts  bool
+	}{
+		{"opened", func() error { return nil }, false, false},
+		{"enabled", event.EnableEvent, true, true},
+		{"enabled again", event.EnableEvent, true, true},
+		{"disabled", event.DisableEvent, false, false},
+		{"disabled again", event.DisableEvent, false, false},
+		{"enabled with its group", event.EnableGroup, true, true},
+	}
+	for _, step := range steps {
+		if err := step.op(); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if event.IsEnabled() != step.enabled {
+			t.Errorf("%s: IsEnabled() = %t, want %t", step.name, event.IsEnabled(), step.enabled)
+		}
+		before, _ := event.Peek()
+		touchPages(16)
+		after, _ := event.Peek()
+		if counts := after-before >= 16; counts != step.counts {
+			t.Errorf("%s: counted %d page faults", step.name, after-before)
+		}
+	}
+}
+
+func TestEventsEnableSync(t *testing.T) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	eventsInfo := openOrSkip(t, "{page-faults,minor-faults},task-clock", EventOptions{Disabled: true})
+	defer EventsDisableClose(eventsInfo)
+	if len(eventsInfo) != 3 || eventsInfo[1].GroupFd != eventsInfo[0].Fd {
+		t.Fatalf("opened %+v, want a group of 2 and an event", eventsInfo)
+	}
+	for _, event := range eventsInfo {
+		if event.IsEnabled() {
+			t.Fatalf("%s opened enabled", event.EventName)
+		}
+	}
+
+	// The group is enabled in one IOCTL call on its leader, an
+	// IOCTL call on the member would fail.
+	eventsInfo[1].IOCOps.enable = 0
+	if err := EventsEnableSync(eventsInfo); err != nil {
+		t.Fatal(err)
+	}
+	touchPages(16)
+	if err := EventsRead(eventsInfo); err != nil {
+		t.Fatal(err)
+	}
+	for _, event := range eventsInfo {
+		if !event.IsEnabled() || event.Data == 0 {
+			t.Errorf("%s: enabled %t, counted %d", event.EventName, event.IsEnabled(), event.Data)
+		}
+	}
+
+	eventsInfo[1].IOCOps.disable = 0
+	if err := EventsDisableSync(eventsInfo); err != nil {
+		t.Fatal(err)
+	}
+	if err := EventsRead(eventsInfo); err != nil {
+		t.Fatal(err)
+	}
+	before := eventsInfo[1].Data
+	touchPages(16)
+	if err := EventsRead(eventsInfo); err != nil {
+		t.Fatal(err)
+	}
+	for _, event := range eventsInfo {
+		if event.IsEnabled() {
+			t.Errorf("%s still enabled", event.EventName)
+		}
+	}
+	if eventsInfo[1].Data != before {
+		t.Errorf("minor-faults counted %d while disabled", eventsInfo[1].Data-before)
+	}
+}
+
+func TestCloseWhere(t *testing.T) {
+	eventsInfo := openOrSkip(t, "page-faults,task-clock,context-switches", EventOptions{})
+	closedFd := eventsInfo[1].Fd
+	survivors, err := CloseWhere(eventsInfo, func(event PerfEventInfo) bool {
+		return event.EventName == "task-clock"
+	})
+	defer EventsDisableClose(survivors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(survivors) != 2 || survivors[0].EventName != "page-faults" || survivors[1].EventName != "context-switches" {
+		t.Errorf("CloseWhere() kept %+v", survivors)
+	}
+	if _, err := unix.FcntlInt(uintptr(closedFd), unix.F_GETFD, 0); err != unix.EBADF {
+		t.Errorf("task-clock descriptor %d not closed: %v", closedFd, err)
+	}
+	if err := EventsRead(survivors); err != nil {
+		t.Errorf("reading the other events: %v", err)
+	}
+}
+
+// The events of the thread on any CPU and on each CPU, closing the ones
+// of CPU 0.
+func TestCloseWhereCPU(t *testing.T) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	var eventsInfo []PerfEventInfo
+	for cpu := -1; cpu < runtime.NumCPU() && cpu < 4; cpu++ {
+		err, _, events := InitOpenEventsEnable("task-clock,page-faults", 0, cpu)
+		eventsInfo = append(eventsInfo, events...)
+		if err != nil {
+			EventsDisableClose(eventsInfo)
+			t.Skip("perf_event_open not permitted: ", err)
+		}
+	}
+	var closedFds []int
+	for _, event := range eventsInfo {
+		if event.Cpu == 0 {
+			closedFds = append(closedFds, event.Fd)
+		}
+	}
+
+	survivors, err := CloseWhere(eventsInfo, func(event PerfEventInfo) bool {
+		return event.Cpu == 0
+	})
+	defer EventsDisableClose(survivors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(survivors) != len(eventsInfo)-2 || len(closedFds) != 2 {
+		t.Fatalf("CloseWhere() kept %d events of %d, closing %d", len(survivors), len(eventsInfo), len(closedFds))
+	}
+	for _, fd := range closedFds {
+		if _, err := unix.FcntlInt(uintptr(fd), unix.F_GETFD, 0); err != unix.EBADF {
+			t.Errorf("descriptor %d of CPU 0 not closed: %v", fd, err)
+		}
+	}
+	for _, event := range survivors {
+		if event.Cpu == 0 {
+			t.Errorf("CloseWhere() kept %s of CPU 0", event.EventName)
+		}
+		if _, err := unix.FcntlInt(uintptr(event.Fd), unix.F_GETFD, 0); err != nil {
+			t.Errorf("%s of CPU %d closed: %v", event.EventName, event.Cpu, err)
+		}
+	}
+	touchPages(16)
+	if err := EventsRead(survivors); err != nil {
+		t.Fatalf("reading the other events: %v", err)
+	}
+	// The events of any CPU still count.
+	if survivors[1].Cpu != -1 || survivors[1].Data < 16 {
+		t.Errorf("%s of CPU %d counted %d, want 16 at least", survivors[1].EventName, survivors[1].Cpu, survivors[1].Data)
+	}
+}
+
+func TestEventFdErrors(t *testing.T) {
+	event := PerfEventInfo{Fd: -1}
+	for name, op := range map[string]func() error{
+		"ResetEvent":   event.ResetEvent,
+		"EnableEvent":  event.EnableEvent,
+		"EnableGroup":  event.EnableGroup,
+		"DisableEvent": event.DisableEvent,
+		"DisableClose": event.DisableClose,
+		"Reopen":       event.Reopen,
+	} {
+		if err := op(); err != PerfFdError {
+			t.Errorf("%s() on a closed event = %v, want %v", name, err, PerfFdError)
+		}
+	}
+	if event.IsStale() {
+		t.Error("IsStale() on a closed event")
+	}
+
+	event.Fd = 100
+	if err := event.OpenEvent(setupPerfEventAttr(EventConfigType{PERF_TYPE_SOFTWARE, 0}), 0, -1, -1, 0); err != PerfFdError {
+		t.Errorf("OpenEvent() on an open event = %v, want %v", err, PerfFdError)
+	}
+}
+
+func TestNonBlock(t *testing.T) {
+	eventsInfo := openOrSkip(t, "task-clock", EventOptions{NonBlock: true})
+	defer EventsDisableClose(eventsInfo)
+	event := &eventsInfo[0]
+	if !event.NonBlock {
+		t.Fatal("NonBlock not set")
+	}
+	flags, err := unix.FcntlInt(uintptr(event.Fd), unix.F_GETFL, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flags&unix.O_NONBLOCK == 0 {
+		t.Error("descriptor not in non-blocking mode")
+	}
+	if err := event.ReadEvent(); err != nil {
+		t.Errorf("ReadEvent() = %v", err)
+	}
+}
+
+// A read with no data yet, as on an empty non-blocking pipe, leaves the
+// count of a non-blocking event as it is.
+func TestNonBlockEAGAIN(t *testing.T) {
+	var p [2]int
+	if err := syscall.Pipe2(p[:], syscall.O_NONBLOCK|syscall.O_CLOEXEC); err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(p[0])
+	defer syscall.Close(p[1])
+
+	tests := []struct {
+		nonBlock bool
+		err      error
+	}{
+		{true, nil},
+		{false, PerfReadError},
+	}
+	for _, tt := range tests {
+		event := PerfEventInfo{Fd: p[0], NonBlock: tt.nonBlock, Data: 42, ReadFormat: formatTimes}
+		if err := event.ReadEvent(); err != tt.err || event.Data != 42 {
+			t.Errorf("ReadEvent() NonBlock %v = %v, Data %d, want %v, 42", tt.nonBlock, err, event.Data, tt.err)
+		}
+		data, err := event.Peek()
+		if tt.err == nil && (err != nil || data != 42) {
+			t.Errorf("Peek() NonBlock %v = %d, %v, want 42", tt.nonBlock, data, err)
+		}
+		if tt.err != nil && err != PerfReadError {
+			t.Errorf("Peek() NonBlock %v = %d, %v, want %v", tt.nonBlock, data, err, PerfReadError)
+		}
+	}
+}
+
+// A checkpoint and restore (CRIU) leaves the descriptors of the events
+// closed, or used by other files.
+func TestReopen(t *testing.T) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	eventsInfo := openOrSkip(t, "page-faults", EventOptions{})
+	event := &eventsInfo[0]
+	defer event.DisableClose()
+
+	touchPages(16)
+	if err := event.ReadEvent(); err != nil {
+		t.Fatal(err)
+	}
+	if event.IsStale() {
+		t.Fatal("IsStale() on an open event")
+	}
+
+	// Closed behind its back.
+	epoch := event.Epoch
+	syscall.Close(event.Fd)
+	if !event.IsStale() {
+		t.Error("IsStale() false on a closed descriptor")
+	}
+	if err := event.ReadEvent(); err != PerfFdError {
+		t.Errorf("ReadEvent() = %v, want %v", err, PerfFdError)
+	}
+	event.ReopenOnBadFd = true
+	touchPages(16)
+	if err := event.ReadEvent(); err != nil {
+		t.Fatalf("ReadEvent() with ReopenOnBadFd = %v", err)
+	}
+	if event.Epoch != epoch+1 || !event.IsEnabled() || event.IsStale() {
+		t.Errorf("reopened with Epoch %d, enabled %t, stale %t", event.Epoch, event.IsEnabled(), event.IsStale())
+	}
+	touchPages(16)
+	if err := event.ReadEvent(); err != nil {
+		t.Fatal(err)
+	}
+	if event.Data < 16 {
+		t.Errorf("counted %d page faults once reopened", event.Data)
+	}
+
+	// Used by another file, which Reopen leaves open.
+	fd := event.Fd
+	syscall.Close(fd)
+	f, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if int(f.Fd()) != fd {
+		t.Skipf("%s opened as %d, not the closed descriptor %d", os.DevNull, f.Fd(), fd)
+	}
+	if !event.IsStale() {
+		t.Error("IsStale() false on a descriptor of another file")
+	}
+	if err := event.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Stat(); err != nil {
+		t.Errorf("Reopen() closed the other file: %v", err)
+	}
+	if event.Fd == fd || event.Epoch != epoch+2 {
+		t.Errorf("reopened on %d, Epoch %d", event.Fd, event.Epoch)
+	}
+}
+
+// The syscalls are retried when interrupted by the SIGPROF of the CPU
+// profiler.
+func TestSIGPROF(t *testing.T) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	eventsInfo := openOrSkip(t, "task-clock,page-faults", EventOptions{})
+	defer EventsDisableClose(eventsInfo)
+
+	if err := pprof.StartCPUProfile(ioutil.Discard); err != nil {
+		t.Skipf("can't profile: %v", err)
+	}
+	defer pprof.StopCPUProfile()
+
+	deadline := time.Now().Add(200 * time.Millisecond)
+	for i := 0; time.Now().Before(deadline); i++ {
+		if err := EventsRead(eventsInfo); err != nil {
+			t.Fatalf("read %d: %v", i, err)
+		}
+		if err := EventsDisableSync(eventsInfo); err != nil {
+			t.Fatalf("disable %d: %v", i, err)
+		}
+		if err := EventsEnableSync(eventsInfo); err != nil {
+			t.Fatalf("enable %d: %v", i, err)
+		}
+		if _, err := eventsInfo[1].ReadAndReset(); err != nil {
+			t.Fatalf("reset %d: %v", i, err)
+		}
+	}
+}
+
+func TestScheduleWindows(t *testing.T) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	c := useFakeClock(t)
+	eventsInfo := openOrSkip(t, "page-faults", EventOptions{})
+	event := &eventsInfo[0]
+
+	stop := make(chan struct{})
+	counts := event.ScheduleWindows(10*time.Millisecond, 30*time.Millisecond, stop)
+
+	// The event counts during the window.
+	c.waitTimers(t, 1)
+	touchPages(16)
+	c.Advance(10 * time.Millisecond)
+	if count := <-counts; count < 16 {
+		t.Errorf("counted %d page faults in the window, want 16 at least", count)
+	}
+
+	// Not until the next period.
+	c.waitTimers(t, 1)
+	touchPages(64)
+	c.Advance(20 * time.Millisecond)
+	c.waitTimers(t, 1)
+	c.Advance(10 * time.Millisecond)
+	if count := <-counts; count >= 64 {
+		t.Errorf("counted %d page faults out of the window", count)
+	}
+
+	close(stop)
+	for range counts {
+	}
+	if event.Fd != -1 {
+		t.Errorf("event left open on %d", event.Fd)
+	}
+}
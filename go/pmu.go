@@ -0,0 +1,131 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"strings"
+	"sync"
+)
+
+// Result of the hardware PMU probe, which is done only once.
+var hardwarePMU struct {
+	once    sync.Once
+	present bool
+}
+
+// probeHardwarePMU checks whether cpu-cycles can be opened and counts.
+// Some VMs don't virtualize the PMU, in which case the hardware events
+// either fail to open or never count.
+var probeHardwarePMU = func() bool {
+	var event PerfEventInfo
+	err := event.InitOpenEventEnableSelf("cpu-cycles")
+	if err != nil {
+		return false
+	}
+	defer event.DisableClose()
+
+	// Burn a few cycles for the counter to count.
+	sum := 0
+	for i := 0; i < 100000; i++ {
+		sum += i
+	}
+	err = event.ReadEvent()
+	return err == nil && event.Data != 0 && sum != 0
+}
+
+// HasHardwarePMU tells whether the hardware events can be counted on
+// this machine. The result of the probe is cached.
+func HasHardwarePMU() bool {
+	hardwarePMU.once.Do(func() {
+		hardwarePMU.present = probeHardwarePMU()
+	})
+	return hardwarePMU.present
+}
+
+// IsHardwareEvent tells whether the event "name" is a hardware event,
+// hardware cache and raw ones included, modifiers or not, e.g. "cycles:u".
+func IsHardwareEvent(name string) bool {
+	event := parseEvent(name)
+	if event.Err != nil {
+		return false
+	}
+	switch event.Type {
+	case PERF_TYPE_HARDWARE, PERF_TYPE_HW_CACHE, PERF_TYPE_RAW:
+		return true
+	}
+	return false
+}
+
+// Software equivalents of the hardware events, which count about the
+// same on a machine without a PMU, see SoftwareFallbackEventList : the
+// cycles go along with the time the CPU ran the task, and so do the
+// instructions, roughly.
+var softwareFallbacks = map[string]string{
+	"cpu-cycles":   "cpu-clock",
+	"bus-cycles":   "cpu-clock",
+	"instructions": "task-clock",
+}
+
+// SoftwareFallbackEventList returns the event list "events" with its
+// hardware events replaced by their software equivalent, modifiers kept,
+// e.g. "cpu-cycles:u" by "cpu-clock:u", for a machine without a PMU, see
+// HasHardwarePMU. The hardware events without an equivalent are left
+// out. The events replaced or left out are returned along with the list.
+func SoftwareFallbackEventList(events string) (string, []string) {
+	var fallen []string
+	list := mapEventList(events, func(name string) string {
+		if !IsHardwareEvent(name) {
+			return name
+		}
+		fallen = append(fallen, name)
+		event := parseEvent(name)
+		fallback, ok := softwareFallbacks[event.Canonical]
+		if !ok {
+			return ""
+		}
+		if event.Modifiers != "" {
+			fallback += ":" + event.Modifiers
+		}
+		return fallback
+	})
+	return list, fallen
+}
+
+// FilterEventList returns the event list "events" without the events for
+// which "keep" returns false, groups being kept as groups.
+func FilterEventList(events string, keep func(string) bool) string {
+	return mapEventList(events, func(name string) string {
+		if keep(name) {
+			return name
+		}
+		return ""
+	})
+}
+
+// mapEventList returns the event list "events" with its events replaced
+// by what "f" returns for them, the events for which it returns "" being
+// left out, groups being kept as groups.
+func mapEventList(events string, f func(string) string) string {
+	groups, err := ParseEventGroups(events)
+	if err != nil {
+		return events
+	}
+	entries := make([]string, 0, len(groups))
+	for _, group := range groups {
+		names := make([]string, 0, len(group))
+		for _, name := range group {
+			if mapped := f(name); mapped != "" {
+				names = append(names, mapped)
+			}
+		}
+		switch {
+		case len(names) == 0:
+		case len(group) == 1:
+			entries = append(entries, names[0])
+		default:
+			entries = append(entries, "{"+strings.Join(names, ",")+"}")
+		}
+	}
+	return strings.Join(entries, ",")
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// mockHardwarePMU has HasHardwarePMU probe "present" rather than the
+// machine, until the test is done.
+func mockHardwarePMU(t *testing.T, present bool) {
+	probe := probeHardwarePMU
+	probes := 0
+	probeHardwarePMU = func() bool {
+		probes++
+		return present
+	}
+	hardwarePMU.once = sync.Once{}
+	t.Cleanup(func() {
+		probeHardwarePMU = probe
+		hardwarePMU.once = sync.Once{}
+		if probes > 1 {
+			t.Errorf("the PMU was probed %d times, want once", probes)
+		}
+	})
+}
+
+func TestHasHardwarePMU(t *testing.T) {
+	for _, present := range []bool{true, false} {
+		t.Run(map[bool]string{true: "present", false: "absent"}[present], func(t *testing.T) {
+			mockHardwarePMU(t, present)
+			for i := 0; i < 3; i++ {
+				if got := HasHardwarePMU(); got != present {
+					t.Fatalf("HasHardwarePMU() = %v, want %v", got, present)
+				}
+			}
+		})
+	}
+}
+
+func TestIsHardwareEvent(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"cpu-cycles", true},
+		{"cycles:u", true},
+		{"instructions:k", true},
+		{"L1-dcache-load-misses", true},
+		{"r003c", true},
+		{"cpu-clock", false},
+		{"page-faults:u", false},
+		{"no-such-event", false},
+		{"cpu-cycles:z", false},
+	}
+	for _, tt := range tests {
+		if got := IsHardwareEvent(tt.name); got != tt.want {
+			t.Errorf("IsHardwareEvent(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFilterEventList(t *testing.T) {
+	keepSoftware := func(name string) bool { return !IsHardwareEvent(name) }
+	tests := []struct {
+		events string
+		want   string
+	}{
+		{"cpu-cycles,cpu-clock", "cpu-clock"},
+		{"{cpu-cycles,instructions},page-faults", "page-faults"},
+		{"{cpu-cycles,task-clock,page-faults},cs", "{task-clock,page-faults},cs"},
+		{"{cpu-cycles,task-clock}", "{task-clock}"},
+		{"cpu-cycles", ""},
+		{"{cpu-cycles", "{cpu-cycles"},
+	}
+	for _, tt := range tests {
+		if got := FilterEventList(tt.events, keepSoftware); got != tt.want {
+			t.Errorf("FilterEventList(%q) = %q, want %q", tt.events, got, tt.want)
+		}
+	}
+}
+
+func TestSoftwareFallbackEventList(t *testing.T) {
+	tests := []struct {
+		events string
+		want   string
+		fallen []string
+	}{
+		{"cpu-clock,page-faults", "cpu-clock,page-faults", nil},
+		{"cpu-cycles", "cpu-clock", []string{"cpu-cycles"}},
+		{"cycles:u,bus-cycles", "cpu-clock:u,cpu-clock", []string{"cycles:u", "bus-cycles"}},
+		{"{cpu-cycles,instructions},cache-misses", "{cpu-clock,task-clock}", []string{"cpu-cycles", "instructions", "cache-misses"}},
+		{"{cache-references,cache-misses}", "", []string{"cache-references", "cache-misses"}},
+	}
+	for _, tt := range tests {
+		got, fallen := SoftwareFallbackEventList(tt.events)
+		if got != tt.want || !reflect.DeepEqual(fallen, tt.fallen) {
+			t.Errorf("SoftwareFallbackEventList(%q) = %q, %q, want %q, %q",
+				tt.events, got, fallen, tt.want, tt.fallen)
+		}
+		if got != "" {
+			if err := ValidateEvents(got); err != nil {
+				t.Errorf("SoftwareFallbackEventList(%q) = %q: %v", tt.events, got, err)
+			}
+		}
+	}
+}
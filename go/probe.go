@@ -0,0 +1,162 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"debug/elf"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"unsafe"
+)
+
+var PerfProbeError = errors.New("couldn't resolve the probed function")
+
+// The probe events count the calls to a function, or its returns for
+// the ret probes, given as:
+//
+//	kprobe:<kernel function>[+<offset>]
+//	kretprobe:<kernel function>
+//	uprobe:<path to an ELF file>@<symbol or offset>
+//	uretprobe:<path to an ELF file>@<symbol>
+//
+// e.g. "kprobe:vfs_read" or "uprobe:/usr/lib/libc.so.6@malloc". They are
+// opened with the kprobe and uprobe PMUs, which need to be root or
+// CAP_PERFMON, and Linux 4.17 at least.
+var probePMUs = map[string]string{
+	"kprobe":    "kprobe",
+	"kretprobe": "kprobe",
+	"uprobe":    "uprobe",
+	"uretprobe": "uprobe",
+}
+
+// The attributes of a probe event point to the name of its function, or
+// to the path of its ELF file, as a NUL terminated string. probeStrings
+// keeps these strings alive, and at the same address, for as long as the
+// events may be reopened.
+var probeStrings struct {
+	sync.Mutex
+	strings map[string][]byte
+}
+
+// probeString returns the address of the NUL terminated copy of "s".
+func probeString(s string) uint64 {
+	probeStrings.Lock()
+	defer probeStrings.Unlock()
+	if probeStrings.strings == nil {
+		probeStrings.strings = make(map[string][]byte)
+	}
+	buf, ok := probeStrings.strings[s]
+	if !ok {
+		buf = append([]byte(s), 0)
+		probeStrings.strings[s] = buf
+	}
+	return uint64(uintptr(unsafe.Pointer(&buf[0])))
+}
+
+// isProbeEvent tells whether the event "name", e.g. "kprobe:vfs_read",
+// is a probe event.
+func isProbeEvent(name string) bool {
+	i := strings.IndexByte(name, ':')
+	if i < 0 {
+		return false
+	}
+	_, ok := probePMUs[name[:i]]
+	return ok
+}
+
+// resolveProbe sets up the perf event attributes for the probe event
+// "name". The kprobes are hit in the kernel, so a kprobe event counts in
+// the kernel by default.
+func resolveProbe(name string) (PerfEventAttr, error) {
+	var eventAttr PerfEventAttr
+	i := strings.IndexByte(name, ':')
+	kind, target := name[:i], name[i+1:]
+	pmu := probePMUs[kind]
+	pmuPath := filepath.Join(sysfsPMUPath, pmu)
+
+	typeHw, err := readSysfsUint(filepath.Join(pmuPath, "type"))
+	if err != nil {
+		return eventAttr, PerfUnsupportedEvent
+	}
+	eventAttr = setupPerfEventAttr(EventConfigType{uint32(typeHw), 0})
+
+	retprobe := strings.HasSuffix(kind, "retprobe")
+	if retprobe {
+		format, err := ioutil.ReadFile(filepath.Join(pmuPath, "format", "retprobe"))
+		if err != nil {
+			return eventAttr, PerfSysfsFormatError
+		}
+		err = eventAttr.setFormatTerm(strings.TrimSpace(string(format)), 1)
+		if err != nil {
+			return eventAttr, err
+		}
+	}
+
+	if pmu == "kprobe" {
+		function, offset := target, uint64(0)
+		if j := strings.IndexByte(target, '+'); j >= 0 && !retprobe {
+			function = target[:j]
+			offset, err = strconv.ParseUint(target[j+1:], 0, 64)
+			if err != nil {
+				return eventAttr, PerfProbeError
+			}
+		}
+		if function == "" {
+			return eventAttr, PerfProbeError
+		}
+		eventAttr.Ext1 = probeString(function)
+		eventAttr.Ext2 = offset
+		eventAttr.Bits &^= 1 << EXCLUDE_KERNEL
+		return eventAttr, nil
+	}
+
+	j := strings.LastIndexByte(target, '@')
+	if j <= 0 {
+		return eventAttr, PerfProbeError
+	}
+	path, symbol := target[:j], target[j+1:]
+	offset, err := strconv.ParseUint(symbol, 0, 64)
+	if err != nil {
+		offset, err = elfSymbolOffset(path, symbol)
+		if err != nil {
+			return eventAttr, err
+		}
+	}
+	eventAttr.Ext1 = probeString(path)
+	eventAttr.Ext2 = offset
+	return eventAttr, nil
+}
+
+// elfSymbolOffset returns the offset in the ELF file "path" of the code
+// of the function "symbol", where the uprobes are placed.
+func elfSymbolOffset(path string, symbol string) (uint64, error) {
+	f, err := elf.Open(path)
+	if err != nil {
+		return 0, PerfProbeError
+	}
+	defer f.Close()
+
+	syms, _ := f.Symbols()
+	dynSyms, _ := f.DynamicSymbols()
+	for _, sym := range append(syms, dynSyms...) {
+		if sym.Name != symbol || elf.ST_TYPE(sym.Info) != elf.STT_FUNC || sym.Value == 0 {
+			continue
+		}
+		// The symbols give the virtual address of the functions,
+		// the segments where to find them in the file.
+		for _, prog := range f.Progs {
+			if prog.Type != elf.PT_LOAD || prog.Flags&elf.PF_X == 0 {
+				continue
+			}
+			if sym.Value >= prog.Vaddr && sym.Value < prog.Vaddr+prog.Memsz {
+				return sym.Value - prog.Vaddr + prog.Off, nil
+			}
+		}
+	}
+	return 0, PerfProbeError
+}
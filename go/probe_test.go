@@ -0,0 +1,174 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"unsafe"
+)
+
+func TestIsProbeEvent(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"kprobe:vfs_read", true},
+		{"kretprobe:vfs_read", true},
+		{"uprobe:/bin/true@main", true},
+		{"uretprobe:/bin/true@main", true},
+		{"kprobe", false},
+		{"sched:sched_switch", false},
+		{"cpu-cycles", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := isProbeEvent(tt.name); got != tt.want {
+			t.Errorf("isProbeEvent(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// libcOrSkip returns the path to the C library, whose functions are
+// probed, the go test binaries being stripped of their symbols.
+func libcOrSkip(t *testing.T) string {
+	for _, pattern := range []string{"/lib/*/libc.so.6", "/lib64/libc.so.6", "/usr/lib*/libc.so.6"} {
+		if paths, _ := filepath.Glob(pattern); len(paths) > 0 {
+			return paths[0]
+		}
+	}
+	t.Skip("libc.so.6 not found")
+	return ""
+}
+
+// probeTarget returns the string kept by probeString at "addr".
+func probeTarget(addr uint64) string {
+	probeStrings.Lock()
+	defer probeStrings.Unlock()
+	for s, buf := range probeStrings.strings {
+		if uint64(uintptr(unsafe.Pointer(&buf[0]))) == addr {
+			return s
+		}
+	}
+	return ""
+}
+
+func TestResolveProbe(t *testing.T) {
+	libc := libcOrSkip(t)
+	malloc, err := elfSymbolOffset(libc, "malloc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fakeSysfs(t, map[string]string{
+		"kprobe/type":            "8\n",
+		"kprobe/format/retprobe": "config:0\n",
+		"uprobe/type":            "9\n",
+		"uprobe/format/retprobe": "config:0\n",
+	})
+
+	tests := []struct {
+		name          string
+		typeHw        uint32
+		config        uint64
+		target        string
+		offset        uint64
+		excludeKernel bool
+		err           error
+	}{
+		{"kprobe:vfs_read", 8, 0, "vfs_read", 0, false, nil},
+		{"kprobe:vfs_read+0x10", 8, 0, "vfs_read", 0x10, false, nil},
+		{"kretprobe:vfs_read", 8, 1, "vfs_read", 0, false, nil},
+		{"uprobe:" + libc + "@0x1000", 9, 0, libc, 0x1000, true, nil},
+		{"uprobe:" + libc + "@malloc", 9, 0, libc, malloc, true, nil},
+		{"uretprobe:" + libc + "@malloc", 9, 1, libc, malloc, true, nil},
+		{"kprobe:", 0, 0, "", 0, false, PerfProbeError},
+		{"kprobe:+0x10", 0, 0, "", 0, false, PerfProbeError},
+		{"kprobe:vfs_read+ten", 0, 0, "", 0, false, PerfProbeError},
+		{"uprobe:" + libc, 0, 0, "", 0, false, PerfProbeError},
+		{"uprobe:@main", 0, 0, "", 0, false, PerfProbeError},
+		{"uprobe:" + libc + "@no_such_function", 0, 0, "", 0, false, PerfProbeError},
+		{"uprobe:/no/such/file@main", 0, 0, "", 0, false, PerfProbeError},
+	}
+	for _, tt := range tests {
+		eventAttr, err := resolveProbe(tt.name)
+		if err != tt.err {
+			t.Errorf("resolveProbe(%q) = %v, want %v", tt.name, err, tt.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if eventAttr.Type != tt.typeHw || eventAttr.Config != tt.config {
+			t.Errorf("resolveProbe(%q) = type %d, config %#x, want %d, %#x",
+				tt.name, eventAttr.Type, eventAttr.Config, tt.typeHw, tt.config)
+		}
+		if target := probeTarget(eventAttr.Ext1); target != tt.target || eventAttr.Ext2 != tt.offset {
+			t.Errorf("resolveProbe(%q) probes %q at %#x, want %q at %#x",
+				tt.name, target, eventAttr.Ext2, tt.target, tt.offset)
+		}
+		if excludeKernel := eventAttr.Bits&(1<<EXCLUDE_KERNEL) != 0; excludeKernel != tt.excludeKernel {
+			t.Errorf("resolveProbe(%q) excludes the kernel: %v, want %v", tt.name, excludeKernel, tt.excludeKernel)
+		}
+	}
+}
+
+func TestResolveProbeNoPMU(t *testing.T) {
+	fakeSysfs(t, map[string]string{"uprobe/type": "9\n"})
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"kprobe:vfs_read", PerfUnsupportedEvent},
+		{"uretprobe:/bin/true@0x1000", PerfSysfsFormatError},
+	}
+	for _, tt := range tests {
+		if _, err := resolveProbe(tt.name); err != tt.err {
+			t.Errorf("resolveProbe(%q) = %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestProbeString(t *testing.T) {
+	a, b := probeString("vfs_read"), probeString("vfs_write")
+	if a == b || probeTarget(a) != "vfs_read" || probeTarget(b) != "vfs_write" {
+		t.Errorf("probeString() = %q, %q", probeTarget(a), probeTarget(b))
+	}
+	// The same string keeps its address, for the events to be reopened.
+	if again := probeString("vfs_read"); again != a {
+		t.Errorf("probeString() moved from %#x to %#x", a, again)
+	}
+}
+
+func TestElfSymbolOffset(t *testing.T) {
+	libc := libcOrSkip(t)
+	info, err := os.Stat(libc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path, symbol string
+		ok           bool
+	}{
+		{libc, "malloc", true},
+		{libc, "free", true},
+		// An object, not a function.
+		{libc, "environ", false},
+		{libc, "no_such_function", false},
+		{"/no/such/file", "main", false},
+		{"/proc/self/status", "main", false},
+	}
+	for _, tt := range tests {
+		offset, err := elfSymbolOffset(tt.path, tt.symbol)
+		if !tt.ok {
+			if err != PerfProbeError {
+				t.Errorf("elfSymbolOffset(%q, %q) = %#x, %v, want %v", tt.path, tt.symbol, offset, err, PerfProbeError)
+			}
+			continue
+		}
+		if err != nil || offset == 0 || offset >= uint64(info.Size()) {
+			t.Errorf("elfSymbolOffset(%q, %q) = %#x, %v, not in the file", tt.path, tt.symbol, offset, err)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Bits for the PerfEventAttr.Read_format value derived from
+// linux/perf_event.h
+// Each of these bits adds a value to what a read on the event returns.
+const (
+	PERF_FORMAT_TOTAL_TIME_ENABLED = 1 << 0
+	PERF_FORMAT_TOTAL_TIME_RUNNING = 1 << 1
+	PERF_FORMAT_ID                 = 1 << 2
+	PERF_FORMAT_GROUP              = 1 << 3
+	PERF_FORMAT_LOST               = 1 << 4
+)
+
+var PerfShortRead = errors.New("read buffer too short for the read format")
+
+// formatLostSupported tells whether the kernel knows of PERF_FORMAT_LOST,
+// which Linux 6.0 added. A kernel the release of which can't be told is
+// taken for supporting it.
+var formatLostSupported = func() bool {
+	var uname unix.Utsname
+	if unix.Uname(&uname) != nil {
+		return true
+	}
+	major, _, ok := parseKernelRelease(unix.ByteSliceToString(uname.Release[:]))
+	return !ok || major >= 6
+}
+
+// parseKernelRelease returns the major and minor versions of the kernel
+// release "release", e.g. 6 and 1 for "6.1.0-13-amd64".
+func parseKernelRelease(release string) (int, int, bool) {
+	fields := strings.SplitN(release, ".", 3)
+	if len(fields) < 2 {
+		return 0, 0, false
+	}
+	major, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return 0, 0, false
+	}
+	minor := fields[1]
+	if i := strings.IndexFunc(minor, func(r rune) bool { return r < '0' || r > '9' }); i >= 0 {
+		minor = minor[:i]
+	}
+	minorVersion, err := strconv.Atoi(minor)
+	if err != nil {
+		return 0, 0, false
+	}
+	return major, minorVersion, true
+}
+
+// The kernel returns the values, of the reads as of the records, in the
+// byte order of the CPU.
+var nativeEndian = func() binary.ByteOrder {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 1 {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}()
+
+// GroupReadValue is the value of one event of a group read.
+// Value : Count of the event.
+// Id : Id of the event, if PERF_FORMAT_ID is set.
+// Lost : Number of samples of the event lost, if PERF_FORMAT_LOST is set.
+type GroupReadValue struct {
+	Value uint64
+	Id    uint64
+	Lost  uint64
+}
+
+// GroupReadFormat is what a read on a group leader opened with
+// PERF_FORMAT_GROUP returns. Its layout is :
+//
+//	u64 nr;
+//	u64 time_enabled;  if PERF_FORMAT_TOTAL_TIME_ENABLED
+//	u64 time_running;  if PERF_FORMAT_TOTAL_TIME_RUNNING
+//	{ u64 value;
+//	  u64 id;          if PERF_FORMAT_ID
+//	  u64 lost;        if PERF_FORMAT_LOST
+//	} values[nr];
+//
+// The values are in the order the events were added to the group,
+// starting with the leader.
+type GroupReadFormat struct {
+	Nr          uint64
+	TimeEnabled uint64
+	TimeRunning uint64
+	Values      []GroupReadValue
+}
+
+// ParseGroupRead decodes the buffer read from a group leader opened
+// with the read format "readFormat".
+func ParseGroupRead(buf []byte, readFormat uint64) (GroupReadFormat, error) {
+	var group GroupReadFormat
+	if readFormat&PERF_FORMAT_GROUP == 0 {
+		return group, errors.New("ParseGroupRead: PERF_FORMAT_GROUP not set")
+	}
+
+	off := 0
+	next := func() (uint64, bool) {
+		if off+8 > len(buf) {
+			return 0, false
+		}
+		v := nativeEndian.Uint64(buf[off:])
+		off += 8
+		return v, true
+	}
+
+	var ok bool
+	if group.Nr, ok = next(); !ok {
+		return group, PerfShortRead
+	}
+	if readFormat&PERF_FORMAT_TOTAL_TIME_ENABLED != 0 {
+		if group.TimeEnabled, ok = next(); !ok {
+			return group, PerfShortRead
+		}
+	}
+	if readFormat&PERF_FORMAT_TOTAL_TIME_RUNNING != 0 {
+		if group.TimeRunning, ok = next(); !ok {
+			return group, PerfShortRead
+		}
+	}
+
+	valueSize := uint64(8)
+	if readFormat&PERF_FORMAT_ID != 0 {
+		valueSize += 8
+	}
+	if readFormat&PERF_FORMAT_LOST != 0 {
+		valueSize += 8
+	}
+	if group.Nr > uint64(len(buf)-off)/valueSize {
+		return group, PerfShortRead
+	}
+	group.Values = make([]GroupReadValue, group.Nr)
+	for i := range group.Values {
+		group.Values[i].Value, _ = next()
+		if readFormat&PERF_FORMAT_ID != 0 {
+			group.Values[i].Id, _ = next()
+		}
+		if readFormat&PERF_FORMAT_LOST != 0 {
+			group.Values[i].Lost, _ = next()
+		}
+	}
+	return group, nil
+}
+
+// ReadFormat is what a read on an event opened without
+// PERF_FORMAT_GROUP returns. Its layout is :
+//
+//	u64 value;
+//	u64 time_enabled;  if PERF_FORMAT_TOTAL_TIME_ENABLED
+//	u64 time_running;  if PERF_FORMAT_TOTAL_TIME_RUNNING
+//	u64 id;            if PERF_FORMAT_ID
+//	u64 lost;          if PERF_FORMAT_LOST
+type ReadFormat struct {
+	Value       uint64
+	TimeEnabled uint64
+	TimeRunning uint64
+	Id          uint64
+	Lost        uint64
+}
+
+// readSize returns the size of what a read on an event opened without
+// PERF_FORMAT_GROUP and with the read format "readFormat" returns.
+func readSize(readFormat uint64) int {
+	size := 8
+	for _, bit := range []uint64{PERF_FORMAT_TOTAL_TIME_ENABLED,
+		PERF_FORMAT_TOTAL_TIME_RUNNING, PERF_FORMAT_ID, PERF_FORMAT_LOST} {
+		if readFormat&bit != 0 {
+			size += 8
+		}
+	}
+	return size
+}
+
+// ParseRead decodes the buffer read from an event opened without
+// PERF_FORMAT_GROUP and with the read format "readFormat".
+func ParseRead(buf []byte, readFormat uint64) (ReadFormat, error) {
+	var values ReadFormat
+	if readFormat&PERF_FORMAT_GROUP != 0 {
+		return values, errors.New("ParseRead: PERF_FORMAT_GROUP set")
+	}
+	if len(buf) < readSize(readFormat) {
+		return values, PerfShortRead
+	}
+
+	off := 0
+	next := func() uint64 {
+		v := nativeEndian.Uint64(buf[off:])
+		off += 8
+		return v
+	}
+	values.Value = next()
+	if readFormat&PERF_FORMAT_TOTAL_TIME_ENABLED != 0 {
+		values.TimeEnabled = next()
+	}
+	if readFormat&PERF_FORMAT_TOTAL_TIME_RUNNING != 0 {
+		values.TimeRunning = next()
+	}
+	if readFormat&PERF_FORMAT_ID != 0 {
+		values.Id = next()
+	}
+	if readFormat&PERF_FORMAT_LOST != 0 {
+		values.Lost = next()
+	}
+	return values, nil
+}
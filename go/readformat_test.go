@@ -0,0 +1,244 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"reflect"
+	"syscall"
+	"testing"
+)
+
+// readBuffer lays out "values" as the kernel returns them from a read.
+func readBuffer(values ...uint64) []byte {
+	buf := make([]byte, 8*len(values))
+	for i, v := range values {
+		nativeEndian.PutUint64(buf[8*i:], v)
+	}
+	return buf
+}
+
+const (
+	formatTimes = PERF_FORMAT_TOTAL_TIME_ENABLED | PERF_FORMAT_TOTAL_TIME_RUNNING
+	formatAll   = formatTimes | PERF_FORMAT_ID | PERF_FORMAT_LOST
+)
+
+func TestParseRead(t *testing.T) {
+	tests := []struct {
+		name       string
+		readFormat uint64
+		buf        []byte
+		want       ReadFormat
+		err        error
+	}{
+		{"value", 0, readBuffer(42), ReadFormat{Value: 42}, nil},
+		{"enabled", PERF_FORMAT_TOTAL_TIME_ENABLED, readBuffer(42, 100),
+			ReadFormat{Value: 42, TimeEnabled: 100}, nil},
+		{"running", PERF_FORMAT_TOTAL_TIME_RUNNING, readBuffer(42, 75),
+			ReadFormat{Value: 42, TimeRunning: 75}, nil},
+		{"times", formatTimes, readBuffer(42, 100, 75),
+			ReadFormat{Value: 42, TimeEnabled: 100, TimeRunning: 75}, nil},
+		{"id", PERF_FORMAT_ID, readBuffer(42, 7),
+			ReadFormat{Value: 42, Id: 7}, nil},
+		{"lost", PERF_FORMAT_LOST, readBuffer(42, 3),
+			ReadFormat{Value: 42, Lost: 3}, nil},
+		{"id and lost", PERF_FORMAT_ID | PERF_FORMAT_LOST, readBuffer(42, 7, 3),
+			ReadFormat{Value: 42, Id: 7, Lost: 3}, nil},
+		{"all", formatAll, readBuffer(42, 100, 75, 7, 3),
+			ReadFormat{Value: 42, TimeEnabled: 100, TimeRunning: 75, Id: 7, Lost: 3}, nil},
+		{"longer", 0, readBuffer(42, 1), ReadFormat{Value: 42}, nil},
+		{"empty", 0, nil, ReadFormat{}, PerfShortRead},
+		{"short", formatTimes, readBuffer(42, 100), ReadFormat{}, PerfShortRead},
+		{"short lost", formatAll, readBuffer(42, 100, 75, 7), ReadFormat{}, PerfShortRead},
+		{"unaligned", 0, readBuffer(42)[:7], ReadFormat{}, PerfShortRead},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRead(tt.buf, tt.readFormat)
+			if err != tt.err {
+				t.Fatalf("ParseRead() error = %v, want %v", err, tt.err)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("ParseRead() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := ParseRead(readBuffer(1, 42), PERF_FORMAT_GROUP); err == nil {
+		t.Error("ParseRead() with PERF_FORMAT_GROUP: no error")
+	}
+}
+
+func TestParseGroupRead(t *testing.T) {
+	tests := []struct {
+		name       string
+		readFormat uint64
+		buf        []byte
+		want       GroupReadFormat
+		err        error
+	}{
+		{"values", 0, readBuffer(2, 42, 43),
+			GroupReadFormat{Nr: 2, Values: []GroupReadValue{{Value: 42}, {Value: 43}}}, nil},
+		{"times", formatTimes, readBuffer(2, 100, 75, 42, 43),
+			GroupReadFormat{Nr: 2, TimeEnabled: 100, TimeRunning: 75,
+				Values: []GroupReadValue{{Value: 42}, {Value: 43}}}, nil},
+		{"enabled", PERF_FORMAT_TOTAL_TIME_ENABLED, readBuffer(1, 100, 42),
+			GroupReadFormat{Nr: 1, TimeEnabled: 100, Values: []GroupReadValue{{Value: 42}}}, nil},
+		{"id", PERF_FORMAT_ID, readBuffer(2, 42, 7, 43, 8),
+			GroupReadFormat{Nr: 2, Values: []GroupReadValue{{Value: 42, Id: 7}, {Value: 43, Id: 8}}}, nil},
+		{"times and id", formatTimes | PERF_FORMAT_ID, readBuffer(2, 100, 75, 42, 7, 43, 8),
+			GroupReadFormat{Nr: 2, TimeEnabled: 100, TimeRunning: 75,
+				Values: []GroupReadValue{{Value: 42, Id: 7}, {Value: 43, Id: 8}}}, nil},
+		{"lost", PERF_FORMAT_LOST, readBuffer(2, 42, 3, 43, 4),
+			GroupReadFormat{Nr: 2, Values: []GroupReadValue{{Value: 42, Lost: 3}, {Value: 43, Lost: 4}}}, nil},
+		{"all", formatAll, readBuffer(2, 100, 75, 42, 7, 3, 43, 8, 4),
+			GroupReadFormat{Nr: 2, TimeEnabled: 100, TimeRunning: 75,
+				Values: []GroupReadValue{{Value: 42, Id: 7, Lost: 3}, {Value: 43, Id: 8, Lost: 4}}}, nil},
+		{"no event", formatTimes, readBuffer(0, 100, 75),
+			GroupReadFormat{Nr: 0, TimeEnabled: 100, TimeRunning: 75, Values: []GroupReadValue{}}, nil},
+		{"empty", 0, nil, GroupReadFormat{}, PerfShortRead},
+		{"short times", formatTimes, readBuffer(1, 100), GroupReadFormat{}, PerfShortRead},
+		{"short values", PERF_FORMAT_ID, readBuffer(2, 42, 7, 43), GroupReadFormat{}, PerfShortRead},
+		{"short lost", PERF_FORMAT_LOST, readBuffer(1, 42), GroupReadFormat{}, PerfShortRead},
+		{"huge nr", 0, readBuffer(1<<62, 42), GroupReadFormat{}, PerfShortRead},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseGroupRead(tt.buf, tt.readFormat|PERF_FORMAT_GROUP)
+			if err != tt.err {
+				t.Fatalf("ParseGroupRead() error = %v, want %v", err, tt.err)
+			}
+			if err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseGroupRead() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := ParseGroupRead(readBuffer(42), 0); err == nil {
+		t.Error("ParseGroupRead() without PERF_FORMAT_GROUP: no error")
+	}
+}
+
+func TestGroupReadValues(t *testing.T) {
+	group, err := ParseGroupRead(readBuffer(2, 100, 75, 42, 7, 3, 43, 8, 4), formatAll|PERF_FORMAT_GROUP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ReadFormat{Value: 43, TimeEnabled: 100, TimeRunning: 75, Id: 8, Lost: 4}
+	if got := group.values(1); got != want {
+		t.Errorf("values(1) = %+v, want %+v", got, want)
+	}
+}
+
+func TestReadSize(t *testing.T) {
+	tests := []struct {
+		readFormat uint64
+		want       int
+	}{
+		{0, 8},
+		{PERF_FORMAT_TOTAL_TIME_ENABLED, 16},
+		{formatTimes, 24},
+		{formatTimes | PERF_FORMAT_ID, 32},
+		{formatAll, 40},
+		{PERF_FORMAT_LOST, 16},
+		{PERF_FORMAT_GROUP, 8},
+	}
+	for _, tt := range tests {
+		if got := readSize(tt.readFormat); got != tt.want {
+			t.Errorf("readSize(%#x) = %d, want %d", tt.readFormat, got, tt.want)
+		}
+	}
+}
+
+func TestParseKernelRelease(t *testing.T) {
+	tests := []struct {
+		release      string
+		major, minor int
+		ok           bool
+	}{
+		{"6.1.0-13-amd64", 6, 1, true},
+		{"5.15.0", 5, 15, true},
+		{"4.19", 4, 19, true},
+		{"6.0-rc1", 6, 0, true},
+		{"5.4.0+", 5, 4, true},
+		{"6", 0, 0, false},
+		{"", 0, 0, false},
+		{"x.y.z", 0, 0, false},
+	}
+	for _, tt := range tests {
+		major, minor, ok := parseKernelRelease(tt.release)
+		if major != tt.major || minor != tt.minor || ok != tt.ok {
+			t.Errorf("parseKernelRelease(%q) = %d, %d, %v, want %d, %d, %v",
+				tt.release, major, minor, ok, tt.major, tt.minor, tt.ok)
+		}
+	}
+}
+
+func TestReadFormatLost(t *testing.T) {
+	opts := EventOptions{ReadFormat: PERF_FORMAT_LOST | PERF_FORMAT_ID}
+	events := openOrSkip(t, "task-clock,{task-clock,page-faults}", opts)
+	defer EventsDisableClose(events)
+
+	if err := EventsRead(events); err != nil {
+		t.Fatal(err)
+	}
+	for _, event := range events {
+		if !formatLostSupported() {
+			if event.ReadFormat&PERF_FORMAT_LOST != 0 {
+				t.Errorf("%s: PERF_FORMAT_LOST kept before Linux 6.0", event.EventName)
+			}
+			continue
+		}
+		if event.ReadFormat&PERF_FORMAT_LOST == 0 {
+			t.Errorf("%s: PERF_FORMAT_LOST dropped", event.EventName)
+		}
+		if event.Lost != 0 {
+			t.Errorf("%s: Lost = %d for a counting event, want 0", event.EventName, event.Lost)
+		}
+	}
+	if events[0].Data == 0 {
+		t.Error("task-clock didn't count")
+	}
+}
+
+func TestRead32(t *testing.T) {
+	var p [2]int
+	if err := syscall.Pipe2(p[:], syscall.O_CLOEXEC); err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(p[0])
+	defer syscall.Close(p[1])
+
+	tests := []struct {
+		name  string
+		value uint64
+		want  uint64
+	}{
+		{"no flags", 42, 42},
+		{"top bit", 1<<63 | 42, 42},
+		{"flags", 0xdead0000<<32 | 42, 42},
+		{"all bits", 0xffffffffffffffff, 0xffffffff},
+		{"low bits", 0xffffffff, 0xffffffff},
+	}
+	for _, tt := range tests {
+		for _, read32 := range []bool{true, false} {
+			// ReadEvent keeps the flags, and the times are read
+			// whole either way.
+			if _, err := syscall.Write(p[1], readBuffer(tt.value, 1<<40, 1<<40)); err != nil {
+				t.Fatal(err)
+			}
+			event := PerfEventInfo{Fd: p[0], ReadFormat: formatTimes}
+			read, want := event.ReadEvent, tt.value
+			if read32 {
+				read, want = event.Read32, tt.want
+			}
+			if err := read(); err != nil {
+				t.Fatalf("%s: read32 %v: %v", tt.name, read32, err)
+			}
+			if event.Data != want || event.TimeEnabled != 1<<40 || event.TimeRunning != 1<<40 {
+				t.Errorf("%s: read32 %v: Data %#x, times %d, %d, want %#x, %d", tt.name, read32,
+					event.Data, event.TimeEnabled, event.TimeRunning, want, uint64(1<<40))
+			}
+		}
+	}
+}
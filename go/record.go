@@ -0,0 +1,133 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"errors"
+)
+
+var PerfUnknownRecord = errors.New("record type not supported for decoding")
+
+// Bits of PerfEventHeader.Misc set on the PERF_RECORD_SWITCH and
+// PERF_RECORD_SWITCH_CPU_WIDE records (from linux/perf_event.h)
+const (
+	PERF_RECORD_MISC_SWITCH_OUT         = 1 << 13
+	PERF_RECORD_MISC_SWITCH_OUT_PREEMPT = 1 << 14
+)
+
+// Record is a decoded record of the ring buffer of an event, as returned
+// by DecodeRecord. Its concrete type tells its kind, e.g. :
+//
+//	switch rec := rec.(type) {
+//	case SampleRecord:
+//		...
+//	case ForkRecord:
+//		...
+//	}
+type Record interface {
+	// RecordType returns the PERF_RECORD_* type of the record.
+	RecordType() uint32
+}
+
+// ForkRecord is a decoded PERF_RECORD_FORK record.
+type ForkRecord struct {
+	TaskRecord
+}
+
+// ExitRecord is a decoded PERF_RECORD_EXIT record.
+type ExitRecord struct {
+	TaskRecord
+}
+
+// UnthrottleRecord is a decoded PERF_RECORD_UNTHROTTLE record.
+type UnthrottleRecord struct {
+	ThrottleRecord
+}
+
+// LostRecord is a decoded PERF_RECORD_LOST record, telling that the
+// kernel dropped Lost records of the event Id, the ring buffer being
+// full.
+type LostRecord struct {
+	Id   uint64
+	Lost uint64
+}
+
+// SwitchRecord is a decoded PERF_RECORD_SWITCH or
+// PERF_RECORD_SWITCH_CPU_WIDE record, telling that the sampled thread was
+// switched in or out of its CPU.
+// Out : the thread was switched out, rather than in.
+// Preempt : the thread was switched out while still runnable.
+// CPUWide : the record is of an event counting a CPU, NextPrevPid and
+// NextPrevTid being the next thread switched in when switching out, the
+// previous one when switching in.
+type SwitchRecord struct {
+	Out         bool
+	Preempt     bool
+	CPUWide     bool
+	NextPrevPid uint32
+	NextPrevTid uint32
+}
+
+func (SampleRecord) RecordType() uint32     { return PERF_RECORD_SAMPLE }
+func (Mmap2Record) RecordType() uint32      { return PERF_RECORD_MMAP2 }
+func (CommRecord) RecordType() uint32       { return PERF_RECORD_COMM }
+func (ForkRecord) RecordType() uint32       { return PERF_RECORD_FORK }
+func (ExitRecord) RecordType() uint32       { return PERF_RECORD_EXIT }
+func (ThrottleRecord) RecordType() uint32   { return PERF_RECORD_THROTTLE }
+func (UnthrottleRecord) RecordType() uint32 { return PERF_RECORD_UNTHROTTLE }
+func (LostRecord) RecordType() uint32       { return PERF_RECORD_LOST }
+
+func (rec SwitchRecord) RecordType() uint32 {
+	if rec.CPUWide {
+		return PERF_RECORD_SWITCH_CPU_WIDE
+	}
+	return PERF_RECORD_SWITCH
+}
+
+// DecodeRecord decodes the body "payload" of a record, i.e., what follows
+// its perf_event_header "header", of an event opened with the attributes
+// "eventAttr", into the concrete type of its kind, e.g. SampleRecord for
+// PERF_RECORD_SAMPLE. The kinds of records which can't be decoded yet
+// return PerfUnknownRecord.
+func DecodeRecord(header PerfEventHeader, payload []byte, eventAttr PerfEventAttr) (Record, error) {
+	switch header.Type {
+	case PERF_RECORD_SAMPLE:
+		return DecodeSample(payload, eventAttr)
+	case PERF_RECORD_MMAP2:
+		return DecodeMmap2Record(payload)
+	case PERF_RECORD_COMM:
+		return DecodeCommRecord(header, payload)
+	case PERF_RECORD_FORK:
+		rec, err := DecodeTaskRecord(payload)
+		return ForkRecord{rec}, err
+	case PERF_RECORD_EXIT:
+		rec, err := DecodeTaskRecord(payload)
+		return ExitRecord{rec}, err
+	case PERF_RECORD_THROTTLE:
+		return DecodeThrottleRecord(payload)
+	case PERF_RECORD_UNTHROTTLE:
+		rec, err := DecodeThrottleRecord(payload)
+		return UnthrottleRecord{rec}, err
+	case PERF_RECORD_LOST:
+		var rec LostRecord
+		d := &recordDecoder{buf: payload}
+		rec.Id = d.u64()
+		rec.Lost = d.u64()
+		return rec, d.err
+	case PERF_RECORD_SWITCH, PERF_RECORD_SWITCH_CPU_WIDE:
+		rec := SwitchRecord{
+			Out:     header.Misc&PERF_RECORD_MISC_SWITCH_OUT != 0,
+			Preempt: header.Misc&PERF_RECORD_MISC_SWITCH_OUT_PREEMPT != 0,
+			CPUWide: header.Type == PERF_RECORD_SWITCH_CPU_WIDE,
+		}
+		if !rec.CPUWide {
+			return rec, nil
+		}
+		d := &recordDecoder{buf: payload}
+		rec.NextPrevPid = d.u32()
+		rec.NextPrevTid = d.u32()
+		return rec, d.err
+	}
+	return nil, PerfUnknownRecord
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecodeRecord(t *testing.T) {
+	eventAttr := sampleAttr(PERF_SAMPLE_IP | PERF_SAMPLE_TID)
+	task := new(recordBuilder).u32(10, 1, 11, 1).u64(5).buf
+	taskRec := TaskRecord{Pid: 10, Ppid: 1, Tid: 11, Ptid: 1, Time: 5}
+	throttle := new(recordBuilder).u64(5, 7, 8).buf
+	throttleRec := ThrottleRecord{Time: 5, Id: 7, StreamId: 8}
+
+	tests := []struct {
+		name       string
+		header     PerfEventHeader
+		payload    []byte
+		want       Record
+		recordType uint32
+	}{
+		{"sample", PerfEventHeader{Type: PERF_RECORD_SAMPLE}, new(recordBuilder).u64(0x401000).u32(10, 11).buf,
+			SampleRecord{IP: 0x401000, Pid: 10, Tid: 11}, PERF_RECORD_SAMPLE},
+		{"comm", PerfEventHeader{Type: PERF_RECORD_COMM, Misc: PERF_RECORD_MISC_COMM_EXEC},
+			new(recordBuilder).u32(10, 11).bytes([]byte("true\x00\x00\x00\x00")).buf,
+			CommRecord{Pid: 10, Tid: 11, Comm: "true", Exec: true}, PERF_RECORD_COMM},
+		{"fork", PerfEventHeader{Type: PERF_RECORD_FORK}, task, ForkRecord{taskRec}, PERF_RECORD_FORK},
+		{"exit", PerfEventHeader{Type: PERF_RECORD_EXIT}, task, ExitRecord{taskRec}, PERF_RECORD_EXIT},
+		{"throttle", PerfEventHeader{Type: PERF_RECORD_THROTTLE}, throttle, throttleRec, PERF_RECORD_THROTTLE},
+		{"unthrottle", PerfEventHeader{Type: PERF_RECORD_UNTHROTTLE}, throttle, UnthrottleRecord{throttleRec}, PERF_RECORD_UNTHROTTLE},
+		{"lost", PerfEventHeader{Type: PERF_RECORD_LOST}, new(recordBuilder).u64(7, 42).buf,
+			LostRecord{Id: 7, Lost: 42}, PERF_RECORD_LOST},
+		{"switch in", PerfEventHeader{Type: PERF_RECORD_SWITCH}, nil, SwitchRecord{}, PERF_RECORD_SWITCH},
+		{"switch out", PerfEventHeader{Type: PERF_RECORD_SWITCH, Misc: PERF_RECORD_MISC_SWITCH_OUT}, nil,
+			SwitchRecord{Out: true}, PERF_RECORD_SWITCH},
+		{"preempted", PerfEventHeader{Type: PERF_RECORD_SWITCH,
+			Misc: PERF_RECORD_MISC_SWITCH_OUT | PERF_RECORD_MISC_SWITCH_OUT_PREEMPT}, nil,
+			SwitchRecord{Out: true, Preempt: true}, PERF_RECORD_SWITCH},
+		{"switch cpu wide", PerfEventHeader{Type: PERF_RECORD_SWITCH_CPU_WIDE, Misc: PERF_RECORD_MISC_SWITCH_OUT},
+			new(recordBuilder).u32(20, 21).buf,
+			SwitchRecord{Out: true, CPUWide: true, NextPrevPid: 20, NextPrevTid: 21}, PERF_RECORD_SWITCH_CPU_WIDE},
+	}
+	for _, tt := range tests {
+		rec, err := DecodeRecord(tt.header, tt.payload, eventAttr)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(rec, tt.want) {
+			t.Errorf("%s: DecodeRecord() = %#v, want %#v", tt.name, rec, tt.want)
+		}
+		if rec.RecordType() != tt.recordType {
+			t.Errorf("%s: RecordType() = %d, want %d", tt.name, rec.RecordType(), tt.recordType)
+		}
+	}
+
+	mmap2 := new(recordBuilder).u32(1, 2).u64(0x400000, 0x1000, 0).u32(8, 1).u64(1, 1).u32(5, 2).
+		bytes([]byte("/bin/true\x00\x00\x00\x00\x00\x00\x00")).buf
+	rec, err := DecodeRecord(PerfEventHeader{Type: PERF_RECORD_MMAP2}, mmap2, eventAttr)
+	if mmap, ok := rec.(Mmap2Record); err != nil || !ok || mmap.Filename != "/bin/true" {
+		t.Errorf("DecodeRecord() of an MMAP2 record = %#v, %v", rec, err)
+	}
+}
+
+func TestDecodeRecordErrors(t *testing.T) {
+	eventAttr := sampleAttr(PERF_SAMPLE_IP)
+	for _, recordType := range []uint32{PERF_RECORD_MMAP, PERF_RECORD_READ, 100} {
+		if _, err := DecodeRecord(PerfEventHeader{Type: recordType}, make([]byte, 64), eventAttr); err != PerfUnknownRecord {
+			t.Errorf("DecodeRecord() of type %d = %v, want %v", recordType, err, PerfUnknownRecord)
+		}
+	}
+	for _, recordType := range []uint32{PERF_RECORD_SAMPLE, PERF_RECORD_FORK, PERF_RECORD_LOST, PERF_RECORD_SWITCH_CPU_WIDE} {
+		if _, err := DecodeRecord(PerfEventHeader{Type: recordType}, make([]byte, 4), eventAttr); err != PerfShortRecord {
+			t.Errorf("DecodeRecord() of a short record of type %d = %v, want %v", recordType, err, PerfShortRecord)
+		}
+	}
+}
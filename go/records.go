@@ -0,0 +1,295 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"bytes"
+)
+
+// Types of the records a sampling event writes into its ring buffer
+// (from linux/perf_event.h)
+const (
+	PERF_RECORD_MMAP            = 1
+	PERF_RECORD_LOST            = 2
+	PERF_RECORD_COMM            = 3
+	PERF_RECORD_EXIT            = 4
+	PERF_RECORD_THROTTLE        = 5
+	PERF_RECORD_UNTHROTTLE      = 6
+	PERF_RECORD_FORK            = 7
+	PERF_RECORD_READ            = 8
+	PERF_RECORD_SAMPLE          = 9
+	PERF_RECORD_MMAP2           = 10
+	PERF_RECORD_SWITCH          = 14
+	PERF_RECORD_SWITCH_CPU_WIDE = 15
+)
+
+// PerfEventHeader is the header starting every record.
+// Type : PERF_RECORD_* type of the record.
+// Misc : additional information on the record.
+// Size : size of the record, header included.
+type PerfEventHeader struct {
+	Type uint32
+	Misc uint16
+	Size uint16
+}
+
+// Size of the perf_event_header.
+const perfEventHeaderSize = 8
+
+// DecodeRecordHeader decodes the header at the start of "buf".
+func DecodeRecordHeader(buf []byte) (PerfEventHeader, error) {
+	var header PerfEventHeader
+	if len(buf) < perfEventHeaderSize {
+		return header, PerfShortRecord
+	}
+	header.Type = nativeEndian.Uint32(buf)
+	header.Misc = nativeEndian.Uint16(buf[4:])
+	header.Size = nativeEndian.Uint16(buf[6:])
+	return header, nil
+}
+
+// cString reads a NUL terminated string padded to 8 bytes.
+func (d *recordDecoder) cString() string {
+	if d.err != nil {
+		return ""
+	}
+	rest := d.buf[d.off:]
+	end := bytes.IndexByte(rest, 0)
+	if end < 0 {
+		d.err = PerfShortRecord
+		return ""
+	}
+	padded := (end + 8) &^ 7
+	if padded > len(rest) {
+		padded = len(rest)
+	}
+	d.off += padded
+	return string(rest[:end])
+}
+
+// Mmap2Record is a decoded PERF_RECORD_MMAP2 record, telling that the
+// range [Addr, Addr+Len) of the process has been mapped to Filename, at
+// the offset Pgoff.
+type Mmap2Record struct {
+	Pid           uint32
+	Tid           uint32
+	Addr          uint64
+	Len           uint64
+	Pgoff         uint64
+	Maj           uint32
+	Min           uint32
+	Ino           uint64
+	InoGeneration uint64
+	Prot          uint32
+	Flags         uint32
+	Filename      string
+}
+
+// DecodeMmap2Record decodes the body of a PERF_RECORD_MMAP2 record,
+// i.e., what follows the perf_event_header.
+func DecodeMmap2Record(buf []byte) (Mmap2Record, error) {
+	var rec Mmap2Record
+	d := &recordDecoder{buf: buf}
+	rec.Pid = d.u32()
+	rec.Tid = d.u32()
+	rec.Addr = d.u64()
+	rec.Len = d.u64()
+	rec.Pgoff = d.u64()
+	rec.Maj = d.u32()
+	rec.Min = d.u32()
+	rec.Ino = d.u64()
+	rec.InoGeneration = d.u64()
+	rec.Prot = d.u32()
+	rec.Flags = d.u32()
+	rec.Filename = d.cString()
+	return rec, d.err
+}
+
+// ScanRecords walks the consecutive records of "buf", e.g. the data
+// drained from the ring buffer of a sampling event, calling "fn" with the
+// header and the body of each record. It stops at the first error of "fn".
+func ScanRecords(buf []byte, fn func(header PerfEventHeader, body []byte) error) error {
+	for len(buf) != 0 {
+		header, err := DecodeRecordHeader(buf)
+		if err != nil {
+			return err
+		}
+		if int(header.Size) < perfEventHeaderSize || int(header.Size) > len(buf) {
+			return PerfShortRecord
+		}
+		err = fn(header, buf[perfEventHeaderSize:header.Size])
+		if err != nil {
+			return err
+		}
+		buf = buf[header.Size:]
+	}
+	return nil
+}
+
+// ThrottleRecord is a decoded PERF_RECORD_THROTTLE or
+// PERF_RECORD_UNTHROTTLE record, telling that the kernel stopped or
+// resumed sampling an event because it was sampling too fast.
+type ThrottleRecord struct {
+	Time     uint64
+	Id       uint64
+	StreamId uint64
+}
+
+// DecodeThrottleRecord decodes the body of a PERF_RECORD_THROTTLE or
+// PERF_RECORD_UNTHROTTLE record.
+func DecodeThrottleRecord(buf []byte) (ThrottleRecord, error) {
+	var rec ThrottleRecord
+	d := &recordDecoder{buf: buf}
+	rec.Time = d.u64()
+	rec.Id = d.u64()
+	rec.StreamId = d.u64()
+	return rec, d.err
+}
+
+// RecordCounts is the number of records of each kind found while
+// draining a ring buffer.
+type RecordCounts struct {
+	Samples     uint64
+	Throttles   uint64
+	Unthrottles uint64
+	Lost        uint64
+	Other       uint64
+}
+
+// CountRecords counts the records of "buf" by kind. A non zero Throttles
+// count tells that the kernel throttled the sampling, making the
+// effective sample rate lower than the requested one.
+func CountRecords(buf []byte) (RecordCounts, error) {
+	var counts RecordCounts
+	err := ScanRecords(buf, func(header PerfEventHeader, body []byte) error {
+		switch header.Type {
+		case PERF_RECORD_SAMPLE:
+			counts.Samples++
+		case PERF_RECORD_THROTTLE:
+			counts.Throttles++
+		case PERF_RECORD_UNTHROTTLE:
+			counts.Unthrottles++
+		case PERF_RECORD_LOST:
+			counts.Lost++
+		default:
+			counts.Other++
+		}
+		return nil
+	})
+	return counts, err
+}
+
+// Bit of PerfEventHeader.Misc set on the PERF_RECORD_COMM records
+// emitted on exec (from linux/perf_event.h)
+const PERF_RECORD_MISC_COMM_EXEC = 1 << 13
+
+// CommRecord is a decoded PERF_RECORD_COMM record, telling that the
+// thread Tid of the process Pid is now named Comm.
+// Exec : whether the name changed because the process called exec.
+type CommRecord struct {
+	Pid  uint32
+	Tid  uint32
+	Comm string
+	Exec bool
+}
+
+// DecodeCommRecord decodes the body of a PERF_RECORD_COMM record, i.e.,
+// what follows the perf_event_header "header".
+func DecodeCommRecord(header PerfEventHeader, buf []byte) (CommRecord, error) {
+	var rec CommRecord
+	d := &recordDecoder{buf: buf}
+	rec.Pid = d.u32()
+	rec.Tid = d.u32()
+	rec.Comm = d.cString()
+	rec.Exec = header.Misc&PERF_RECORD_MISC_COMM_EXEC != 0
+	return rec, d.err
+}
+
+// TaskRecord is a decoded PERF_RECORD_FORK or PERF_RECORD_EXIT record,
+// telling that the thread Tid of the process Pid has been created by the
+// thread Ptid of the process Ppid, or has exited, at Time (in the clock
+// of the event).
+type TaskRecord struct {
+	Pid  uint32
+	Ppid uint32
+	Tid  uint32
+	Ptid uint32
+	Time uint64
+}
+
+// DecodeTaskRecord decodes the body of a PERF_RECORD_FORK or
+// PERF_RECORD_EXIT record, i.e., what follows the perf_event_header.
+func DecodeTaskRecord(buf []byte) (TaskRecord, error) {
+	var rec TaskRecord
+	d := &recordDecoder{buf: buf}
+	rec.Pid = d.u32()
+	rec.Ppid = d.u32()
+	rec.Tid = d.u32()
+	rec.Ptid = d.u32()
+	rec.Time = d.u64()
+	return rec, d.err
+}
+
+// SampleId is the sample_id trailing the records other than
+// PERF_RECORD_SAMPLE of an event sampled with SampleIdAll, telling which
+// event, thread, time and CPU a record is about. Only the fields selected
+// by the sample type of the event are set.
+type SampleId struct {
+	Pid        uint32
+	Tid        uint32
+	Time       uint64
+	Id         uint64
+	StreamId   uint64
+	Cpu        uint32
+	Identifier uint64
+}
+
+// sampleIdSize returns the size of the sample_id of the records of an
+// event sampled with the sample type "sampleType".
+func sampleIdSize(sampleType uint64) int {
+	size := 0
+	for _, bit := range []uint64{PERF_SAMPLE_TID, PERF_SAMPLE_TIME, PERF_SAMPLE_ID,
+		PERF_SAMPLE_STREAM_ID, PERF_SAMPLE_CPU, PERF_SAMPLE_IDENTIFIER} {
+		if sampleType&bit != 0 {
+			size += 8
+		}
+	}
+	return size
+}
+
+// DecodeSampleId decodes the sample_id at the end of the body of a
+// record other than PERF_RECORD_SAMPLE, i.e., what follows the
+// perf_event_header, of an event opened with the attributes "eventAttr"
+// and SampleIdAll set.
+func DecodeSampleId(buf []byte, eventAttr PerfEventAttr) (SampleId, error) {
+	var id SampleId
+	sampleType := eventAttr.Sample_type
+	size := sampleIdSize(sampleType)
+	if size > len(buf) {
+		return id, PerfShortRecord
+	}
+	d := &recordDecoder{buf: buf[len(buf)-size:]}
+
+	if sampleType&PERF_SAMPLE_TID != 0 {
+		id.Pid = d.u32()
+		id.Tid = d.u32()
+	}
+	if sampleType&PERF_SAMPLE_TIME != 0 {
+		id.Time = d.u64()
+	}
+	if sampleType&PERF_SAMPLE_ID != 0 {
+		id.Id = d.u64()
+	}
+	if sampleType&PERF_SAMPLE_STREAM_ID != 0 {
+		id.StreamId = d.u64()
+	}
+	if sampleType&PERF_SAMPLE_CPU != 0 {
+		id.Cpu = d.u32()
+		d.u32() // reserved
+	}
+	if sampleType&PERF_SAMPLE_IDENTIFIER != 0 {
+		id.Identifier = d.u64()
+	}
+	return id, d.err
+}
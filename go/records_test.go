@@ -0,0 +1,179 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"testing"
+)
+
+// record lays out a record of type "recordType" with the body "body",
+// header included.
+func record(recordType uint32, misc uint16, body []byte) []byte {
+	b := new(recordBuilder).u32(recordType)
+	b.buf = append(b.buf, 0, 0, 0, 0)
+	nativeEndian.PutUint16(b.buf[4:], misc)
+	nativeEndian.PutUint16(b.buf[6:], uint16(perfEventHeaderSize+len(body)))
+	return b.bytes(body).buf
+}
+
+func TestDecodeRecordHeader(t *testing.T) {
+	buf := record(PERF_RECORD_COMM, PERF_RECORD_MISC_COMM_EXEC, make([]byte, 16))
+	header, err := DecodeRecordHeader(buf)
+	want := PerfEventHeader{Type: PERF_RECORD_COMM, Misc: PERF_RECORD_MISC_COMM_EXEC, Size: 24}
+	if err != nil || header != want {
+		t.Errorf("DecodeRecordHeader() = %+v, %v, want %+v", header, err, want)
+	}
+	if _, err := DecodeRecordHeader(buf[:7]); err != PerfShortRecord {
+		t.Errorf("DecodeRecordHeader() of a short header = %v, want %v", err, PerfShortRecord)
+	}
+}
+
+func TestDecodeMmap2Record(t *testing.T) {
+	body := new(recordBuilder).
+		u32(100, 101).
+		u64(0x400000, 0x1000, 0).
+		u32(8, 1).
+		u64(123456, 1).
+		u32(5, 2).
+		bytes([]byte("/usr/bin/true\x00\x00\x00")).buf
+	want := Mmap2Record{
+		Pid: 100, Tid: 101,
+		Addr: 0x400000, Len: 0x1000, Pgoff: 0,
+		Maj: 8, Min: 1, Ino: 123456, InoGeneration: 1,
+		Prot: 5, Flags: 2,
+		Filename: "/usr/bin/true",
+	}
+	rec, err := DecodeMmap2Record(body)
+	if err != nil || rec != want {
+		t.Errorf("DecodeMmap2Record() = %+v, %v, want %+v", rec, err, want)
+	}
+
+	// The file name must be NUL terminated.
+	if _, err := DecodeMmap2Record(body[:len(body)-3]); err != PerfShortRecord {
+		t.Errorf("DecodeMmap2Record() of an unterminated file name = %v, want %v", err, PerfShortRecord)
+	}
+	if _, err := DecodeMmap2Record(body[:40]); err != PerfShortRecord {
+		t.Errorf("DecodeMmap2Record() of a short record = %v, want %v", err, PerfShortRecord)
+	}
+}
+
+func TestDecodeCommRecord(t *testing.T) {
+	tests := []struct {
+		name string
+		misc uint16
+		comm string
+		want CommRecord
+	}{
+		{"prctl", 0, "worker\x00\x00", CommRecord{Pid: 1, Tid: 2, Comm: "worker"}},
+		{"exec", PERF_RECORD_MISC_COMM_EXEC, "true\x00\x00\x00\x00", CommRecord{Pid: 1, Tid: 2, Comm: "true", Exec: true}},
+		// A name of 8 bytes takes another 8 for its NUL.
+		{"padded", 0, "12345678\x00\x00\x00\x00\x00\x00\x00\x00", CommRecord{Pid: 1, Tid: 2, Comm: "12345678"}},
+	}
+	for _, tt := range tests {
+		body := new(recordBuilder).u32(1, 2).bytes([]byte(tt.comm)).buf
+		header := PerfEventHeader{Type: PERF_RECORD_COMM, Misc: tt.misc}
+		rec, err := DecodeCommRecord(header, body)
+		if err != nil || rec != tt.want {
+			t.Errorf("%s: DecodeCommRecord() = %+v, %v, want %+v", tt.name, rec, err, tt.want)
+		}
+	}
+}
+
+func TestDecodeTaskRecord(t *testing.T) {
+	body := new(recordBuilder).u32(10, 1, 11, 1).u64(123456789).buf
+	want := TaskRecord{Pid: 10, Ppid: 1, Tid: 11, Ptid: 1, Time: 123456789}
+	rec, err := DecodeTaskRecord(body)
+	if err != nil || rec != want {
+		t.Errorf("DecodeTaskRecord() = %+v, %v, want %+v", rec, err, want)
+	}
+	if _, err := DecodeTaskRecord(body[:16]); err != PerfShortRecord {
+		t.Errorf("DecodeTaskRecord() of a short record = %v, want %v", err, PerfShortRecord)
+	}
+}
+
+func TestDecodeThrottleRecord(t *testing.T) {
+	body := new(recordBuilder).u64(123456789, 7, 8).buf
+	want := ThrottleRecord{Time: 123456789, Id: 7, StreamId: 8}
+	rec, err := DecodeThrottleRecord(body)
+	if err != nil || rec != want {
+		t.Errorf("DecodeThrottleRecord() = %+v, %v, want %+v", rec, err, want)
+	}
+	if _, err := DecodeThrottleRecord(body[:20]); err != PerfShortRecord {
+		t.Errorf("DecodeThrottleRecord() of a short record = %v, want %v", err, PerfShortRecord)
+	}
+}
+
+func TestScanRecords(t *testing.T) {
+	var buf []byte
+	types := []uint32{PERF_RECORD_SAMPLE, PERF_RECORD_SAMPLE, PERF_RECORD_THROTTLE, PERF_RECORD_UNTHROTTLE,
+		PERF_RECORD_LOST, PERF_RECORD_COMM, PERF_RECORD_SAMPLE}
+	for i, recordType := range types {
+		buf = append(buf, record(recordType, 0, make([]byte, 8*i))...)
+	}
+
+	var scanned []uint32
+	err := ScanRecords(buf, func(header PerfEventHeader, body []byte) error {
+		if len(body) != 8*len(scanned) {
+			t.Errorf("record %d has a body of %d bytes, want %d", len(scanned), len(body), 8*len(scanned))
+		}
+		scanned = append(scanned, header.Type)
+		return nil
+	})
+	if err != nil || len(scanned) != len(types) {
+		t.Errorf("ScanRecords() = %v, scanned %v, want %v", err, scanned, types)
+	}
+
+	counts, err := CountRecords(buf)
+	want := RecordCounts{Samples: 3, Throttles: 1, Unthrottles: 1, Lost: 1, Other: 1}
+	if err != nil || counts != want {
+		t.Errorf("CountRecords() = %+v, %v, want %+v", counts, err, want)
+	}
+
+	// The errors of the callback stop the scan.
+	n := 0
+	err = ScanRecords(buf, func(header PerfEventHeader, body []byte) error {
+		n++
+		if header.Type == PERF_RECORD_THROTTLE {
+			return PerfUnknownRecord
+		}
+		return nil
+	})
+	if err != PerfUnknownRecord || n != 3 {
+		t.Errorf("ScanRecords() = %v after %d records, want %v after 3", err, n, PerfUnknownRecord)
+	}
+
+	// A record must fit in the buffer and hold its header.
+	for _, bad := range [][]byte{buf[:len(buf)-1], record(PERF_RECORD_SAMPLE, 0, nil)[:4]} {
+		if _, err := CountRecords(bad); err != PerfShortRecord {
+			t.Errorf("CountRecords() of a truncated record = %v, want %v", err, PerfShortRecord)
+		}
+	}
+	short := record(PERF_RECORD_SAMPLE, 0, nil)
+	nativeEndian.PutUint16(short[6:], 4)
+	if _, err := CountRecords(short); err != PerfShortRecord {
+		t.Errorf("CountRecords() of a record smaller than its header = %v, want %v", err, PerfShortRecord)
+	}
+}
+
+func TestDecodeSampleId(t *testing.T) {
+	eventAttr := sampleAttr(PERF_SAMPLE_IP | PERF_SAMPLE_TID | PERF_SAMPLE_TIME | PERF_SAMPLE_ID |
+		PERF_SAMPLE_STREAM_ID | PERF_SAMPLE_CPU | PERF_SAMPLE_IDENTIFIER)
+	// The sample_id follows the body of the record, here a COMM one.
+	buf := new(recordBuilder).u32(1, 2).bytes([]byte("true\x00\x00\x00\x00")).
+		u32(10, 11).u64(123456789, 7, 8).u32(3, 0).u64(99).buf
+	want := SampleId{Pid: 10, Tid: 11, Time: 123456789, Id: 7, StreamId: 8, Cpu: 3, Identifier: 99}
+	id, err := DecodeSampleId(buf, eventAttr)
+	if err != nil || id != want {
+		t.Errorf("DecodeSampleId() = %+v, %v, want %+v", id, err, want)
+	}
+
+	eventAttr = sampleAttr(PERF_SAMPLE_IP | PERF_SAMPLE_TIME)
+	id, err = DecodeSampleId(buf, eventAttr)
+	if err != nil || id != (SampleId{Time: 99}) {
+		t.Errorf("DecodeSampleId() with the time only = %+v, %v", id, err)
+	}
+	if _, err := DecodeSampleId(buf[:4], eventAttr); err != PerfShortRecord {
+		t.Errorf("DecodeSampleId() of a short record = %v, want %v", err, PerfShortRecord)
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"strings"
+	"time"
+)
+
+// EventRotation counts more hardware events than the PMU has counters
+// for, by splitting them into batches which fit, see FitEventList, and
+// counting one batch after the other, the calling thread switching to the
+// next batch on every Rotate.
+// An event only counts while its batch does, so its count is
+// extrapolated over the whole rotation. This assumes the measured code
+// behaves the same all along, e.g. a steady state loop.
+type EventRotation struct {
+	batches []string
+	current int
+	events  []PerfEventInfo
+
+	start      time.Time
+	batchStart time.Time
+	// Count and time counted of every event, the current batch aside.
+	counts    map[string]uint64
+	scheduled map[string]time.Duration
+}
+
+// NewEventRotation splits the event list "events" into batches and
+// starts counting the first one.
+func NewEventRotation(events string) (*EventRotation, error) {
+	r := &EventRotation{
+		counts:    make(map[string]uint64),
+		scheduled: make(map[string]time.Duration),
+	}
+	for rest := events; rest != ""; {
+		batch, dropped := FitEventList(rest)
+		r.batches = append(r.batches, batch)
+		rest = strings.Join(dropped, ",")
+	}
+	if len(r.batches) == 0 {
+		return nil, PerfUnsupportedEvent
+	}
+
+	r.start = clockNow()
+	err := r.open()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// open opens the current batch.
+func (r *EventRotation) open() error {
+	_, _, r.events = InitOpenEventsEnableSelf(r.batches[r.current])
+	if len(r.events) == 0 {
+		return PerfUnsupportedEvent
+	}
+	r.batchStart = clockNow()
+	return nil
+}
+
+// closeBatch reads and closes the current batch, accounting for its
+// counts.
+func (r *EventRotation) closeBatch(now time.Time) {
+	err := EventsRead(r.events)
+	if err == nil {
+		for _, event := range r.events {
+			r.counts[event.EventName] += event.Data
+			r.scheduled[event.EventName] += now.Sub(r.batchStart)
+		}
+	}
+	EventsDisableClose(r.events)
+	r.events = nil
+}
+
+// Rotate stops counting the current batch and starts counting the next.
+func (r *EventRotation) Rotate() error {
+	if len(r.batches) == 1 {
+		return nil
+	}
+	r.closeBatch(clockNow())
+	r.current = (r.current + 1) % len(r.batches)
+	return r.open()
+}
+
+// Counts returns the count of every event, extrapolated by the time of
+// the rotation over the time the event counted for.
+func (r *EventRotation) Counts() map[string]uint64 {
+	now := clockNow()
+	counts := make(map[string]uint64, len(r.counts))
+	scheduled := make(map[string]time.Duration, len(r.scheduled))
+	for name, count := range r.counts {
+		counts[name] = count
+		scheduled[name] = r.scheduled[name]
+	}
+	for i := range r.events {
+		event := &r.events[i]
+		data, err := event.Peek()
+		if err != nil {
+			continue
+		}
+		counts[event.EventName] += data
+		scheduled[event.EventName] += now.Sub(r.batchStart)
+	}
+
+	total := now.Sub(r.start)
+	for name, count := range counts {
+		counts[name] = extrapolateCount(count, scheduled[name], total)
+	}
+	return counts
+}
+
+// extrapolateCount extrapolates the count of an event which counted for
+// "scheduled" over "total".
+func extrapolateCount(count uint64, scheduled, total time.Duration) uint64 {
+	if scheduled <= 0 || scheduled >= total {
+		return count
+	}
+	return uint64(float64(count) * float64(total) / float64(scheduled))
+}
+
+// Close closes the events of the current batch.
+func (r *EventRotation) Close() {
+	EventsDisableClose(r.events)
+	r.events = nil
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestExtrapolateCount(t *testing.T) {
+	tests := []struct {
+		count            uint64
+		scheduled, total time.Duration
+		want             uint64
+	}{
+		{100, time.Second, time.Second, 100},
+		{100, time.Second, 2 * time.Second, 200},
+		{100, time.Second, 4 * time.Second, 400},
+		{300, 3 * time.Second, 4 * time.Second, 400},
+		{100, 0, time.Second, 100},
+		{100, 2 * time.Second, time.Second, 100},
+	}
+	for _, tt := range tests {
+		if got := extrapolateCount(tt.count, tt.scheduled, tt.total); got != tt.want {
+			t.Errorf("extrapolateCount(%d, %v, %v) = %d, want %d", tt.count, tt.scheduled, tt.total, got, tt.want)
+		}
+	}
+}
+
+func TestEventRotation(t *testing.T) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	c := useFakeClock(t)
+	EventsDisableClose(openOrSkip(t, "page-faults,task-clock", EventOptions{}))
+
+	// The software events fit in a single batch, which never rotates.
+	r, err := NewEventRotation("page-faults,task-clock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.batches) != 1 {
+		t.Errorf("batches %q, want 1", r.batches)
+	}
+	touchPages(16)
+	c.Advance(time.Second)
+	if err := r.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if counts := r.Counts(); counts["page-faults"] < 16 || counts["task-clock"] == 0 {
+		t.Errorf("Counts() = %v", counts)
+	}
+	r.Close()
+
+	if _, err := NewEventRotation(""); err != PerfUnsupportedEvent {
+		t.Errorf("NewEventRotation(\"\") = %v, want %v", err, PerfUnsupportedEvent)
+	}
+}
+
+// The events of a batch count half of the time of a rotation over two
+// batches, their counts are extrapolated to twice as much.
+func TestEventRotationBatches(t *testing.T) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	c := useFakeClock(t)
+	EventsDisableClose(openOrSkip(t, "page-faults,minor-faults", EventOptions{}))
+
+	r := &EventRotation{
+		batches:   []string{"page-faults", "minor-faults"},
+		counts:    make(map[string]uint64),
+		scheduled: make(map[string]time.Duration),
+		start:     clockNow(),
+	}
+	if err := r.open(); err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	touchPages(32)
+	c.Advance(time.Second)
+	if err := r.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.events) != 1 || r.events[0].EventName != "minor-faults" {
+		t.Fatalf("rotated to %+v, want minor-faults", r.events)
+	}
+	touchPages(32)
+	c.Advance(time.Second)
+
+	counts := r.Counts()
+	for _, name := range []string{"page-faults", "minor-faults"} {
+		if counts[name] < 64 || counts[name] > 256 {
+			t.Errorf("%s extrapolated to %d, want about 64", name, counts[name])
+		}
+	}
+	if r.scheduled["page-faults"] != time.Second {
+		t.Errorf("page-faults scheduled for %v, want 1s", r.scheduled["page-faults"])
+	}
+
+	// Back to the first batch.
+	if err := r.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if r.events[0].EventName != "page-faults" {
+		t.Errorf("rotated to %s, want page-faults", r.events[0].EventName)
+	}
+}
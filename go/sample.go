@@ -0,0 +1,260 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"errors"
+	"math/bits"
+)
+
+var PerfShortRecord = errors.New("record too short for its layout")
+var PerfUnsupportedSampleType = errors.New("sample type not supported for decoding")
+
+// ABI of the registers of a sample (from linux/perf_event.h)
+const (
+	PERF_SAMPLE_REGS_ABI_NONE = 0
+	PERF_SAMPLE_REGS_ABI_32   = 1
+	PERF_SAMPLE_REGS_ABI_64   = 2
+)
+
+// SampleRecord is a decoded PERF_RECORD_SAMPLE record. Only the fields
+// selected by the sample type of the event are set.
+// RegsUser holds the user registers of the mask of the event, in the
+// order of their bits, unless RegsUserABI is PERF_SAMPLE_REGS_ABI_NONE,
+// i.e., the sample was taken in a kernel thread.
+// StackUser holds the part of the user stack dump actually filled.
+// Read holds the values of the event when the sample was taken, or
+// GroupRead the values of its group if its read format has
+// PERF_FORMAT_GROUP set.
+// BranchStack holds the branches selected by the branch sample type of
+// the event, the most recent first, and BranchHwIndex the index of the
+// most recent one in the LBR, with PERF_SAMPLE_BRANCH_HW_INDEX (-1 when
+// the PMU doesn't tell).
+type SampleRecord struct {
+	Identifier    uint64
+	IP            uint64
+	Pid           uint32
+	Tid           uint32
+	Time          uint64
+	Addr          uint64
+	Id            uint64
+	StreamId      uint64
+	Cpu           uint32
+	Period        uint64
+	Read          ReadFormat
+	GroupRead     GroupReadFormat
+	Callchain     []uint64
+	Raw           []byte
+	BranchStack   []BranchEntry
+	BranchHwIndex int64
+	RegsUserABI   uint64
+	RegsUser      []uint64
+	StackUser     []byte
+	Weight        uint64
+	DataSrc       uint64
+	Transaction   uint64
+	PhysAddr      uint64
+}
+
+// recordDecoder reads the native u64/u32 values of a record in order.
+type recordDecoder struct {
+	buf []byte
+	off int
+	err error
+}
+
+func (d *recordDecoder) u64() uint64 {
+	if d.err != nil || d.off+8 > len(d.buf) {
+		d.err = PerfShortRecord
+		return 0
+	}
+	v := nativeEndian.Uint64(d.buf[d.off:])
+	d.off += 8
+	return v
+}
+
+func (d *recordDecoder) u32() uint32 {
+	if d.err != nil || d.off+4 > len(d.buf) {
+		d.err = PerfShortRecord
+		return 0
+	}
+	v := nativeEndian.Uint32(d.buf[d.off:])
+	d.off += 4
+	return v
+}
+
+func (d *recordDecoder) bytes(n uint64) []byte {
+	if d.err != nil || n > uint64(len(d.buf)-d.off) {
+		d.err = PerfShortRecord
+		return nil
+	}
+	v := d.buf[d.off : d.off+int(n)]
+	d.off += int(n)
+	return v
+}
+
+func (d *recordDecoder) u64s(n uint64) []uint64 {
+	if d.err != nil || n > uint64(len(d.buf)-d.off)/8 {
+		d.err = PerfShortRecord
+		return nil
+	}
+	v := make([]uint64, n)
+	for i := range v {
+		v[i] = d.u64()
+	}
+	return v
+}
+
+// read decodes the values of the read format "readFormat" embedded in a
+// sample.
+func (d *recordDecoder) read(sample *SampleRecord, readFormat uint64) {
+	if d.err != nil {
+		return
+	}
+	if readFormat&PERF_FORMAT_GROUP == 0 {
+		buf := d.bytes(uint64(readSize(readFormat)))
+		if d.err == nil {
+			sample.Read, d.err = ParseRead(buf, readFormat)
+		}
+		return
+	}
+
+	// The size of the group values is given by their number, which
+	// comes first.
+	if d.off+8 > len(d.buf) {
+		d.err = PerfShortRecord
+		return
+	}
+	group, err := ParseGroupRead(d.buf[d.off:], readFormat)
+	if err != nil {
+		d.err = PerfShortRecord
+		return
+	}
+	// nr and the times, then the values, each laid out as the read
+	// of a single event with the id and lost fields.
+	headerSize := readSize(readFormat &^ (PERF_FORMAT_ID | PERF_FORMAT_LOST))
+	valueSize := readSize(readFormat & (PERF_FORMAT_ID | PERF_FORMAT_LOST))
+	d.bytes(uint64(headerSize + len(group.Values)*valueSize))
+	sample.GroupRead = group
+}
+
+// DecodeSample decodes the body of a PERF_RECORD_SAMPLE record, i.e.,
+// what follows the perf_event_header, of an event opened with the
+// attributes "eventAttr". The layout of the body is given by the
+// sample_type of the event, see perf_event_open(2).
+func DecodeSample(buf []byte, eventAttr PerfEventAttr) (SampleRecord, error) {
+	var sample SampleRecord
+	sampleType := eventAttr.Sample_type
+	d := &recordDecoder{buf: buf}
+
+	if sampleType&PERF_SAMPLE_IDENTIFIER != 0 {
+		sample.Identifier = d.u64()
+	}
+	if sampleType&PERF_SAMPLE_IP != 0 {
+		sample.IP = d.u64()
+	}
+	if sampleType&PERF_SAMPLE_TID != 0 {
+		sample.Pid = d.u32()
+		sample.Tid = d.u32()
+	}
+	if sampleType&PERF_SAMPLE_TIME != 0 {
+		sample.Time = d.u64()
+	}
+	if sampleType&PERF_SAMPLE_ADDR != 0 {
+		sample.Addr = d.u64()
+	}
+	if sampleType&PERF_SAMPLE_ID != 0 {
+		sample.Id = d.u64()
+	}
+	if sampleType&PERF_SAMPLE_STREAM_ID != 0 {
+		sample.StreamId = d.u64()
+	}
+	if sampleType&PERF_SAMPLE_CPU != 0 {
+		sample.Cpu = d.u32()
+		d.u32() // reserved
+	}
+	if sampleType&PERF_SAMPLE_PERIOD != 0 {
+		sample.Period = d.u64()
+	}
+	if sampleType&PERF_SAMPLE_READ != 0 {
+		d.read(&sample, eventAttr.Read_format)
+	}
+	if sampleType&PERF_SAMPLE_CALLCHAIN != 0 {
+		sample.Callchain = d.u64s(d.u64())
+	}
+	if sampleType&PERF_SAMPLE_RAW != 0 {
+		sample.Raw = d.bytes(uint64(d.u32()))
+	}
+	if sampleType&PERF_SAMPLE_BRANCH_STACK != 0 {
+		d.branchStack(&sample, eventAttr.Branch_sample_type)
+	}
+	if sampleType&PERF_SAMPLE_REGS_USER != 0 {
+		sample.RegsUserABI = d.u64()
+		if sample.RegsUserABI != PERF_SAMPLE_REGS_ABI_NONE {
+			n := bits.OnesCount64(eventAttr.Sample_regs_user)
+			sample.RegsUser = d.u64s(uint64(n))
+		}
+	}
+	if sampleType&PERF_SAMPLE_STACK_USER != 0 {
+		stack := d.bytes(d.u64())
+		if len(stack) != 0 {
+			dynSize := d.u64()
+			if dynSize <= uint64(len(stack)) {
+				stack = stack[:dynSize]
+			}
+		}
+		sample.StackUser = stack
+	}
+	if sampleType&PERF_SAMPLE_WEIGHT != 0 {
+		sample.Weight = d.u64()
+	}
+	if sampleType&PERF_SAMPLE_DATA_SRC != 0 {
+		sample.DataSrc = d.u64()
+	}
+	if sampleType&PERF_SAMPLE_TRANSACTION != 0 {
+		sample.Transaction = d.u64()
+	}
+	if sampleType&PERF_SAMPLE_REGS_INTR != 0 {
+		return sample, PerfUnsupportedSampleType
+	}
+	if sampleType&PERF_SAMPLE_PHYS_ADDR != 0 {
+		sample.PhysAddr = d.u64()
+	}
+	return sample, d.err
+}
+
+// Values of the MemDataSource.Op field (from linux/perf_event.h)
+const (
+	PERF_MEM_OP_NA     = 0x01
+	PERF_MEM_OP_LOAD   = 0x02
+	PERF_MEM_OP_STORE  = 0x04
+	PERF_MEM_OP_PFETCH = 0x08
+	PERF_MEM_OP_EXEC   = 0x10
+)
+
+// MemDataSource is the decoded data_src of a memory access sample, each
+// field being a bit mask of the PERF_MEM_* values of linux/perf_event.h
+// Op : type of the access (load, store...)
+// Lvl : memory hierarchy level hit or missed
+// Snoop : snoop mode
+// Lock : whether the access was locked
+// Dtlb : TLB access hit or missed
+type MemDataSource struct {
+	Op    uint64
+	Lvl   uint64
+	Snoop uint64
+	Lock  uint64
+	Dtlb  uint64
+}
+
+// DecodeDataSource decodes the data_src of a memory access sample.
+func DecodeDataSource(dataSrc uint64) MemDataSource {
+	return MemDataSource{
+		Op:    dataSrc & 0x1f,
+		Lvl:   (dataSrc >> 5) & 0x3fff,
+		Snoop: (dataSrc >> 19) & 0x1f,
+		Lock:  (dataSrc >> 24) & 0x3,
+		Dtlb:  (dataSrc >> 26) & 0x7f,
+	}
+}
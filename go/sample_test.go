@@ -0,0 +1,195 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"reflect"
+	"testing"
+)
+
+// recordBuilder lays out the fields of a record body as the kernel
+// writes them in the ring buffer.
+type recordBuilder struct {
+	buf []byte
+}
+
+func (b *recordBuilder) u64(values ...uint64) *recordBuilder {
+	for _, v := range values {
+		b.buf = append(b.buf, make([]byte, 8)...)
+		nativeEndian.PutUint64(b.buf[len(b.buf)-8:], v)
+	}
+	return b
+}
+
+func (b *recordBuilder) u32(values ...uint32) *recordBuilder {
+	for _, v := range values {
+		b.buf = append(b.buf, make([]byte, 4)...)
+		nativeEndian.PutUint32(b.buf[len(b.buf)-4:], v)
+	}
+	return b
+}
+
+func (b *recordBuilder) bytes(p []byte) *recordBuilder {
+	b.buf = append(b.buf, p...)
+	return b
+}
+
+// sampleAttr returns the attributes of an event sampling "sampleType".
+func sampleAttr(sampleType uint64) PerfEventAttr {
+	eventAttr := setupPerfEventAttr(EventConfigType{PERF_TYPE_SOFTWARE, PERF_COUNT_SW_CPU_CLOCK})
+	eventAttr.Sample = 1000
+	eventAttr.Sample_type = sampleType
+	return eventAttr
+}
+
+func TestDecodeSample(t *testing.T) {
+	sampleType := uint64(PERF_SAMPLE_IDENTIFIER | PERF_SAMPLE_IP | PERF_SAMPLE_TID | PERF_SAMPLE_TIME |
+		PERF_SAMPLE_ADDR | PERF_SAMPLE_ID | PERF_SAMPLE_STREAM_ID | PERF_SAMPLE_CPU | PERF_SAMPLE_PERIOD |
+		PERF_SAMPLE_CALLCHAIN | PERF_SAMPLE_RAW | PERF_SAMPLE_WEIGHT | PERF_SAMPLE_DATA_SRC |
+		PERF_SAMPLE_TRANSACTION | PERF_SAMPLE_PHYS_ADDR)
+	b := new(recordBuilder).
+		u64(99, 0x401000).
+		u32(10, 11).
+		u64(123456789, 0xdead, 7, 8).
+		u32(3, 0).
+		u64(1000).
+		u64(3, PERF_CONTEXT_USER, 0x401000, 0x402000).
+		u32(4).bytes([]byte{1, 2, 3, 4}).
+		u64(50, 0x1234, 5, 0xbeef)
+	want := SampleRecord{
+		Identifier:  99,
+		IP:          0x401000,
+		Pid:         10,
+		Tid:         11,
+		Time:        123456789,
+		Addr:        0xdead,
+		Id:          7,
+		StreamId:    8,
+		Cpu:         3,
+		Period:      1000,
+		Callchain:   []uint64{PERF_CONTEXT_USER, 0x401000, 0x402000},
+		Raw:         []byte{1, 2, 3, 4},
+		Weight:      50,
+		DataSrc:     0x1234,
+		Transaction: 5,
+		PhysAddr:    0xbeef,
+	}
+	sample, err := DecodeSample(b.buf, sampleAttr(sampleType))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(sample, want) {
+		t.Errorf("DecodeSample() = %+v, want %+v", sample, want)
+	}
+
+	// Every field is needed.
+	for n := 0; n < len(b.buf); n += 4 {
+		if _, err := DecodeSample(b.buf[:n], sampleAttr(sampleType)); err != PerfShortRecord {
+			t.Errorf("DecodeSample() of %d bytes = %v, want %v", n, err, PerfShortRecord)
+		}
+	}
+}
+
+func TestDecodeSampleRead(t *testing.T) {
+	eventAttr := sampleAttr(PERF_SAMPLE_IP | PERF_SAMPLE_READ | PERF_SAMPLE_PERIOD)
+	eventAttr.Read_format = formatTimes | PERF_FORMAT_ID
+	b := new(recordBuilder).u64(0x401000, 1000, 42, 100, 75, 7)
+	sample, err := DecodeSample(b.buf, eventAttr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ReadFormat{Value: 42, TimeEnabled: 100, TimeRunning: 75, Id: 7}
+	if sample.Read != want || sample.Period != 1000 {
+		t.Errorf("DecodeSample() read %+v, period %d, want %+v, 1000", sample.Read, sample.Period, want)
+	}
+	if _, err := DecodeSample(b.buf[:40], eventAttr); err != PerfShortRecord {
+		t.Errorf("DecodeSample() of a short read = %v, want %v", err, PerfShortRecord)
+	}
+
+	// The values of the group are followed by the other fields.
+	eventAttr = sampleAttr(PERF_SAMPLE_READ | PERF_SAMPLE_CALLCHAIN)
+	eventAttr.Read_format = PERF_FORMAT_GROUP | PERF_FORMAT_TOTAL_TIME_ENABLED | PERF_FORMAT_ID | PERF_FORMAT_LOST
+	b = new(recordBuilder).u64(2, 100, 42, 7, 0, 43, 8, 1).u64(1, 0x401000)
+	sample, err = DecodeSample(b.buf, eventAttr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantGroup := GroupReadFormat{
+		Nr:          2,
+		TimeEnabled: 100,
+		Values:      []GroupReadValue{{Value: 42, Id: 7}, {Value: 43, Id: 8, Lost: 1}},
+	}
+	if !reflect.DeepEqual(sample.GroupRead, wantGroup) {
+		t.Errorf("DecodeSample() group read %+v, want %+v", sample.GroupRead, wantGroup)
+	}
+	if !reflect.DeepEqual(sample.Callchain, []uint64{0x401000}) {
+		t.Errorf("DecodeSample() callchain %#x after the group read", sample.Callchain)
+	}
+	if _, err := DecodeSample(b.buf[:48], eventAttr); err != PerfShortRecord {
+		t.Errorf("DecodeSample() of a short group read = %v, want %v", err, PerfShortRecord)
+	}
+}
+
+func TestDecodeSampleUser(t *testing.T) {
+	eventAttr := sampleAttr(PERF_SAMPLE_REGS_USER | PERF_SAMPLE_STACK_USER)
+	eventAttr.Sample_regs_user = 0xb
+	eventAttr.Sample_stack_user = 16
+	stack := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+
+	tests := []struct {
+		name  string
+		b     *recordBuilder
+		abi   uint64
+		regs  []uint64
+		stack []byte
+	}{
+		{"64-bit", new(recordBuilder).u64(PERF_SAMPLE_REGS_ABI_64, 1, 2, 3).u64(16).bytes(stack).u64(8),
+			PERF_SAMPLE_REGS_ABI_64, []uint64{1, 2, 3}, stack[:8]},
+		{"full stack", new(recordBuilder).u64(PERF_SAMPLE_REGS_ABI_32, 1, 2, 3).u64(16).bytes(stack).u64(16),
+			PERF_SAMPLE_REGS_ABI_32, []uint64{1, 2, 3}, stack},
+		// A kernel thread has neither registers nor stack.
+		{"kernel thread", new(recordBuilder).u64(PERF_SAMPLE_REGS_ABI_NONE, 0),
+			PERF_SAMPLE_REGS_ABI_NONE, nil, []byte{}},
+	}
+	for _, tt := range tests {
+		sample, err := DecodeSample(tt.b.buf, eventAttr)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if sample.RegsUserABI != tt.abi || !reflect.DeepEqual(sample.RegsUser, tt.regs) {
+			t.Errorf("%s: registers %d %v, want %d %v", tt.name, sample.RegsUserABI, sample.RegsUser, tt.abi, tt.regs)
+		}
+		if !reflect.DeepEqual(sample.StackUser, tt.stack) {
+			t.Errorf("%s: stack %v, want %v", tt.name, sample.StackUser, tt.stack)
+		}
+	}
+
+	b := new(recordBuilder).u64(PERF_SAMPLE_REGS_ABI_64, 1, 2)
+	if _, err := DecodeSample(b.buf, eventAttr); err != PerfShortRecord {
+		t.Errorf("DecodeSample() of short registers = %v, want %v", err, PerfShortRecord)
+	}
+	b = new(recordBuilder).u64(PERF_SAMPLE_REGS_ABI_64, 1, 2, 3).u64(1 << 40)
+	if _, err := DecodeSample(b.buf, eventAttr); err != PerfShortRecord {
+		t.Errorf("DecodeSample() of a short stack = %v, want %v", err, PerfShortRecord)
+	}
+}
+
+func TestDecodeSampleUnsupported(t *testing.T) {
+	b := new(recordBuilder).u64(0x401000, 1)
+	if _, err := DecodeSample(b.buf, sampleAttr(PERF_SAMPLE_IP|PERF_SAMPLE_REGS_INTR)); err != PerfUnsupportedSampleType {
+		t.Errorf("DecodeSample() with the interrupt registers = %v, want %v", err, PerfUnsupportedSampleType)
+	}
+}
+
+func TestDecodeDataSource(t *testing.T) {
+	want := MemDataSource{Op: PERF_MEM_OP_LOAD, Lvl: 0x42, Snoop: 0x2, Lock: 0x1, Dtlb: 0x5}
+	dataSrc := want.Op | want.Lvl<<5 | want.Snoop<<19 | want.Lock<<24 | want.Dtlb<<26
+	if got := DecodeDataSource(dataSrc); got != want {
+		t.Errorf("DecodeDataSource(%#x) = %+v, want %+v", dataSrc, got, want)
+	}
+	if got := DecodeDataSource(0); got != (MemDataSource{}) {
+		t.Errorf("DecodeDataSource(0) = %+v", got)
+	}
+}
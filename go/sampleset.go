@@ -0,0 +1,109 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"errors"
+	"syscall"
+	"time"
+)
+
+var PerfEpollError = errors.New("epoll failed on the events")
+
+// SampleSet waits for any of several sampling events to have records to
+// drain, with a single epoll instance, e.g. for a sampler watching many
+// events which are not in a group.
+// An event is ready once the kernel has written wakeup_events records,
+// or wakeup_watermark bytes, into its ring buffer, which has to be mapped
+// for the event to be ready at all.
+type SampleSet struct {
+	epfd   int
+	events map[int32]*PerfEventInfo
+	buf    []syscall.EpollEvent
+}
+
+// NewSampleSet creates a sample set waiting for the events of "events",
+// which must be open. The set must be closed with Close, which leaves
+// the events open.
+func NewSampleSet(events []*PerfEventInfo) (*SampleSet, error) {
+	epfd, err := syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+	if err != nil {
+		return nil, PerfEpollError
+	}
+	set := &SampleSet{
+		epfd:   epfd,
+		events: make(map[int32]*PerfEventInfo, len(events)),
+		buf:    make([]syscall.EpollEvent, len(events)),
+	}
+	for _, event := range events {
+		if event.Fd < 0 {
+			set.Close()
+			return nil, PerfFdError
+		}
+		ev := syscall.EpollEvent{Events: syscall.EPOLLIN, Fd: int32(event.Fd)}
+		err := syscall.EpollCtl(epfd, syscall.EPOLL_CTL_ADD, event.Fd, &ev)
+		if err != nil {
+			set.Close()
+			return nil, PerfEpollError
+		}
+		set.events[int32(event.Fd)] = event
+	}
+	return set, nil
+}
+
+// Wait waits up to "timeout" for events of the set to be ready, forever
+// for a negative timeout, and returns them, none if the timeout expired.
+// An event which has been closed without being removed with Remove is
+// ready too, the kernel telling it hung up.
+func (set *SampleSet) Wait(timeout time.Duration) ([]*PerfEventInfo, error) {
+	msec := -1
+	if timeout >= 0 {
+		msec = int(timeout / time.Millisecond)
+	}
+	if len(set.buf) == 0 {
+		set.buf = make([]syscall.EpollEvent, 1)
+	}
+	for {
+		n, err := syscall.EpollWait(set.epfd, set.buf, msec)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return nil, PerfEpollError
+		}
+		ready := make([]*PerfEventInfo, 0, n)
+		for _, ev := range set.buf[:n] {
+			if event, ok := set.events[ev.Fd]; ok {
+				ready = append(ready, event)
+			}
+		}
+		return ready, nil
+	}
+}
+
+// Remove stops waiting for "event", e.g. before closing it.
+func (set *SampleSet) Remove(event *PerfEventInfo) error {
+	if _, ok := set.events[int32(event.Fd)]; !ok {
+		return PerfFdError
+	}
+	delete(set.events, int32(event.Fd))
+	err := syscall.EpollCtl(set.epfd, syscall.EPOLL_CTL_DEL, event.Fd, nil)
+	if err != nil {
+		return PerfEpollError
+	}
+	return nil
+}
+
+// Close closes the epoll instance of the set.
+func (set *SampleSet) Close() error {
+	if set.epfd < 0 {
+		return nil
+	}
+	err := syscall.Close(set.epfd)
+	set.epfd = -1
+	if err != nil {
+		return PerfCloseError
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// openSampler opens a page-faults event of the calling thread sampled
+// every "period" faults, with its ring buffer mapped for the event to be
+// ready after each sample.
+func openSampler(t *testing.T, period uint64) *PerfEventInfo {
+	t.Helper()
+	eventAttr := setupPerfEventAttr(EventConfigType{PERF_TYPE_SOFTWARE, PERF_COUNT_SW_PAGE_FAULTS})
+	eventAttr.Sample = period
+	eventAttr.Wakeup = 1
+
+	event := &PerfEventInfo{Fd: -1}
+	if err := event.InitIOCOps(); err != nil {
+		t.Fatal(err)
+	}
+	if err := event.OpenEvent(eventAttr, 0, -1, -1, 0); err != nil {
+		t.Skipf("can't open a sampling event: %v", err)
+	}
+	ring, err := syscall.Mmap(event.Fd, 0, 2*os.Getpagesize(), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		syscall.Close(event.Fd)
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		syscall.Munmap(ring)
+		syscall.Close(event.Fd)
+	})
+	if err := event.EnableEvent(); err != nil {
+		t.Fatal(err)
+	}
+	return event
+}
+
+func TestSampleSet(t *testing.T) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	often, never := openSampler(t, 1), openSampler(t, 1<<40)
+	set, err := NewSampleSet([]*PerfEventInfo{often, never})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer set.Close()
+
+	// The faults of the test itself may have been sampled already, not
+	// 2^40 of them.
+	ready, err := set.Wait(10 * time.Millisecond)
+	if err != nil || len(ready) > 1 || len(ready) == 1 && ready[0] != often {
+		t.Fatalf("Wait() = %v, %v, want no event", ready, err)
+	}
+
+	touchPages(16)
+	ready, err = set.Wait(time.Second)
+	if err != nil || len(ready) != 1 || ready[0] != often {
+		t.Fatalf("Wait() = %v, %v, want the event sampled every fault", ready, err)
+	}
+
+	// Once removed, the event doesn't wake the set up anymore.
+	if err := set.Remove(often); err != nil {
+		t.Fatal(err)
+	}
+	if err := set.Remove(often); err != PerfFdError {
+		t.Errorf("Remove() twice = %v, want %v", err, PerfFdError)
+	}
+	ready, err = set.Wait(10 * time.Millisecond)
+	if err != nil || len(ready) != 0 {
+		t.Errorf("Wait() = %v, %v after Remove(), want no event", ready, err)
+	}
+
+	if err := set.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := set.Close(); err != nil {
+		t.Errorf("Close() twice = %v", err)
+	}
+	if _, err := set.Wait(0); err != PerfEpollError {
+		t.Errorf("Wait() after Close() = %v, want %v", err, PerfEpollError)
+	}
+}
+
+func TestNewSampleSetErrors(t *testing.T) {
+	// epoll doesn't take regular files.
+	f, err := os.Create(filepath.Join(t.TempDir(), "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	tests := []struct {
+		name  string
+		event *PerfEventInfo
+		err   error
+	}{
+		{"closed", &PerfEventInfo{Fd: -1}, PerfFdError},
+		{"not pollable", &PerfEventInfo{Fd: int(f.Fd())}, PerfEpollError},
+	}
+	for _, tt := range tests {
+		if set, err := NewSampleSet([]*PerfEventInfo{tt.event}); err != tt.err {
+			t.Errorf("%s: NewSampleSet() = %v, %v, want %v", tt.name, set, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"errors"
+	"sync"
+	"syscall"
+)
+
+// Bits for the PerfEventAttr.Sample_type value derived from
+// linux/perf_event.h
+// Each of these bits selects a field to be recorded in every sample.
+const (
+	PERF_SAMPLE_IP           = 1 << 0
+	PERF_SAMPLE_TID          = 1 << 1
+	PERF_SAMPLE_TIME         = 1 << 2
+	PERF_SAMPLE_ADDR         = 1 << 3
+	PERF_SAMPLE_READ         = 1 << 4
+	PERF_SAMPLE_CALLCHAIN    = 1 << 5
+	PERF_SAMPLE_ID           = 1 << 6
+	PERF_SAMPLE_CPU          = 1 << 7
+	PERF_SAMPLE_PERIOD       = 1 << 8
+	PERF_SAMPLE_STREAM_ID    = 1 << 9
+	PERF_SAMPLE_RAW          = 1 << 10
+	PERF_SAMPLE_BRANCH_STACK = 1 << 11
+	PERF_SAMPLE_REGS_USER    = 1 << 12
+	PERF_SAMPLE_STACK_USER   = 1 << 13
+	PERF_SAMPLE_WEIGHT       = 1 << 14
+	PERF_SAMPLE_DATA_SRC     = 1 << 15
+	PERF_SAMPLE_IDENTIFIER   = 1 << 16
+	PERF_SAMPLE_TRANSACTION  = 1 << 17
+	PERF_SAMPLE_REGS_INTR    = 1 << 18
+	PERF_SAMPLE_PHYS_ADDR    = 1 << 19
+)
+
+var PerfInvalidSampleOptions = errors.New("invalid sampling options")
+var PerfFreqAndPeriod = errors.New("sampling frequency and period are mutually exclusive")
+
+// The kernel caps the sampling frequency of the events to the rate in
+// maxSampleRatePath.
+var maxSampleRatePath = "/proc/sys/kernel/perf_event_max_sample_rate"
+
+// SampleOptions holds the sampling configuration for an event.
+// SamplePeriod : number of events after which a sample is taken.
+// SampleFreq : frequency (in Hz) at which samples are taken, the kernel
+// adjusting the period to reach it. SamplePeriod and SampleFreq are
+// mutually exclusive. SampleFreq is capped to the maximum sample rate of
+// the kernel.
+// SampleType : PERF_SAMPLE_* bits selecting the fields of a sample.
+// ExcludeCallchainKernel : don't record the kernel frames of a callchain.
+// ExcludeCallchainUser : don't record the user frames of a callchain.
+// Mmap2 : record the memory mappings of the process as PERF_RECORD_MMAP2
+// records, which are needed to symbolize the sampled addresses.
+// Comm : record the names the processes take, on exec too, as
+// PERF_RECORD_COMM records, which are needed to tell which process a
+// sample belongs to.
+// Task : record the threads and processes created and exiting as
+// PERF_RECORD_FORK and PERF_RECORD_EXIT records, as decoded by
+// DecodeTaskRecord, to track the process tree over the sampling. Along
+// with the Inherit option of the event, the children are sampled too.
+// SampleIdAll : have the records other than the samples, e.g. the
+// PERF_RECORD_MMAP2 and PERF_RECORD_COMM ones, end with the TID, TIME,
+// ID, STREAM_ID, CPU and IDENTIFIER fields of the sample type, as decoded
+// by DecodeSampleId, to tell which event they are about when sampling
+// several events.
+// RegsUser : mask of the user registers recorded in every sample, as per
+// the PERF_REG_* values of the architecture (asm/perf_regs.h).
+// StackUserSize : size of the dump of the user stack recorded in every
+// sample, a multiple of 8.
+// BranchSampleType : PERF_SAMPLE_BRANCH_* bits selecting the branches
+// recorded in the branch stack of every sample, e.g.
+// PERF_SAMPLE_BRANCH_CALL_RETURN for the calls and returns only. The PMU
+// must support branch sampling (the LBR on x86).
+// ReadFormat : PERF_FORMAT_* bits selecting the values recorded in every
+// sample with PERF_SAMPLE_READ, e.g. PERF_FORMAT_GROUP for the counts of
+// all the events of the group of the sampled event.
+//
+// The ExcludeCallchain* options are only meaningful when SampleType
+// has PERF_SAMPLE_CALLCHAIN set.
+// Along with RegsUser, the user stack dump allows unwinding the user
+// stack with its DWARF information, without frame pointers.
+type SampleOptions struct {
+	SamplePeriod           uint64
+	SampleFreq             uint64
+	SampleType             uint64
+	ExcludeCallchainKernel bool
+	ExcludeCallchainUser   bool
+	Mmap2                  bool
+	Comm                   bool
+	Task                   bool
+	SampleIdAll            bool
+	RegsUser               uint64
+	StackUserSize          uint32
+	BranchSampleType       uint64
+	ReadFormat             uint64
+}
+
+// validate checks that the sampling options are consistent.
+func (opts SampleOptions) validate() error {
+	if opts.SamplePeriod != 0 && opts.SampleFreq != 0 {
+		return PerfFreqAndPeriod
+	}
+	if opts.SamplePeriod == 0 && opts.SampleFreq == 0 {
+		return PerfInvalidSampleOptions
+	}
+	if opts.ExcludeCallchainKernel || opts.ExcludeCallchainUser {
+		if opts.SampleType&PERF_SAMPLE_CALLCHAIN == 0 {
+			return PerfInvalidSampleOptions
+		}
+	}
+	if opts.StackUserSize%8 != 0 {
+		return PerfInvalidSampleOptions
+	}
+	if opts.ReadFormat != 0 && opts.SampleType&PERF_SAMPLE_READ == 0 {
+		return PerfInvalidSampleOptions
+	}
+	if opts.BranchSampleType != 0 {
+		return checkBranchSampleType(opts.BranchSampleType)
+	}
+	return nil
+}
+
+// SetSampleOptions turns the event described by the attributes into a
+// sampling event as per "opts". The attributes can then be passed to
+// OpenEvent.
+func (eventAttr *PerfEventAttr) SetSampleOptions(opts SampleOptions) error {
+	err := opts.validate()
+	if err != nil {
+		return err
+	}
+	eventAttr.Sample = opts.SamplePeriod
+	if opts.SampleFreq != 0 {
+		// sample_period and sample_freq share the same field.
+		eventAttr.Sample = opts.SampleFreq
+		if maxRate, err := readSysfsUint(maxSampleRatePath); err == nil && opts.SampleFreq > maxRate {
+			eventAttr.Sample = maxRate
+		}
+		eventAttr.Bits = setBit(eventAttr.Bits, FREQ)
+	}
+	eventAttr.Sample_type = opts.SampleType
+	if opts.ExcludeCallchainKernel {
+		eventAttr.Bits = setBit(eventAttr.Bits, EXCLUDE_CALLCHAIN_KERNEL)
+	}
+	if opts.ExcludeCallchainUser {
+		eventAttr.Bits = setBit(eventAttr.Bits, EXCLUDE_CALLCHAIN_USER)
+	}
+	if opts.Mmap2 {
+		eventAttr.Bits = setBit(eventAttr.Bits, MMAP)
+		eventAttr.Bits = setBit(eventAttr.Bits, MMAP2)
+	}
+	if opts.Task {
+		eventAttr.Bits = setBit(eventAttr.Bits, TASK)
+	}
+	if opts.SampleIdAll {
+		eventAttr.Bits = setBit(eventAttr.Bits, SAMPLE_ID_ALL)
+	}
+	if opts.Comm {
+		eventAttr.Bits = setBit(eventAttr.Bits, COMM)
+		eventAttr.Bits = setBit(eventAttr.Bits, COMM_EXEC)
+	}
+	if opts.RegsUser != 0 {
+		eventAttr.Sample_type |= PERF_SAMPLE_REGS_USER
+		eventAttr.Sample_regs_user = opts.RegsUser
+	}
+	if opts.StackUserSize != 0 {
+		eventAttr.Sample_type |= PERF_SAMPLE_STACK_USER
+		eventAttr.Sample_stack_user = opts.StackUserSize
+	}
+	if opts.BranchSampleType != 0 {
+		eventAttr.Sample_type |= PERF_SAMPLE_BRANCH_STACK
+		eventAttr.Branch_sample_type = opts.BranchSampleType
+	}
+	eventAttr.Read_format |= opts.ReadFormat
+	return nil
+}
+
+// Sample types supported by the kernel, which are probed only once.
+var sampleTypes struct {
+	once      sync.Once
+	supported uint64
+}
+
+// probeSampleType checks whether a cpu-clock sampling event with the
+// sample type "sampleType" can be opened.
+var probeSampleType = func(sampleType uint64) bool {
+	eventAttr := setupPerfEventAttr(EventConfigType{PERF_TYPE_SOFTWARE, PERF_COUNT_SW_CPU_CLOCK})
+	eventAttr.Sample = idleSamplePeriod
+	eventAttr.Sample_type = sampleType
+	// Some sample types take a configuration the kernel checks.
+	switch sampleType {
+	case PERF_SAMPLE_REGS_USER:
+		eventAttr.Sample_regs_user = 1
+	case PERF_SAMPLE_REGS_INTR:
+		eventAttr.Sample_regs_intr = 1
+	case PERF_SAMPLE_BRANCH_STACK:
+		eventAttr.Branch_sample_type = PERF_SAMPLE_BRANCH_ANY
+	}
+
+	event := PerfEventInfo{Fd: -1}
+	err := event.OpenEvent(eventAttr, 0, -1, -1, 0)
+	if err != nil {
+		return false
+	}
+	syscall.Close(event.Fd)
+	return true
+}
+
+// SupportedSampleTypes returns the PERF_SAMPLE_* bits the kernel supports,
+// probed on a software event, so that a sampling request can be trimmed
+// before opening the event fails. PERF_SAMPLE_BRANCH_STACK also depends
+// on the PMU, which may not support it even when the kernel does. The
+// result of the probe is cached.
+func SupportedSampleTypes() uint64 {
+	sampleTypes.once.Do(func() {
+		for bit := uint(0); bit <= 19; bit++ {
+			if probeSampleType(1 << bit) {
+				sampleTypes.supported |= 1 << bit
+			}
+		}
+	})
+	return sampleTypes.supported
+}
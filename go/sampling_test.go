@@ -0,0 +1,170 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// setMaxSampleRate has the sampling options read the maximum sample
+// rate "rate" of the kernel, or none if empty.
+func setMaxSampleRate(t *testing.T, rate string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "perf_event_max_sample_rate")
+	if rate != "" {
+		if err := ioutil.WriteFile(path, []byte(rate+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	saved := maxSampleRatePath
+	maxSampleRatePath = path
+	t.Cleanup(func() { maxSampleRatePath = saved })
+}
+
+func TestSampleOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		opts SampleOptions
+		err  error
+	}{
+		{"period", SampleOptions{SamplePeriod: 1000}, nil},
+		{"freq", SampleOptions{SampleFreq: 99}, nil},
+		{"freq and period", SampleOptions{SamplePeriod: 1000, SampleFreq: 99}, PerfFreqAndPeriod},
+		{"neither freq nor period", SampleOptions{SampleType: PERF_SAMPLE_IP}, PerfInvalidSampleOptions},
+		{"callchain", SampleOptions{SamplePeriod: 1, SampleType: PERF_SAMPLE_CALLCHAIN, ExcludeCallchainKernel: true}, nil},
+		{"callchain exclusion without callchain", SampleOptions{SamplePeriod: 1, ExcludeCallchainUser: true}, PerfInvalidSampleOptions},
+		{"user stack", SampleOptions{SamplePeriod: 1, StackUserSize: 4096}, nil},
+		{"unaligned user stack", SampleOptions{SamplePeriod: 1, StackUserSize: 4095}, PerfInvalidSampleOptions},
+		{"read format", SampleOptions{SamplePeriod: 1, SampleType: PERF_SAMPLE_READ, ReadFormat: PERF_FORMAT_GROUP}, nil},
+		{"read format without read", SampleOptions{SamplePeriod: 1, ReadFormat: PERF_FORMAT_GROUP}, PerfInvalidSampleOptions},
+		{"branches", SampleOptions{SamplePeriod: 1, BranchSampleType: PERF_SAMPLE_BRANCH_CALL_RETURN}, nil},
+		{"privilege only branches", SampleOptions{SamplePeriod: 1, BranchSampleType: PERF_SAMPLE_BRANCH_USER}, PerfInvalidBranchSampleType},
+		{"unknown branches", SampleOptions{SamplePeriod: 1, BranchSampleType: 1 << 30}, PerfInvalidBranchSampleType},
+	}
+	for _, tt := range tests {
+		if err := tt.opts.validate(); err != tt.err {
+			t.Errorf("%s: validate() = %v, want %v", tt.name, err, tt.err)
+		}
+		// The attributes are left as is on an error.
+		eventAttr := setupPerfEventAttr(EventConfigType{PERF_TYPE_SOFTWARE, PERF_COUNT_SW_CPU_CLOCK})
+		before := eventAttr
+		if err := eventAttr.SetSampleOptions(tt.opts); err != nil && eventAttr != before {
+			t.Errorf("%s: SetSampleOptions() = %v, changing the attributes", tt.name, err)
+		}
+	}
+}
+
+func TestSampleFreq(t *testing.T) {
+	tests := []struct {
+		name    string
+		maxRate string
+		freq    uint64
+		sample  uint64
+	}{
+		{"below the max rate", "100000", 4000, 4000},
+		{"at the max rate", "100000", 100000, 100000},
+		{"clamped to the max rate", "100000", 1000000, 100000},
+		{"clamped to a low max rate", "1000", 4000, 1000},
+		{"no max rate", "", 1000000, 1000000},
+		{"invalid max rate", "many", 1000000, 1000000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setMaxSampleRate(t, tt.maxRate)
+			eventAttr := setupPerfEventAttr(EventConfigType{PERF_TYPE_SOFTWARE, PERF_COUNT_SW_CPU_CLOCK})
+			if err := eventAttr.SetSampleOptions(SampleOptions{SampleFreq: tt.freq}); err != nil {
+				t.Fatal(err)
+			}
+			if eventAttr.Sample != tt.sample || eventAttr.Bits&(1<<FREQ) == 0 {
+				t.Errorf("SampleFreq %d set sample_freq to %d, freq bit %t, want %d", tt.freq,
+					eventAttr.Sample, eventAttr.Bits&(1<<FREQ) != 0, tt.sample)
+			}
+			if err := eventAttr.Validate(); err != nil {
+				t.Errorf("Validate() = %v", err)
+			}
+		})
+	}
+
+	// The period isn't capped.
+	setMaxSampleRate(t, "1000")
+	eventAttr := setupPerfEventAttr(EventConfigType{PERF_TYPE_SOFTWARE, PERF_COUNT_SW_CPU_CLOCK})
+	if err := eventAttr.SetSampleOptions(SampleOptions{SamplePeriod: 1000000}); err != nil {
+		t.Fatal(err)
+	}
+	if eventAttr.Sample != 1000000 || eventAttr.Bits&(1<<FREQ) != 0 {
+		t.Errorf("SamplePeriod set sample_period to %d, freq bit %t", eventAttr.Sample, eventAttr.Bits&(1<<FREQ) != 0)
+	}
+}
+
+func TestSetSampleOptions(t *testing.T) {
+	opts := SampleOptions{
+		SamplePeriod:           1000,
+		SampleType:             PERF_SAMPLE_IP | PERF_SAMPLE_CALLCHAIN | PERF_SAMPLE_READ,
+		ExcludeCallchainKernel: true,
+		ExcludeCallchainUser:   true,
+		Mmap2:                  true,
+		Comm:                   true,
+		Task:                   true,
+		SampleIdAll:            true,
+		RegsUser:               0xff,
+		StackUserSize:          8192,
+		BranchSampleType:       PERF_SAMPLE_BRANCH_ANY,
+		ReadFormat:             PERF_FORMAT_GROUP | PERF_FORMAT_ID,
+	}
+	eventAttr := setupPerfEventAttr(EventConfigType{PERF_TYPE_HARDWARE, PERF_HW_CPU_CYCLES})
+	if err := eventAttr.SetSampleOptions(opts); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, bit := range []uint64{EXCLUDE_CALLCHAIN_KERNEL, EXCLUDE_CALLCHAIN_USER, MMAP, MMAP2, COMM, COMM_EXEC, TASK, SAMPLE_ID_ALL} {
+		if eventAttr.Bits&(1<<bit) == 0 {
+			t.Errorf("bit %d not set", bit)
+		}
+	}
+	wantType := uint64(PERF_SAMPLE_IP | PERF_SAMPLE_CALLCHAIN | PERF_SAMPLE_READ |
+		PERF_SAMPLE_REGS_USER | PERF_SAMPLE_STACK_USER | PERF_SAMPLE_BRANCH_STACK)
+	if eventAttr.Sample_type != wantType {
+		t.Errorf("sample type %#x, want %#x", eventAttr.Sample_type, wantType)
+	}
+	if eventAttr.Sample_regs_user != 0xff || eventAttr.Sample_stack_user != 8192 || eventAttr.Branch_sample_type != PERF_SAMPLE_BRANCH_ANY {
+		t.Errorf("regs %#x, stack %d, branches %#x", eventAttr.Sample_regs_user, eventAttr.Sample_stack_user, eventAttr.Branch_sample_type)
+	}
+	wantFormat := uint64(PERF_FORMAT_TOTAL_TIME_ENABLED | PERF_FORMAT_TOTAL_TIME_RUNNING | PERF_FORMAT_GROUP | PERF_FORMAT_ID)
+	if eventAttr.Read_format != wantFormat {
+		t.Errorf("read format %#x, want %#x", eventAttr.Read_format, wantFormat)
+	}
+	if err := eventAttr.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+}
+
+func TestSupportedSampleTypes(t *testing.T) {
+	saved := probeSampleType
+	defer func() {
+		probeSampleType = saved
+		sampleTypes.once = sync.Once{}
+		sampleTypes.supported = 0
+	}()
+
+	probes := 0
+	probeSampleType = func(sampleType uint64) bool {
+		probes++
+		return sampleType != PERF_SAMPLE_BRANCH_STACK && sampleType != PERF_SAMPLE_PHYS_ADDR
+	}
+	sampleTypes.once = sync.Once{}
+	sampleTypes.supported = 0
+
+	want := uint64(1<<20-1) &^ (PERF_SAMPLE_BRANCH_STACK | PERF_SAMPLE_PHYS_ADDR)
+	if got := SupportedSampleTypes(); got != want {
+		t.Errorf("SupportedSampleTypes() = %#x, want %#x", got, want)
+	}
+	// The result is cached.
+	SupportedSampleTypes()
+	if probes != 20 {
+		t.Errorf("probed %d sample types, want 20", probes)
+	}
+}
@@ -0,0 +1,31 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+// EventSnapshot is the count of an event at some point in time.
+// Value : count of the event.
+// Epoch : epoch of the event, i.e., the number of times it had been reset.
+type EventSnapshot struct {
+	Value uint64
+	Epoch uint64
+}
+
+// Snapshot reads the event and returns its current count.
+func (event *PerfEventInfo) Snapshot() (EventSnapshot, error) {
+	err := event.ReadEvent()
+	if err != nil {
+		return EventSnapshot{}, err
+	}
+	return EventSnapshot{event.Data, event.Epoch}, nil
+}
+
+// Diff returns the count of an event between the snapshots "before" and
+// "after". If the event has been reset in between, the count before the
+// reset is unknown, so the count since the reset is returned.
+func Diff(before EventSnapshot, after EventSnapshot) uint64 {
+	if after.Epoch != before.Epoch || after.Value < before.Value {
+		return after.Value
+	}
+	return after.Value - before.Value
+}
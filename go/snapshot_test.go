@@ -0,0 +1,63 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name          string
+		before, after EventSnapshot
+		want          uint64
+	}{
+		{"same epoch", EventSnapshot{100, 1}, EventSnapshot{150, 1}, 50},
+		{"no change", EventSnapshot{100, 1}, EventSnapshot{100, 1}, 0},
+		{"reset", EventSnapshot{100, 1}, EventSnapshot{30, 2}, 30},
+		{"reset, more counted", EventSnapshot{100, 1}, EventSnapshot{300, 2}, 300},
+		{"wrapped", EventSnapshot{100, 1}, EventSnapshot{30, 1}, 30},
+	}
+	for _, tt := range tests {
+		if got := Diff(tt.before, tt.after); got != tt.want {
+			t.Errorf("%s: Diff(%+v, %+v) = %d, want %d", tt.name, tt.before, tt.after, got, tt.want)
+		}
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	eventsInfo := openOrSkip(t, "page-faults", EventOptions{})
+	defer EventsDisableClose(eventsInfo)
+	event := &eventsInfo[0]
+
+	before, err := event.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	touchPages(16)
+	after, err := event.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := Diff(before, after); diff < 16 || after.Epoch != before.Epoch {
+		t.Errorf("Diff() = %d, epochs %d, %d", diff, before.Epoch, after.Epoch)
+	}
+
+	// The count since the reset only.
+	touchPages(64)
+	if err := event.ResetEvent(); err != nil {
+		t.Fatal(err)
+	}
+	touchPages(16)
+	reset, err := event.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := Diff(after, reset); diff < 16 || diff >= 64 || reset.Epoch != after.Epoch+1 {
+		t.Errorf("Diff() across a reset = %d, epochs %d, %d", diff, after.Epoch, reset.Epoch)
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// The kernel exports the PMUs, and for each of them, its type, the
+// layout of its config values and the events it knows of under
+// sysfsPMUPath/<pmu>/{type,format,events}.
+// An event is described as a list of terms, e.g. "event=0xcd,umask=0x1",
+// the format of a term telling which bits of which config value it sets,
+// e.g. "config:0-7".
+var sysfsPMUPath = "/sys/bus/event_source/devices"
+
+// Events resolved through sysfs, with the PMU defining them.
+// mem-loads and mem-stores are the memory access sampling events, to be
+// sampled with PERF_SAMPLE_WEIGHT and PERF_SAMPLE_DATA_SRC.
+var sysfsEventList = map[string]string{
+	"mem-loads":  "cpu",
+	"mem-stores": "cpu",
+}
+
+var PerfSysfsFormatError = errors.New("unexpected sysfs PMU format")
+
+// resolveSysfsEvent sets up the perf event attributes for the event
+// "name" of the PMU "pmu" as described in sysfs.
+func resolveSysfsEvent(pmu string, name string) (PerfEventAttr, error) {
+	var eventAttr PerfEventAttr
+	pmuPath := filepath.Join(sysfsPMUPath, pmu)
+
+	typeHw, err := readSysfsUint(filepath.Join(pmuPath, "type"))
+	if err != nil {
+		return eventAttr, PerfUnsupportedEvent
+	}
+	desc, err := ioutil.ReadFile(filepath.Join(pmuPath, "events", name))
+	if err != nil {
+		return eventAttr, PerfUnsupportedEvent
+	}
+
+	eventAttr = setupPerfEventAttr(EventConfigType{uint32(typeHw), 0})
+	for _, term := range strings.Split(strings.TrimSpace(string(desc)), ",") {
+		key, value := term, uint64(1)
+		if i := strings.IndexByte(term, '='); i >= 0 {
+			key = term[:i]
+			value, err = strconv.ParseUint(term[i+1:], 0, 64)
+			if err != nil {
+				return eventAttr, PerfSysfsFormatError
+			}
+		}
+		format, err := ioutil.ReadFile(filepath.Join(pmuPath, "format", key))
+		if err != nil {
+			return eventAttr, PerfSysfsFormatError
+		}
+		err = eventAttr.setFormatTerm(strings.TrimSpace(string(format)), value)
+		if err != nil {
+			return eventAttr, err
+		}
+	}
+	return eventAttr, nil
+}
+
+// setFormatTerm deposits "value" into the bits of the config value
+// described by "format", e.g. "config:0-7,32-35" or "config1:0".
+func (eventAttr *PerfEventAttr) setFormatTerm(format string, value uint64) error {
+	i := strings.IndexByte(format, ':')
+	if i < 0 {
+		return PerfSysfsFormatError
+	}
+	var config *uint64
+	switch format[:i] {
+	case "config":
+		config = &eventAttr.Config
+	case "config1":
+		config = &eventAttr.Ext1
+	case "config2":
+		config = &eventAttr.Ext2
+	default:
+		return PerfSysfsFormatError
+	}
+
+	for _, bits := range strings.Split(format[i+1:], ",") {
+		lo, hi := bits, bits
+		if j := strings.IndexByte(bits, '-'); j >= 0 {
+			lo, hi = bits[:j], bits[j+1:]
+		}
+		first, err1 := strconv.ParseUint(lo, 10, 6)
+		last, err2 := strconv.ParseUint(hi, 10, 6)
+		if err1 != nil || err2 != nil || last < first {
+			return PerfSysfsFormatError
+		}
+		for bit := first; bit <= last; bit++ {
+			if value&1 != 0 {
+				*config = setBit(*config, bit)
+			}
+			value >>= 1
+		}
+	}
+	return nil
+}
+
+// readSysfsUint reads a sysfs file holding a single number.
+func readSysfsUint(path string) (uint64, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(buf)), 0, 64)
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeSysfs points sysfsPMUPath to a temporary tree holding "files",
+// given by their path relative to it, e.g. "cpu/type", for the time of
+// the test.
+func fakeSysfs(t *testing.T, files map[string]string) {
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := sysfsPMUPath
+	sysfsPMUPath = dir
+	t.Cleanup(func() { sysfsPMUPath = path })
+}
+
+func TestSetFormatTerm(t *testing.T) {
+	tests := []struct {
+		format             string
+		value              uint64
+		config, ext1, ext2 uint64
+		err                error
+	}{
+		{"config:0-7", 0xcd, 0xcd, 0, 0, nil},
+		{"config:8-15", 0x1, 0x100, 0, 0, nil},
+		{"config:0-3,32-35", 0xab, 0xa0000000b, 0, 0, nil},
+		{"config:63", 1, 1 << 63, 0, 0, nil},
+		{"config1:0", 1, 0, 1, 0, nil},
+		{"config2:0-15", 0xffff, 0, 0, 0xffff, nil},
+		// The bits beyond the format are dropped.
+		{"config:0-3", 0xff, 0xf, 0, 0, nil},
+		{"config", 1, 0, 0, 0, PerfSysfsFormatError},
+		{"config3:0", 1, 0, 0, 0, PerfSysfsFormatError},
+		{"config:7-0", 1, 0, 0, 0, PerfSysfsFormatError},
+		{"config:0-64", 1, 0, 0, 0, PerfSysfsFormatError},
+		{"config:a", 1, 0, 0, 0, PerfSysfsFormatError},
+	}
+	for _, tt := range tests {
+		var eventAttr PerfEventAttr
+		err := eventAttr.setFormatTerm(tt.format, tt.value)
+		if err != tt.err {
+			t.Errorf("setFormatTerm(%q, %#x) = %v, want %v", tt.format, tt.value, err, tt.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if eventAttr.Config != tt.config || eventAttr.Ext1 != tt.ext1 || eventAttr.Ext2 != tt.ext2 {
+			t.Errorf("setFormatTerm(%q, %#x) set %#x, %#x, %#x, want %#x, %#x, %#x", tt.format, tt.value,
+				eventAttr.Config, eventAttr.Ext1, eventAttr.Ext2, tt.config, tt.ext1, tt.ext2)
+		}
+	}
+}
+
+func TestResolveSysfsEvent(t *testing.T) {
+	fakeSysfs(t, map[string]string{
+		"cpu/type":               "4\n",
+		"cpu/format/event":       "config:0-7\n",
+		"cpu/format/umask":       "config:8-15\n",
+		"cpu/format/ldlat":       "config1:0-15\n",
+		"cpu/format/any":         "config:21\n",
+		"cpu/format/bad":         "config:x\n",
+		"cpu/events/mem-loads":   "event=0xcd,umask=0x1,ldlat=3\n",
+		"cpu/events/any-cycles":  "event=0x3c,any\n",
+		"cpu/events/bad-value":   "event=zz\n",
+		"cpu/events/bad-term":    "event=0x1,missing=0x1\n",
+		"cpu/events/bad-format":  "bad=0x1\n",
+		"notype/events/anything": "event=0x1\n",
+	})
+
+	tests := []struct {
+		pmu, name    string
+		config, ext1 uint64
+		err          error
+	}{
+		{"cpu", "mem-loads", 0x1cd, 3, nil},
+		{"cpu", "any-cycles", 1<<21 | 0x3c, 0, nil},
+		{"cpu", "bad-value", 0, 0, PerfSysfsFormatError},
+		{"cpu", "bad-term", 0, 0, PerfSysfsFormatError},
+		{"cpu", "bad-format", 0, 0, PerfSysfsFormatError},
+		{"cpu", "missing", 0, 0, PerfUnsupportedEvent},
+		{"notype", "anything", 0, 0, PerfUnsupportedEvent},
+		{"missing", "mem-loads", 0, 0, PerfUnsupportedEvent},
+	}
+	for _, tt := range tests {
+		eventAttr, err := resolveSysfsEvent(tt.pmu, tt.name)
+		if err != tt.err {
+			t.Errorf("resolveSysfsEvent(%q, %q) = %v, want %v", tt.pmu, tt.name, err, tt.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if eventAttr.Type != 4 || eventAttr.Config != tt.config || eventAttr.Ext1 != tt.ext1 {
+			t.Errorf("resolveSysfsEvent(%q, %q) = type %d, config %#x, %#x, want 4, %#x, %#x",
+				tt.pmu, tt.name, eventAttr.Type, eventAttr.Config, eventAttr.Ext1, tt.config, tt.ext1)
+		}
+	}
+}
+
+func TestReadSysfsUint(t *testing.T) {
+	fakeSysfs(t, map[string]string{
+		"decimal": "42\n",
+		"hex":     "0x2a",
+		"garbage": "forty-two\n",
+	})
+	tests := []struct {
+		name string
+		want uint64
+		ok   bool
+	}{
+		{"decimal", 42, true},
+		{"hex", 42, true},
+		{"garbage", 0, false},
+		{"missing", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := readSysfsUint(filepath.Join(sysfsPMUPath, tt.name))
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("readSysfsUint(%q) = %d, %v, want %d", tt.name, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The kernel exports the name of every task under procPath/<pid>/comm.
+var procPath = "/proc"
+
+var PerfTaskNotFound = errors.New("no task with this name")
+
+// FindTaskByName returns the ids of the tasks, kernel threads included,
+// named "name", e.g. "kswapd0".
+func FindTaskByName(name string) ([]int, error) {
+	dirs, err := ioutil.ReadDir(procPath)
+	if err != nil {
+		return nil, err
+	}
+
+	tids := make([]int, 0)
+	for _, dir := range dirs {
+		tid, err := strconv.Atoi(dir.Name())
+		if err != nil {
+			continue
+		}
+		// The task may have exited in the meantime.
+		comm, err := ioutil.ReadFile(filepath.Join(procPath, dir.Name(), "comm"))
+		if err != nil {
+			continue
+		}
+		if strings.TrimSuffix(string(comm), "\n") == name {
+			tids = append(tids, tid)
+		}
+	}
+	if len(tids) == 0 {
+		return nil, PerfTaskNotFound
+	}
+	sort.Ints(tids)
+	return tids, nil
+}
+
+// InitOpenEventsEnableTask opens, enables the event list "events" for
+// every task named "name", as found by FindTaskByName, on any CPU.
+// The events opened for every task are returned one after the other, the
+// ones which couldn't be opened being returned as "event@tidN".
+// Measuring the tasks of other users, kernel threads included, requires
+// privileges, the events failing with PerfPermissionError otherwise, see
+// PermissionSummary. Kernel threads only run in the kernel, so their
+// events should count there, e.g. "cpu-cycles:k".
+func InitOpenEventsEnableTask(events string, name string) (error, []string, []PerfEventInfo) {
+	tids, err := FindTaskByName(name)
+	if err != nil {
+		return err, nil, nil
+	}
+
+	var lastErr error
+	eventListNA := make([]string, 0)
+	eventDescs := make([]PerfEventInfo, 0)
+	for _, tid := range tids {
+		err, tidListNA, tidDescs := initOpenEventsEnable(events, tid, -1, EventOptions{})
+		if err != nil {
+			lastErr = err
+			for _, name := range tidListNA {
+				eventListNA = append(eventListNA, name+"@tid"+strconv.Itoa(tid))
+			}
+		}
+		eventDescs = append(eventDescs, tidDescs...)
+	}
+	return lastErr, eventListNA, eventDescs
+}
+
+// MeasureProcessTree counts the event list "events" for "duration" on
+// the process "rootPid" and the processes and threads it creates in the
+// meantime, with Inherit, and returns the counts by event. The
+// descendants already running when the measurement starts aren't
+// counted, as the kernel only passes the counters on at fork.
+// Measuring the processes of another user requires privileges, the
+// events failing with PerfPermissionError otherwise, see
+// PermissionSummary. An error is returned if any event couldn't be
+// opened.
+func MeasureProcessTree(events string, rootPid int, duration time.Duration) (map[string]uint64, error) {
+	err, _, eventsInfo := initOpenEventsEnable(events, rootPid, -1, EventOptions{Inherit: true})
+	defer EventsDisableClose(eventsInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	time.Sleep(duration)
+	err = EventsRead(eventsInfo)
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]uint64, len(eventsInfo))
+	for _, event := range eventsInfo {
+		counts[event.EventName] += event.Data
+	}
+	return counts, nil
+}
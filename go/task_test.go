@@ -0,0 +1,127 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeProc points procPath to a temporary tree with the tasks "comms"
+// by tid, for the time of the test.
+func fakeProc(t *testing.T, comms map[string]string) {
+	dir := t.TempDir()
+	for tid, comm := range comms {
+		if err := os.MkdirAll(filepath.Join(dir, tid), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if comm == "" {
+			// The task exited before its name was read.
+			continue
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, tid, "comm"), []byte(comm), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := procPath
+	procPath = dir
+	t.Cleanup(func() { procPath = path })
+}
+
+func TestFindTaskByName(t *testing.T) {
+	fakeProc(t, map[string]string{
+		"1":    "systemd\n",
+		"2":    "kthreadd\n",
+		"120":  "kswapd0\n",
+		"99":   "kswapd0\n",
+		"1000": "kswapd0 \n",
+		"1001": "",
+		"self": "kswapd0\n",
+		"sys":  "",
+	})
+	tests := []struct {
+		name string
+		tids []int
+		err  error
+	}{
+		{"kswapd0", []int{99, 120}, nil},
+		{"systemd", []int{1}, nil},
+		{"kswapd", nil, PerfTaskNotFound},
+		{"", nil, PerfTaskNotFound},
+	}
+	for _, tt := range tests {
+		tids, err := FindTaskByName(tt.name)
+		if err != tt.err || !reflect.DeepEqual(tids, tt.tids) {
+			t.Errorf("FindTaskByName(%q) = %v, %v, want %v, %v", tt.name, tids, err, tt.tids, tt.err)
+		}
+	}
+}
+
+func TestInitOpenEventsEnableTask(t *testing.T) {
+	comm, err := ioutil.ReadFile("/proc/self/comm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := string(comm[:len(comm)-1])
+	tids, err := FindTaskByName(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, tid := range tids {
+		found = found || tid == os.Getpid()
+	}
+	if !found {
+		t.Fatalf("FindTaskByName(%q) = %v, without the test %d", name, tids, os.Getpid())
+	}
+
+	err, eventListNA, eventsInfo := InitOpenEventsEnableTask("page-faults,cpu-clock", name)
+	defer EventsDisableClose(eventsInfo)
+	if err != nil {
+		t.Skipf("can't open %v: %v", eventListNA, err)
+	}
+	if len(eventsInfo) != 2*len(tids) {
+		t.Errorf("opened %d events, want 2 for each of %v", len(eventsInfo), tids)
+	}
+
+	if err, _, _ := InitOpenEventsEnableTask("page-faults", "no such task"); err != PerfTaskNotFound {
+		t.Errorf("InitOpenEventsEnableTask() = %v, want %v", err, PerfTaskNotFound)
+	}
+}
+
+func TestMeasureProcessTree(t *testing.T) {
+	// The children run once the counters are in place.
+	cmd := exec.Command("sh", "-c", "read line; /bin/true; /bin/true")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Skipf("can't run sh: %v", err)
+	}
+	defer cmd.Wait()
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		stdin.Write([]byte("\n"))
+		stdin.Close()
+	}()
+
+	counts, err := MeasureProcessTree("page-faults,task-clock", cmd.Process.Pid, 300*time.Millisecond)
+	if err != nil {
+		t.Skipf("can't measure the process tree: %v", err)
+	}
+	// Each exec of /bin/true faults its pages in.
+	if counts["page-faults"] < 10 || counts["task-clock"] == 0 {
+		t.Errorf("MeasureProcessTree() = %v, want the counts of the children", counts)
+	}
+
+	if _, err := MeasureProcessTree("page-faults", 1<<30, time.Millisecond); err == nil {
+		t.Errorf("MeasureProcessTree() of a missing process succeeded")
+	}
+}
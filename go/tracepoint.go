@@ -0,0 +1,59 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// The kernel exports the id of each tracepoint in
+// <tracefs>/events/<subsystem>/<tracepoint>/id, tracefs being mounted
+// on one of tracefsPaths.
+var tracefsPaths = []string{"/sys/kernel/tracing", "/sys/kernel/debug/tracing"}
+
+// splitTracepoint splits the event "name" into the tracepoint it names,
+// e.g. "sched:sched_switch", and its modifiers, e.g. "u" for
+// "sched:sched_switch:u", if it names a tracepoint, i.e., the part
+// before its first colon isn't an event.
+func splitTracepoint(name string) (string, string, bool) {
+	i := strings.IndexByte(name, ':')
+	if i <= 0 || i == len(name)-1 {
+		return "", "", false
+	}
+	if _, ok := EventNameToConfig(name[:i]); ok {
+		return "", "", false
+	}
+	if _, ok := sysfsEventList[name[:i]]; ok {
+		return "", "", false
+	}
+	tracepoint, modifiers := name, ""
+	if j := strings.IndexByte(name[i+1:], ':'); j >= 0 {
+		tracepoint, modifiers = name[:i+1+j], name[i+2+j:]
+	}
+	return tracepoint, modifiers, true
+}
+
+// resolveTracepoint sets up the perf event attributes for the tracepoint
+// "tracepoint", e.g. "syscalls:sys_enter_read", as found in tracefs. The
+// tracepoints are hit in the kernel, so the event counts in the kernel
+// by default. Reading tracefs usually needs to be root.
+func resolveTracepoint(tracepoint string) (PerfEventAttr, error) {
+	i := strings.IndexByte(tracepoint, ':')
+	subsystem, event := tracepoint[:i], tracepoint[i+1:]
+	// Don't let the names walk out of tracefs.
+	if strings.ContainsAny(subsystem, "/.") || strings.ContainsAny(event, "/.") {
+		return PerfEventAttr{}, PerfUnsupportedEvent
+	}
+	for _, tracefs := range tracefsPaths {
+		id, err := readSysfsUint(filepath.Join(tracefs, "events", subsystem, event, "id"))
+		if err != nil {
+			continue
+		}
+		eventAttr := setupPerfEventAttr(EventConfigType{PERF_TYPE_TRACEPOINT, id})
+		eventAttr.Bits &^= 1 << EXCLUDE_KERNEL
+		return eventAttr, nil
+	}
+	return PerfEventAttr{}, PerfUnsupportedEvent
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestSplitTracepoint(t *testing.T) {
+	tests := []struct {
+		name                  string
+		tracepoint, modifiers string
+		ok                    bool
+	}{
+		{"sched:sched_switch", "sched:sched_switch", "", true},
+		{"sched:sched_switch:u", "sched:sched_switch", "u", true},
+		{"syscalls:sys_enter_read:uk", "syscalls:sys_enter_read", "uk", true},
+		// Events with modifiers.
+		{"cpu-cycles:u", "", "", false},
+		{"page-faults:k", "", "", false},
+		{"mem-loads:u", "", "", false},
+		{"sched", "", "", false},
+		{":sched_switch", "", "", false},
+		{"sched:", "", "", false},
+		{"", "", "", false},
+	}
+	for _, tt := range tests {
+		tracepoint, modifiers, ok := splitTracepoint(tt.name)
+		if tracepoint != tt.tracepoint || modifiers != tt.modifiers || ok != tt.ok {
+			t.Errorf("splitTracepoint(%q) = %q, %q, %v, want %q, %q, %v", tt.name,
+				tracepoint, modifiers, ok, tt.tracepoint, tt.modifiers, tt.ok)
+		}
+	}
+}
+
+// fakeTracefs points tracefsPaths to an empty directory, then to one
+// holding the tracepoints "ids", for the time of the test.
+func fakeTracefs(t *testing.T, ids map[string]string) {
+	dir := t.TempDir()
+	for tracepoint, id := range ids {
+		path := filepath.Join(dir, "events", tracepoint, "id")
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(id), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	paths := tracefsPaths
+	tracefsPaths = []string{t.TempDir(), dir}
+	t.Cleanup(func() { tracefsPaths = paths })
+}
+
+func TestResolveTracepoint(t *testing.T) {
+	fakeTracefs(t, map[string]string{
+		"sched/sched_switch":       "316\n",
+		"syscalls/sys_enter_read":  "712\n",
+		"syscalls/sys_enter_write": "not a number\n",
+	})
+	tests := []struct {
+		tracepoint string
+		id         uint64
+		err        error
+	}{
+		{"sched:sched_switch", 316, nil},
+		{"syscalls:sys_enter_read", 712, nil},
+		{"syscalls:sys_enter_write", 0, PerfUnsupportedEvent},
+		{"sched:no_such_tracepoint", 0, PerfUnsupportedEvent},
+		{"..:sched", 0, PerfUnsupportedEvent},
+		{"sched:../sched_switch", 0, PerfUnsupportedEvent},
+	}
+	for _, tt := range tests {
+		eventAttr, err := resolveTracepoint(tt.tracepoint)
+		if err != tt.err {
+			t.Errorf("resolveTracepoint(%q) = %v, want %v", tt.tracepoint, err, tt.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if eventAttr.Type != PERF_TYPE_TRACEPOINT || eventAttr.Config != tt.id {
+			t.Errorf("resolveTracepoint(%q) = type %d, config %d, want %d, %d", tt.tracepoint,
+				eventAttr.Type, eventAttr.Config, PERF_TYPE_TRACEPOINT, tt.id)
+		}
+		if eventAttr.Bits&(1<<EXCLUDE_KERNEL) != 0 {
+			t.Errorf("resolveTracepoint(%q) excludes the kernel", tt.tracepoint)
+		}
+	}
+}
+
+func TestTracepointCount(t *testing.T) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	eventsInfo := openOrSkip(t, "syscalls:sys_enter_getpid", EventOptions{})
+	defer EventsDisableClose(eventsInfo)
+
+	const calls = 100
+	event := &eventsInfo[0]
+	if err := event.ReadEvent(); err != nil {
+		t.Fatal(err)
+	}
+	before := event.Data
+	for i := 0; i < calls; i++ {
+		unix.Getpid()
+	}
+	if err := event.ReadEvent(); err != nil {
+		t.Fatal(err)
+	}
+	if count := event.Data - before; count != calls {
+		t.Errorf("counted %d getpid calls, want %d", count, calls)
+	}
+}
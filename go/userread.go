@@ -0,0 +1,139 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"errors"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+)
+
+var PerfUserPageError = errors.New("couldn't map the user page of event")
+var PerfUserReadUnsupported = errors.New("event can't be read from user space")
+
+// Layout of the first page of the mmap'd buffer of an event (struct
+// perf_event_mmap_page in linux/perf_event.h)
+type perfEventMmapPage struct {
+	version        uint32
+	compat_version uint32
+	lock           uint32
+	index          uint32
+	offset         int64
+	time_enabled   uint64
+	time_running   uint64
+	capabilities   uint64
+	pmc_width      uint16
+	time_shift     uint16
+	time_mult      uint32
+	time_offset    uint64
+}
+
+// Bits of perfEventMmapPage.capabilities
+const (
+	capUserRdpmc = 1 << 2
+	capUserTime  = 1 << 3
+)
+
+// MapUserPage maps the first page of the buffer of the event, which the
+// kernel keeps up to date with what is needed to read the event from user
+// space, see ReadUserScaled. The page is unmapped when the event is
+// closed with DisableClose.
+func (event *PerfEventInfo) MapUserPage() error {
+	if event.Fd < 0 {
+		return PerfFdError
+	}
+	if event.userPage != nil {
+		return nil
+	}
+	page, err := syscall.Mmap(event.Fd, 0, os.Getpagesize(), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return PerfUserPageError
+	}
+	event.userPage = page
+	return nil
+}
+
+// unmapUserPage unmaps the page mapped by MapUserPage, if any.
+func (event *PerfEventInfo) unmapUserPage() {
+	if event.userPage != nil {
+		syscall.Munmap(event.userPage)
+		event.userPage = nil
+	}
+}
+
+// ReadUserScaled reads the count of the event from user space, without
+// any system call, and scales it by the time the event was enabled over
+// the time it actually counted, as ReadScaledDelta does. The user page
+// of the event must have been mapped with MapUserPage.
+// The counter is read with the rdpmc instruction, which only x86 has, and
+// only for an event of the PMU of the CPU counting the calling thread:
+// PerfUserReadUnsupported is returned otherwise, e.g. for a software
+// event, the count having to be read with ReadEvent. The calling
+// goroutine should be locked to its thread, see runtime.LockOSThread.
+func (event *PerfEventInfo) ReadUserScaled() (float64, error) {
+	if event.userPage == nil {
+		return 0, PerfUserPageError
+	}
+	if !hasUserRead {
+		return 0, PerfUserReadUnsupported
+	}
+	pc := (*perfEventMmapPage)(unsafe.Pointer(&event.userPage[0]))
+
+	var count int64
+	var enabled, running, cycles uint64
+	var index uint32
+	var caps uint64
+	var width, timeShift uint16
+	var timeMult uint32
+	var timeOffset uint64
+	// The kernel updates the page under the lock sequence count, read
+	// it all again until it wasn't updated in the meantime.
+	for {
+		seq := atomic.LoadUint32(&pc.lock)
+		caps = atomic.LoadUint64(&pc.capabilities)
+		enabled = atomic.LoadUint64(&pc.time_enabled)
+		running = atomic.LoadUint64(&pc.time_running)
+		cycles = 0
+		if caps&capUserTime != 0 && enabled != running {
+			cycles = rdtsc()
+			timeShift = pc.time_shift
+			timeMult = pc.time_mult
+			timeOffset = pc.time_offset
+		}
+		index = atomic.LoadUint32(&pc.index)
+		count = atomic.LoadInt64(&pc.offset)
+		width = pc.pmc_width
+		if caps&capUserRdpmc != 0 && index != 0 && width != 0 {
+			// The counter is pmc_width bits wide, sign extend it.
+			shift := 64 - uint(width)
+			count += int64(rdpmc(index-1)<<shift) >> shift
+		}
+		if atomic.LoadUint32(&pc.lock) == seq {
+			break
+		}
+	}
+	if caps&capUserRdpmc == 0 || width == 0 {
+		return 0, PerfUserReadUnsupported
+	}
+
+	// Extrapolate the times up to now, the kernel only updating them
+	// when the event is scheduled.
+	if cycles != 0 {
+		shift := uint(timeShift)
+		mult := uint64(timeMult)
+		quot := cycles >> shift
+		rem := cycles & (1<<shift - 1)
+		delta := timeOffset + quot*mult + (rem*mult)>>shift
+		enabled += delta
+		if index != 0 {
+			running += delta
+		}
+	}
+	if running == 0 || running >= enabled {
+		return float64(count), nil
+	}
+	return float64(count) * float64(enabled) / float64(running), nil
+}
@@ -0,0 +1,13 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+// The counters can be read from user space with rdpmc.
+const hasUserRead = true
+
+// rdpmc reads the performance counter "counter" of the CPU.
+func rdpmc(counter uint32) uint64
+
+// rdtsc reads the time stamp counter of the CPU.
+func rdtsc() uint64
@@ -0,0 +1,28 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestRdtsc(t *testing.T) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	// The time stamp counter ticks at a constant rate, and forward.
+	tsc := rdtsc()
+	for i := 0; i < 1000; i++ {
+		next := rdtsc()
+		if next < tsc {
+			t.Fatalf("rdtsc() went back from %d to %d", tsc, next)
+		}
+		tsc = next
+	}
+	time.Sleep(10 * time.Millisecond)
+	if next := rdtsc(); next-tsc < 1000000 {
+		t.Errorf("rdtsc() moved by %d in 10ms", next-tsc)
+	}
+}
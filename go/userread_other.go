@@ -0,0 +1,13 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+//go:build !amd64
+
+package perfevents
+
+// Only x86 can read the counters from user space.
+const hasUserRead = false
+
+func rdpmc(counter uint32) uint64 { return 0 }
+
+func rdtsc() uint64 { return 0 }
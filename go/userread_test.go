@@ -0,0 +1,192 @@
+// Copyright (c) 2017 IBM Corp. Rights Reserved.
+// This project is licensed under the Apache License 2.0, see LICENSE.
+
+package perfevents
+
+import (
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"unsafe"
+)
+
+// fakeUserPage returns an event the user page of which is "page", as the
+// kernel would have set it up.
+func fakeUserPage(page perfEventMmapPage) *PerfEventInfo {
+	buf := make([]byte, os.Getpagesize())
+	*(*perfEventMmapPage)(unsafe.Pointer(&buf[0])) = page
+	return &PerfEventInfo{Fd: -1, userPage: buf}
+}
+
+func TestReadUserScaledPage(t *testing.T) {
+	if !hasUserRead {
+		t.Skip("no user space read on " + runtime.GOARCH)
+	}
+	tests := []struct {
+		name string
+		page perfEventMmapPage
+		want float64
+		err  error
+	}{
+		{"not scheduled", perfEventMmapPage{capabilities: capUserRdpmc, pmc_width: 48,
+			offset: 1234, time_enabled: 100, time_running: 100}, 1234, nil},
+		{"scaled", perfEventMmapPage{capabilities: capUserRdpmc, pmc_width: 48,
+			offset: 1234, time_enabled: 200, time_running: 100}, 2468, nil},
+		{"never ran", perfEventMmapPage{capabilities: capUserRdpmc, pmc_width: 48,
+			offset: 1234, time_enabled: 200}, 1234, nil},
+		{"no rdpmc", perfEventMmapPage{pmc_width: 48, offset: 1234}, 0, PerfUserReadUnsupported},
+		{"no width", perfEventMmapPage{capabilities: capUserRdpmc, offset: 1234},
+			0, PerfUserReadUnsupported},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := fakeUserPage(tt.page).ReadUserScaled()
+			if err != tt.err || got != tt.want {
+				t.Errorf("ReadUserScaled() = %v, %v, want %v, %v", got, err, tt.want, tt.err)
+			}
+		})
+	}
+
+	var event PerfEventInfo
+	if _, err := event.ReadUserScaled(); err != PerfUserPageError {
+		t.Errorf("ReadUserScaled() without a user page: %v, want %v", err, PerfUserPageError)
+	}
+}
+
+// The count read from user space lies between the counts read with the
+// syscall before and after it.
+func TestReadUserScaledCrossCheck(t *testing.T) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	events := openOrSkip(t, "instructions:u", EventOptions{})
+	defer EventsDisableClose(events)
+	event := &events[0]
+	if err := event.MapUserPage(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := event.ReadUserScaled(); err == PerfUserReadUnsupported {
+		t.Skip("instructions can't be read from user space")
+	}
+
+	for i := 0; i < 100; i++ {
+		if err := event.ReadEvent(); err != nil {
+			t.Fatal(err)
+		}
+		before := event.Scaled()
+		user, err := event.ReadUserScaled()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := event.ReadEvent(); err != nil {
+			t.Fatal(err)
+		}
+		after := event.Scaled()
+		// Scaling makes for some error when the event is multiplexed.
+		slack := 0.0
+		if event.Multiplexed() {
+			slack = after * 0.05
+		}
+		if user < before-slack || user > after+slack {
+			t.Fatalf("ReadUserScaled() = %v, not between the syscall reads %v and %v", user, before, after)
+		}
+	}
+}
+
+func TestReadUserScaledSoftware(t *testing.T) {
+	events := openOrSkip(t, "task-clock", EventOptions{})
+	defer EventsDisableClose(events)
+	event := &events[0]
+	if err := event.MapUserPage(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := event.ReadUserScaled(); err != PerfUserReadUnsupported {
+		t.Errorf("ReadUserScaled() of a software event: %v, want %v", err, PerfUserReadUnsupported)
+	}
+}
+
+// perfMappings returns the number of perf event pages mapped by the
+// process.
+func perfMappings(t *testing.T) int {
+	maps, err := ioutil.ReadFile("/proc/self/maps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Count(string(maps), "[perf_event]")
+}
+
+func TestReopenUserPage(t *testing.T) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	for _, name := range []string{"task-clock", "instructions:u"} {
+		t.Run(name, func(t *testing.T) {
+			events := openOrSkip(t, name, EventOptions{})
+			defer EventsDisableClose(events)
+			event := &events[0]
+			mappings := perfMappings(t)
+			if err := event.MapUserPage(); err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 1000000; i++ {
+			}
+
+			// The page of the old event is unmapped, that of the
+			// new one mapped.
+			if err := event.Reopen(); err != nil {
+				t.Fatal(err)
+			}
+			if n := perfMappings(t); n != mappings+1 {
+				t.Errorf("%d perf event pages mapped after Reopen(), want %d", n, mappings+1)
+			}
+			// The kernel keeps updating the page of the open event
+			// only, e.g. on a reset.
+			pc := (*perfEventMmapPage)(unsafe.Pointer(&event.userPage[0]))
+			if err := event.ResetEvent(); err != nil {
+				t.Fatal(err)
+			}
+			enabled := atomic.LoadUint64(&pc.time_enabled)
+			for i := 0; i < 1000000; i++ {
+			}
+			if err := event.ResetEvent(); err != nil {
+				t.Fatal(err)
+			}
+			if now := atomic.LoadUint64(&pc.time_enabled); now <= enabled {
+				t.Errorf("the user page isn't updated after Reopen(): time enabled %d, then %d", enabled, now)
+			}
+			user, err := event.ReadUserScaled()
+			if err == PerfUserReadUnsupported {
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The count restarted from 0 with the new event.
+			if err := event.ReadEvent(); err != nil {
+				t.Fatal(err)
+			}
+			if user > event.Scaled() {
+				t.Errorf("ReadUserScaled() = %v after Reopen(), beyond the count %v of the new event", user, event.Scaled())
+			}
+		})
+	}
+}
+
+func TestCloseEventsUserPage(t *testing.T) {
+	err, eventListNA, events := InitOpenEventsEnableSelf("task-clock,page-faults")
+	if err != nil {
+		closeEvents(events)
+		t.Skipf("can't open %v: %v", eventListNA, err)
+	}
+	mappings := perfMappings(t)
+	for i := range events {
+		if err := events[i].MapUserPage(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	closeEvents(events)
+	if n := perfMappings(t); n != mappings {
+		t.Errorf("%d perf event pages left mapped, want %d", n, mappings)
+	}
+}